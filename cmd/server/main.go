@@ -3,17 +3,20 @@ package main
 import (
 	"context"
 	"database/sql"
+	"expvar"
 	"fmt"
 	"log/slog"
 	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
 	"syscall"
 	"time"
 
 	"github.com/gorilla/mux"
 
 	"github.com/riteshkumar/internal-transfers/internal/handler"
+	"github.com/riteshkumar/internal-transfers/internal/models"
 	"github.com/riteshkumar/internal-transfers/internal/repository"
 	"github.com/riteshkumar/internal-transfers/internal/service"
 )
@@ -26,6 +29,36 @@ type Config struct {
 	DBName     string
 	DBSSLMode  string
 	ServerPort string
+
+	// TrustedProxies lists the proxies, as addresses or CIDR ranges, whose
+	// X-Forwarded-For is believed. Like the gateway that sets the
+	// authenticated principal, they must sit in front of the service.
+	TrustedProxies string
+
+	HoldExpiryInterval time.Duration
+
+	AccountBatchSize int
+
+	// AuditStrict makes transfers, reversals and account creation fail when
+	// their audit entries cannot be written
+	AuditStrict bool
+
+	IdempotencyKeyTTL        time.Duration
+	IdempotencyPurgeInterval time.Duration
+
+	// OutboxPublisher is "stdout" or "file"; the file publisher appends to
+	// OutboxFile
+	OutboxPublisher     string
+	OutboxFile          string
+	OutboxRelayInterval time.Duration
+
+	// Webhook deliveries are attempted every WebhookDispatchInterval and
+	// given up after WebhookMaxAttempts attempts
+	WebhookDispatchInterval time.Duration
+	WebhookMaxAttempts      int
+	// WebhookAllowLocalHosts lets webhooks be sent to loopback and
+	// link-local addresses, e.g. for local development
+	WebhookAllowLocalHosts bool
 }
 
 func main() {
@@ -38,6 +71,12 @@ func main() {
 	// Load configuration
 	config := loadConfig()
 
+	trustedProxies, err := handler.ParseTrustedProxies(config.TrustedProxies)
+	if err != nil {
+		logger.Error("invalid TRUSTED_PROXIES", "error", err.Error())
+		os.Exit(1)
+	}
+
 	// Connect to the database
 	db, err := connectDB(config)
 	if err != nil {
@@ -46,20 +85,64 @@ func main() {
 	}
 	defer db.Close()
 
+	// Audit writers read the chain head through a pool of their own, see
+	// NewAuditRepository; only the writer holding the chain lock uses it
+	chainDB, err := connectDB(config)
+	if err != nil {
+		logger.Error("failed to connect to database", "error", err.Error())
+		os.Exit(1)
+	}
+	chainDB.SetMaxOpenConns(1)
+	chainDB.SetMaxIdleConns(1)
+	defer chainDB.Close()
+
 	logger.Info("connected to database successfully")
 
 	// Initialise repo
 	accountRepo := repository.NewAccountRepository(db)
 	transactionRepo := repository.NewTransactionRepository(db)
-	auditRepo := repository.NewAuditRepository(db)
+	auditRepo := repository.NewAuditRepository(db, chainDB)
+	fxRateRepo := repository.NewFXRateRepository(db)
+	journalRepo := repository.NewJournalRepository(db)
+	holdRepo := repository.NewHoldRepository(db)
+	idempotencyRepo := repository.NewIdempotencyRepository(db)
+	outboxRepo := repository.NewOutboxRepository(db)
+	webhookRepo := repository.NewWebhookRepository(db)
+
+	// Initialise the publisher the outbox relays events to
+	publisher, closePublisher, err := newPublisher(config)
+	if err != nil {
+		logger.Error("failed to create event publisher", "error", err.Error())
+		os.Exit(1)
+	}
+	defer closePublisher()
+
+	// Relayed events also become deliveries to the webhooks subscribed to them
+	webhookPublisher := service.NewWebhookPublisher(webhookRepo, logger)
+	webhookRetryPolicy := service.DefaultWebhookRetryPolicy
+	webhookRetryPolicy.MaxAttempts = config.WebhookMaxAttempts
+	webhookDispatcher := service.NewWebhookDispatcher(webhookRepo, service.NewWebhookClient(service.DefaultWebhookTimeout, config.WebhookAllowLocalHosts), webhookRetryPolicy, logger)
 
 	// Initliase services
-	accountService := service.NewAccountService(accountRepo, auditRepo, logger)
-	transactionService := service.NewTransactionService(db, accountRepo, transactionRepo, auditRepo, logger)
+	ledger := service.NewLedger(accountRepo, journalRepo)
+	idempotencyService := service.NewIdempotencyService(idempotencyRepo, config.IdempotencyKeyTTL, logger)
+	auditWriter := service.NewAuditWriter(config.AuditStrict, logger)
+	outbox := service.NewOutbox(outboxRepo)
+	outboxRelay := service.NewOutboxRelay(db, outboxRepo, service.NewMultiPublisher(publisher, webhookPublisher), service.DefaultOutboxBatchSize, logger)
+	accountService := service.NewAccountService(db, accountRepo, auditRepo, ledger, idempotencyService, auditWriter, outbox, config.AccountBatchSize, logger)
+	transactionService := service.NewTransactionService(db, accountRepo, transactionRepo, fxRateRepo, auditRepo, ledger, idempotencyService, auditWriter, outbox, logger)
+	fxRateService := service.NewFXRateService(db, fxRateRepo, auditRepo, logger)
+	holdService := service.NewHoldService(db, accountRepo, holdRepo, auditRepo, transactionService, logger)
+	auditService := service.NewAuditService(auditRepo, logger)
+	webhookService := service.NewWebhookService(webhookRepo, config.WebhookAllowLocalHosts, logger)
 
 	// Initialise handlers
-	accountHandler := handler.NewAccountHandler(accountService, logger)
-	transactionHandler := handler.NewTransactionHandler(transactionService, logger)
+	accountHandler := handler.NewAccountHandler(accountService, idempotencyService, logger)
+	transactionHandler := handler.NewTransactionHandler(transactionService, idempotencyService, logger)
+	fxRateHandler := handler.NewFXRateHandler(fxRateService, logger)
+	holdHandler := handler.NewHoldHandler(holdService, logger)
+	auditHandler := handler.NewAuditHandler(auditService, logger)
+	webhookHandler := handler.NewWebhookHandler(webhookService, logger)
 
 	// Setup router
 	router := mux.NewRouter()
@@ -67,6 +150,10 @@ func main() {
 	//Register routes
 	accountHandler.RegisterRoutes(router)
 	transactionHandler.RegisterRoutes(router)
+	fxRateHandler.RegisterRoutes(router)
+	holdHandler.RegisterRoutes(router)
+	auditHandler.RegisterRoutes(router)
+	webhookHandler.RegisterRoutes(router)
 
 	// Add health check endpoint
 	router.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
@@ -75,7 +162,11 @@ func main() {
 		w.Write([]byte(`{"status":"healthy"}`))
 	}).Methods(http.MethodGet)
 
-	// Add middleware for logging
+	// Expose runtime metrics such as db txn retries to admins only
+	router.Handle("/admin/debug/vars", expvar.Handler()).Methods(http.MethodGet)
+
+	// Attribute audit entries to the caller, then log the request with its ID
+	router.Use(handler.ActorMiddleware(trustedProxies))
 	router.Use(loggingMiddleware(logger))
 
 	// Create HTTP server
@@ -87,6 +178,13 @@ func main() {
 		IdleTimeout:  60 * time.Second,
 	}
 
+	// Chain any audit entries that servers which chained after commit left
+	// behind, before this server writes entries of its own
+	if _, err := auditService.ChainUnchained(context.Background()); err != nil {
+		logger.Error("failed to chain audit logs", "error", err.Error())
+		os.Exit(1)
+	}
+
 	// Start server in a go routine
 	go func() {
 		logger.Info("starting server on port " + config.ServerPort)
@@ -96,11 +194,21 @@ func main() {
 		}
 	}()
 
+	// Expire lapsed holds and idempotency keys, relay outbox events and
+	// dispatch webhooks in the background until shutdown
+	backgroundCtx, stopBackground := context.WithCancel(context.Background())
+	defer stopBackground()
+	go holdService.RunExpiry(backgroundCtx, config.HoldExpiryInterval)
+	go idempotencyService.RunPurge(backgroundCtx, config.IdempotencyPurgeInterval)
+	go outboxRelay.Run(backgroundCtx, config.OutboxRelayInterval)
+	go webhookDispatcher.Run(backgroundCtx, config.WebhookDispatchInterval)
+
 	// Wait for interrupt signal to gracefully shutdown the server
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
 	<-quit
 	logger.Info("shutting down server...")
+	stopBackground()
 
 	// Create context with timeout for shutdown
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
@@ -123,6 +231,42 @@ func loadConfig() Config {
 		DBName:     getEnv("DB_NAME", "transfers"),
 		DBSSLMode:  getEnv("DB_SSLMODE", "disable"),
 		ServerPort: getEnv("SERVER_PORT", "8080"),
+
+		TrustedProxies: getEnv("TRUSTED_PROXIES", ""),
+
+		HoldExpiryInterval: getEnvDuration("HOLD_EXPIRY_INTERVAL", time.Minute),
+
+		AccountBatchSize: getEnvInt("ACCOUNT_BATCH_SIZE", service.DefaultAccountBatchSize),
+
+		AuditStrict: getEnvBool("AUDIT_STRICT", true),
+
+		IdempotencyKeyTTL:        getEnvDuration("IDEMPOTENCY_KEY_TTL", service.DefaultIdempotencyKeyTTL),
+		IdempotencyPurgeInterval: getEnvDuration("IDEMPOTENCY_PURGE_INTERVAL", time.Hour),
+
+		OutboxPublisher:     getEnv("OUTBOX_PUBLISHER", "stdout"),
+		OutboxFile:          getEnv("OUTBOX_FILE", "outbox-events.jsonl"),
+		OutboxRelayInterval: getEnvDuration("OUTBOX_RELAY_INTERVAL", time.Second),
+
+		WebhookDispatchInterval: getEnvDuration("WEBHOOK_DISPATCH_INTERVAL", time.Second),
+		WebhookMaxAttempts:      getEnvInt("WEBHOOK_MAX_ATTEMPTS", service.DefaultWebhookRetryPolicy.MaxAttempts),
+		WebhookAllowLocalHosts:  getEnvBool("WEBHOOK_ALLOW_LOCAL_HOSTS", false),
+	}
+}
+
+// newPublisher creates the configured event publisher and a func that
+// releases it
+func newPublisher(cfg Config) (service.Publisher, func(), error) {
+	switch cfg.OutboxPublisher {
+	case "stdout":
+		return service.NewStdoutPublisher(), func() {}, nil
+	case "file":
+		publisher, err := service.NewFilePublisher(cfg.OutboxFile)
+		if err != nil {
+			return nil, nil, err
+		}
+		return publisher, func() { publisher.Close() }, nil
+	default:
+		return nil, nil, fmt.Errorf("unknown OUTBOX_PUBLISHER %q, want stdout or file", cfg.OutboxPublisher)
 	}
 }
 
@@ -134,6 +278,48 @@ func getEnv(key, defaultValue string) string {
 	return defaultValue
 }
 
+// getEnvDuration parses a duration environment variable such as "30s",
+// falling back to the default when it is unset or invalid
+func getEnvDuration(key string, defaultValue time.Duration) time.Duration {
+	value, exists := os.LookupEnv(key)
+	if !exists {
+		return defaultValue
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d <= 0 {
+		return defaultValue
+	}
+	return d
+}
+
+// getEnvInt parses a positive integer environment variable, falling back to
+// the default when it is unset or invalid
+func getEnvInt(key string, defaultValue int) int {
+	value, exists := os.LookupEnv(key)
+	if !exists {
+		return defaultValue
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n <= 0 {
+		return defaultValue
+	}
+	return n
+}
+
+// getEnvBool parses a boolean environment variable such as "true" or "0",
+// falling back to the default when it is unset or invalid
+func getEnvBool(key string, defaultValue bool) bool {
+	value, exists := os.LookupEnv(key)
+	if !exists {
+		return defaultValue
+	}
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		return defaultValue
+	}
+	return b
+}
+
 // connectDB establishes a connection to the Postgres database
 func connectDB(cfg Config) (*sql.DB, error) {
 	connStr := fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=%s",
@@ -166,7 +352,13 @@ func loggingMiddleware(logger *slog.Logger) mux.MiddlewareFunc {
 
 			next.ServeHTTP(wrapped, r)
 
+			var requestID string
+			if actor := models.AuditActorFromContext(r.Context()); actor != nil {
+				requestID = actor.RequestID
+			}
+
 			logger.Info("incoming request",
+				"request_id", requestID,
 				"method", r.Method,
 				"path", r.URL.Path,
 				"status", wrapped.statusCode,
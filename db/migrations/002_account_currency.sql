@@ -0,0 +1,15 @@
+-- Multi-currency accounts
+-- Existing accounts predate currencies and are assumed to be USD.
+
+ALTER TABLE accounts ADD COLUMN IF NOT EXISTS currency CHAR(3) NOT NULL DEFAULT 'USD';
+ALTER TABLE accounts ALTER COLUMN currency DROP DEFAULT;
+ALTER TABLE accounts ADD CONSTRAINT currency_iso_code CHECK (currency ~ '^[A-Z]{3}$');
+
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS currency CHAR(3) NOT NULL DEFAULT 'USD';
+ALTER TABLE transactions ALTER COLUMN currency DROP DEFAULT;
+ALTER TABLE transactions ADD CONSTRAINT transaction_currency_iso_code CHECK (currency ~ '^[A-Z]{3}$');
+
+-- Widen money columns to three decimal places for currencies such as BHD.
+-- Per-currency precision is enforced by the application.
+ALTER TABLE accounts ALTER COLUMN balance TYPE DECIMAL(18,3);
+ALTER TABLE transactions ALTER COLUMN amount TYPE DECIMAL(18,3);
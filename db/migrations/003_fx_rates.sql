@@ -0,0 +1,38 @@
+-- Foreign-exchange rates and cross-currency transfers
+
+CREATE TABLE IF NOT EXISTS fx_rates (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    base_currency CHAR(3) NOT NULL,
+    quote_currency CHAR(3) NOT NULL,
+    rate DECIMAL(20,10) NOT NULL, -- units of quote currency per unit of base currency
+    valid_from TIMESTAMPTZ NOT NULL,
+    valid_to TIMESTAMPTZ, -- null means open-ended
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT fx_rate_positive CHECK (rate > 0),
+    CONSTRAINT fx_rate_distinct_currencies CHECK (base_currency != quote_currency),
+    CONSTRAINT fx_rate_valid_window CHECK (valid_to IS NULL OR valid_to > valid_from)
+);
+
+CREATE INDEX IF NOT EXISTS idx_fx_rates_pair_valid_from ON fx_rates(base_currency, quote_currency, valid_from DESC);
+
+-- Every transfer records what the destination received. For same-currency
+-- transfers the destination side mirrors the source side and the fx columns
+-- stay null.
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS destination_amount DECIMAL(18,3);
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS destination_currency CHAR(3);
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS fx_rate_id UUID REFERENCES fx_rates(id);
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS fx_rate DECIMAL(20,10);
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS fx_rounding_adjustment DECIMAL(32,14);
+
+UPDATE transactions
+SET destination_amount = amount, destination_currency = currency
+WHERE destination_amount IS NULL;
+
+ALTER TABLE transactions ALTER COLUMN destination_amount SET NOT NULL;
+ALTER TABLE transactions ALTER COLUMN destination_currency SET NOT NULL;
+
+ALTER TABLE transactions ADD CONSTRAINT destination_amount_positive CHECK (destination_amount > 0);
+ALTER TABLE transactions ADD CONSTRAINT fx_fields_consistent CHECK (
+    (currency = destination_currency AND destination_amount = amount AND fx_rate IS NULL)
+    OR (currency != destination_currency AND fx_rate IS NOT NULL AND fx_rounding_adjustment IS NOT NULL)
+);
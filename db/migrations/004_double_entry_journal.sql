@@ -0,0 +1,116 @@
+-- Double-entry journal
+--
+-- Every movement of money is a journal entry made of postings. A posting's
+-- amount is the signed change it makes to its account's balance (credits
+-- positive, debits negative) and the postings of an entry must sum to zero
+-- per currency. accounts.balance is a projection of the postings.
+--
+-- System accounts are internal counterparties (opening-balance equity, FX
+-- positions). Their ids use the reserved "sys:" prefix and they may go
+-- negative.
+
+BEGIN;
+
+ALTER TABLE accounts ADD COLUMN IF NOT EXISTS type VARCHAR(20) NOT NULL DEFAULT 'CUSTOMER';
+ALTER TABLE accounts ADD CONSTRAINT account_type_valid CHECK (type IN ('CUSTOMER', 'SYSTEM'));
+ALTER TABLE accounts DROP CONSTRAINT IF EXISTS balance_non_negative;
+ALTER TABLE accounts ADD CONSTRAINT balance_non_negative CHECK (balance >= 0 OR type = 'SYSTEM');
+
+CREATE TABLE IF NOT EXISTS journal_entries (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    kind VARCHAR(50) NOT NULL, -- 'ACCOUNT_OPENING', 'TRANSFER'
+    transaction_id UUID REFERENCES transactions(id),
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS postings (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    journal_entry_id UUID NOT NULL REFERENCES journal_entries(id),
+    account_id VARCHAR(36) NOT NULL REFERENCES accounts(id),
+    amount DECIMAL(18,3) NOT NULL, -- signed change to the account balance
+    currency CHAR(3) NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT posting_amount_non_zero CHECK (amount != 0)
+);
+
+CREATE INDEX IF NOT EXISTS idx_journal_entries_transaction ON journal_entries(transaction_id);
+CREATE INDEX IF NOT EXISTS idx_postings_journal_entry ON postings(journal_entry_id);
+CREATE INDEX IF NOT EXISTS idx_postings_account_created_at ON postings(account_id, created_at);
+
+-- Reject any journal entry whose postings do not sum to zero per currency.
+-- Deferred so that all postings of an entry can be inserted first.
+CREATE OR REPLACE FUNCTION check_journal_entry_balanced() RETURNS trigger AS $$
+BEGIN
+    IF EXISTS (
+        SELECT 1 FROM postings
+        WHERE journal_entry_id = NEW.journal_entry_id
+        GROUP BY currency
+        HAVING SUM(amount) != 0
+    ) THEN
+        RAISE EXCEPTION 'journal entry % does not balance', NEW.journal_entry_id
+            USING ERRCODE = 'check_violation';
+    END IF;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS postings_balanced ON postings;
+CREATE CONSTRAINT TRIGGER postings_balanced
+    AFTER INSERT ON postings
+    DEFERRABLE INITIALLY DEFERRED
+    FOR EACH ROW EXECUTE FUNCTION check_journal_entry_balanced();
+
+-- Backfill: express existing history as journal entries.
+
+INSERT INTO accounts (id, currency, balance, type)
+SELECT DISTINCT 'sys:opening:' || currency, currency, 0, 'SYSTEM'
+FROM accounts WHERE type = 'CUSTOMER'
+ON CONFLICT (id) DO NOTHING;
+
+INSERT INTO accounts (id, currency, balance, type)
+SELECT DISTINCT fx.id, fx.currency, 0, 'SYSTEM' FROM (
+    SELECT 'sys:fx:' || currency AS id, currency FROM transactions WHERE currency != destination_currency
+    UNION
+    SELECT 'sys:fx:' || destination_currency, destination_currency FROM transactions WHERE currency != destination_currency
+) fx
+ON CONFLICT (id) DO NOTHING;
+
+INSERT INTO journal_entries (id, kind, transaction_id, created_at)
+SELECT id, 'TRANSFER', id, created_at FROM transactions;
+
+INSERT INTO postings (journal_entry_id, account_id, amount, currency, created_at)
+SELECT id, source_account_id, -amount, currency, created_at FROM transactions
+UNION ALL
+SELECT id, destination_account_id, destination_amount, destination_currency, created_at FROM transactions
+UNION ALL
+SELECT id, 'sys:fx:' || currency, amount, currency, created_at FROM transactions WHERE currency != destination_currency
+UNION ALL
+SELECT id, 'sys:fx:' || destination_currency, -destination_amount, destination_currency, created_at FROM transactions WHERE currency != destination_currency;
+
+-- Whatever part of a customer balance is not explained by transfers is
+-- treated as its opening balance.
+CREATE TEMP TABLE opening_backfill AS
+SELECT gen_random_uuid() AS entry_id, a.id AS account_id, a.currency, a.created_at,
+    a.balance - COALESCE(SUM(p.amount), 0) AS amount
+FROM accounts a
+LEFT JOIN postings p ON p.account_id = a.id
+WHERE a.type = 'CUSTOMER'
+GROUP BY a.id, a.currency, a.created_at, a.balance
+HAVING a.balance - COALESCE(SUM(p.amount), 0) != 0;
+
+INSERT INTO journal_entries (id, kind, created_at)
+SELECT entry_id, 'ACCOUNT_OPENING', created_at FROM opening_backfill;
+
+INSERT INTO postings (journal_entry_id, account_id, amount, currency, created_at)
+SELECT entry_id, account_id, amount, currency, created_at FROM opening_backfill
+UNION ALL
+SELECT entry_id, 'sys:opening:' || currency, -amount, currency, created_at FROM opening_backfill;
+
+DROP TABLE opening_backfill;
+
+UPDATE accounts a
+SET balance = p.total
+FROM (SELECT account_id, SUM(amount) AS total FROM postings GROUP BY account_id) p
+WHERE a.id = p.account_id AND a.type = 'SYSTEM';
+
+COMMIT;
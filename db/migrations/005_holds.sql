@@ -0,0 +1,25 @@
+-- Funds holds (authorize / capture / void)
+
+CREATE TABLE IF NOT EXISTS holds (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    account_id VARCHAR(36) NOT NULL REFERENCES accounts(id),
+    amount DECIMAL(18,3) NOT NULL,
+    currency CHAR(3) NOT NULL,
+    status VARCHAR(20) NOT NULL DEFAULT 'ACTIVE',
+    captured_amount DECIMAL(18,3),
+    transaction_id UUID REFERENCES transactions(id),
+    expires_at TIMESTAMPTZ NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT hold_amount_positive CHECK (amount > 0),
+    CONSTRAINT hold_status_valid CHECK (status IN ('ACTIVE', 'CAPTURED', 'VOIDED', 'EXPIRED')),
+    CONSTRAINT hold_capture_consistent CHECK (
+        (status = 'CAPTURED' AND captured_amount > 0 AND captured_amount <= amount AND transaction_id IS NOT NULL)
+        OR (status != 'CAPTURED' AND captured_amount IS NULL AND transaction_id IS NULL)
+    )
+);
+
+-- Available balance sums the active holds of one account; the expiry job
+-- scans active holds by expiry time.
+CREATE INDEX IF NOT EXISTS idx_holds_account_active ON holds(account_id) WHERE status = 'ACTIVE';
+CREATE INDEX IF NOT EXISTS idx_holds_expires_at_active ON holds(expires_at) WHERE status = 'ACTIVE';
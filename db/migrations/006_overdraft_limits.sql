@@ -0,0 +1,16 @@
+-- Per-account overdraft limits
+--
+-- An account may go negative down to -overdraft_limit. The default of zero
+-- keeps the previous never-negative rule for existing accounts. System
+-- accounts remain unconstrained.
+
+BEGIN;
+
+ALTER TABLE accounts ADD COLUMN IF NOT EXISTS overdraft_limit DECIMAL(18,3) NOT NULL DEFAULT 0;
+ALTER TABLE accounts ADD CONSTRAINT overdraft_limit_non_negative CHECK (overdraft_limit >= 0);
+
+ALTER TABLE accounts DROP CONSTRAINT IF EXISTS balance_non_negative;
+ALTER TABLE accounts ADD CONSTRAINT balance_within_overdraft_limit
+    CHECK (balance >= -overdraft_limit OR type = 'SYSTEM');
+
+COMMIT;
@@ -0,0 +1,9 @@
+-- Account lifecycle states
+--
+-- FROZEN blocks money moving in either direction, DEBIT_FROZEN and
+-- CREDIT_FROZEN block one direction only, and CLOSED is final. Allowed
+-- transitions are enforced by the application.
+
+ALTER TABLE accounts ADD COLUMN IF NOT EXISTS status VARCHAR(20) NOT NULL DEFAULT 'ACTIVE';
+ALTER TABLE accounts ADD CONSTRAINT account_status_valid
+    CHECK (status IN ('ACTIVE', 'FROZEN', 'DEBIT_FROZEN', 'CREDIT_FROZEN', 'CLOSED'));
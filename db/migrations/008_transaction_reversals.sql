@@ -0,0 +1,17 @@
+-- Transfer reversals
+--
+-- A reversal is a compensating transaction that moves money back from the
+-- original destination to the original source and points at the original
+-- through reversal_of_id. The original tracks how much of it has been
+-- reversed, in its own (source) currency, so it can never be reversed past
+-- its amount.
+
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS reversal_of_id UUID REFERENCES transactions(id);
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS reversed_amount DECIMAL(18,3) NOT NULL DEFAULT 0;
+
+ALTER TABLE transactions ADD CONSTRAINT reversed_amount_within_amount
+    CHECK (reversed_amount >= 0 AND reversed_amount <= amount);
+ALTER TABLE transactions ADD CONSTRAINT reversal_not_reversed
+    CHECK (reversal_of_id IS NULL OR reversed_amount = 0);
+
+CREATE INDEX IF NOT EXISTS idx_transactions_reversal_of_id ON transactions(reversal_of_id) WHERE reversal_of_id IS NOT NULL;
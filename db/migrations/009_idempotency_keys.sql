@@ -0,0 +1,18 @@
+-- Idempotency keys
+--
+-- A key is stored in the same transaction as the operation it guards,
+-- together with a fingerprint of the request and the response sent back, so
+-- a retry either replays that response or finds nothing happened. Keys are
+-- scoped to the endpoint and stop counting once they expire.
+
+CREATE TABLE IF NOT EXISTS idempotency_keys (
+    scope VARCHAR(100) NOT NULL,
+    key VARCHAR(255) NOT NULL,
+    fingerprint CHAR(64) NOT NULL,
+    response JSONB NOT NULL,
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    expires_at TIMESTAMPTZ NOT NULL,
+    PRIMARY KEY (scope, key)
+);
+
+CREATE INDEX IF NOT EXISTS idx_idempotency_keys_expires_at ON idempotency_keys(expires_at);
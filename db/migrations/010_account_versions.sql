@@ -0,0 +1,7 @@
+-- Account versions for optimistic concurrency
+--
+-- Every change to an account row bumps version. It is exposed as the ETag of
+-- the account so that clients can detect concurrent changes.
+
+ALTER TABLE accounts ADD COLUMN IF NOT EXISTS version BIGINT NOT NULL DEFAULT 1;
+ALTER TABLE accounts ADD CONSTRAINT version_positive CHECK (version > 0);
@@ -0,0 +1,15 @@
+-- Transfer metadata
+--
+-- reference is an optional client reference, unique per source account.
+-- description is free text and metadata a small map of string tags. The
+-- application bounds their sizes; the checks below are a backstop.
+
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS reference VARCHAR(100);
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS description VARCHAR(500) NOT NULL DEFAULT '';
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS metadata JSONB NOT NULL DEFAULT '{}';
+
+ALTER TABLE transactions ADD CONSTRAINT metadata_is_object CHECK (jsonb_typeof(metadata) = 'object');
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_transactions_source_reference
+    ON transactions(source_account_id, reference) WHERE reference IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_transactions_metadata ON transactions USING GIN (metadata jsonb_path_ops);
@@ -0,0 +1,46 @@
+-- Transaction status
+--
+-- PENDING -> POSTED -> REVERSED, or PENDING -> FAILED. A transfer is
+-- recorded as PENDING and becomes POSTED once its journal entry is posted,
+-- in the same db transaction. It becomes REVERSED once fully reversed.
+--
+-- Rejected transfers (unknown account, insufficient funds, ...) are stored
+-- as FAILED with a reason code. Their accounts may not exist and their
+-- currencies may be unknown, so the account foreign keys are dropped and the
+-- currency columns become nullable for FAILED rows only. Posted money
+-- movements are still tied to real accounts through the journal postings.
+
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS status VARCHAR(20) NOT NULL DEFAULT 'POSTED';
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS failure_reason VARCHAR(50);
+ALTER TABLE transactions ALTER COLUMN status DROP DEFAULT;
+
+UPDATE transactions SET status = 'REVERSED' WHERE reversed_amount = amount;
+
+ALTER TABLE transactions ADD CONSTRAINT transaction_status_valid
+    CHECK (status IN ('PENDING', 'POSTED', 'FAILED', 'REVERSED'));
+ALTER TABLE transactions ADD CONSTRAINT failure_reason_iff_failed
+    CHECK ((status = 'FAILED') = (failure_reason IS NOT NULL));
+
+ALTER TABLE transactions DROP CONSTRAINT IF EXISTS transactions_source_account_id_fkey;
+ALTER TABLE transactions DROP CONSTRAINT IF EXISTS transactions_destination_account_id_fkey;
+
+ALTER TABLE transactions ALTER COLUMN currency DROP NOT NULL;
+ALTER TABLE transactions ALTER COLUMN destination_amount DROP NOT NULL;
+ALTER TABLE transactions ALTER COLUMN destination_currency DROP NOT NULL;
+ALTER TABLE transactions DROP CONSTRAINT IF EXISTS fx_fields_consistent;
+ALTER TABLE transactions ADD CONSTRAINT fx_fields_consistent CHECK (
+    status = 'FAILED'
+    OR (currency = destination_currency AND destination_amount = amount AND fx_rate IS NULL)
+    OR (currency != destination_currency AND fx_rate IS NOT NULL AND fx_rounding_adjustment IS NOT NULL)
+);
+ALTER TABLE transactions ADD CONSTRAINT currencies_known_unless_failed CHECK (
+    status = 'FAILED'
+    OR (currency IS NOT NULL AND destination_amount IS NOT NULL AND destination_currency IS NOT NULL)
+);
+
+-- A failed attempt must not use up its reference.
+DROP INDEX IF EXISTS idx_transactions_source_reference;
+CREATE UNIQUE INDEX idx_transactions_source_reference
+    ON transactions(source_account_id, reference) WHERE reference IS NOT NULL AND status != 'FAILED';
+
+CREATE INDEX IF NOT EXISTS idx_transactions_status ON transactions(status);
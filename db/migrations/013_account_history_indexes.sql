@@ -0,0 +1,14 @@
+-- Account transaction history
+--
+-- History pages are read newest first from each side of an account and
+-- paginated on (created_at, id). These indexes serve both sides directly and
+-- replace the plain account indexes from 001. FAILED attempts never appear
+-- in history and are left out.
+
+CREATE INDEX IF NOT EXISTS idx_transactions_source_history
+    ON transactions(source_account_id, created_at DESC, id DESC) WHERE status != 'FAILED';
+CREATE INDEX IF NOT EXISTS idx_transactions_destination_history
+    ON transactions(destination_account_id, created_at DESC, id DESC) WHERE status != 'FAILED';
+
+DROP INDEX IF EXISTS idx_transactions_source;
+DROP INDEX IF EXISTS idx_transactions_destination;
@@ -0,0 +1,10 @@
+-- Account listing
+--
+-- Listings are ordered by one of these keys and then id, and paginated on
+-- that pair; each index serves both directions. The pattern_ops index lets
+-- id prefix searches (id LIKE 'abc%') use an index whatever the collation.
+
+CREATE INDEX IF NOT EXISTS idx_accounts_created_at_id ON accounts(created_at, id);
+CREATE INDEX IF NOT EXISTS idx_accounts_updated_at_id ON accounts(updated_at, id);
+CREATE INDEX IF NOT EXISTS idx_accounts_balance_id ON accounts(balance, id);
+CREATE INDEX IF NOT EXISTS idx_accounts_id_prefix ON accounts(id varchar_pattern_ops);
@@ -0,0 +1,14 @@
+-- Audit log queries
+--
+-- Audit logs are read newest first and paginated on (created_at, id), either
+-- for one entity, one action or everything in a time range.
+
+CREATE INDEX IF NOT EXISTS idx_audit_logs_entity_created_at
+    ON audit_logs(entity_type, entity_id, created_at DESC, id DESC);
+CREATE INDEX IF NOT EXISTS idx_audit_logs_action_created_at
+    ON audit_logs(action, created_at DESC, id DESC);
+CREATE INDEX IF NOT EXISTS idx_audit_logs_created_at_id
+    ON audit_logs(created_at DESC, id DESC);
+
+DROP INDEX IF EXISTS idx_audit_logs_entity;
+DROP INDEX IF EXISTS idx_audit_logs_created_at;
@@ -0,0 +1,47 @@
+-- Typed audit events
+--
+-- Every audit entry now names its event (e.g. 'account.debited') and the
+-- version of that event's payload schema. The event fixes the entity type
+-- and action, which older code wrote in mixed case ('account', 'debit',
+-- 'transfer', ...); those rows are normalised here so that queries by entity
+-- or action see the whole history. Existing payloads are schema version 1.
+
+ALTER TABLE audit_logs ADD COLUMN IF NOT EXISTS event VARCHAR(64);
+ALTER TABLE audit_logs ADD COLUMN IF NOT EXISTS schema_version INTEGER NOT NULL DEFAULT 1;
+
+UPDATE audit_logs SET entity_type = UPPER(entity_type), action = UPPER(action)
+    WHERE entity_type != UPPER(entity_type) OR action != UPPER(action);
+
+UPDATE audit_logs SET event = CASE
+    WHEN entity_type = 'ACCOUNT' AND action = 'CREATE' THEN 'account.created'
+    WHEN entity_type = 'ACCOUNT' AND action = 'DEBIT' THEN 'account.debited'
+    WHEN entity_type = 'ACCOUNT' AND action = 'CREDIT' THEN 'account.credited'
+    WHEN entity_type = 'ACCOUNT' AND action = 'UPDATE' AND new_value ? 'overdraft_limit' THEN 'account.overdraft_limit_changed'
+    WHEN entity_type = 'ACCOUNT' AND action = 'UPDATE' AND new_value ? 'status' THEN 'account.status_changed'
+    WHEN entity_type = 'TRANSACTION' AND action = 'TRANSFER' THEN 'transaction.posted'
+    WHEN entity_type = 'TRANSACTION' AND action = 'REVERSE' THEN 'transaction.reversal_posted'
+    WHEN entity_type = 'TRANSACTION' AND action = 'UPDATE' THEN 'transaction.reversed'
+    WHEN entity_type = 'TRANSACTION' AND action = 'FAIL' THEN 'transaction.failed'
+    WHEN entity_type = 'FX_RATE' AND action = 'CREATE' THEN 'fx_rate.created'
+    WHEN entity_type = 'HOLD' AND action = 'CREATE' THEN 'hold.created'
+    WHEN entity_type = 'HOLD' AND action = 'CAPTURE' THEN 'hold.captured'
+    WHEN entity_type = 'HOLD' AND action = 'VOID' THEN 'hold.voided'
+    WHEN entity_type = 'HOLD' AND action = 'EXPIRE' THEN 'hold.expired'
+END
+WHERE event IS NULL;
+
+-- Fails if any row could not be classified; such rows need a look by hand
+ALTER TABLE audit_logs ALTER COLUMN event SET NOT NULL;
+ALTER TABLE audit_logs ALTER COLUMN schema_version DROP DEFAULT;
+
+ALTER TABLE audit_logs ADD CONSTRAINT audit_event_valid CHECK (event IN (
+    'account.created', 'account.debited', 'account.credited',
+    'account.overdraft_limit_changed', 'account.status_changed',
+    'transaction.posted', 'transaction.reversal_posted', 'transaction.reversed', 'transaction.failed',
+    'fx_rate.created',
+    'hold.created', 'hold.captured', 'hold.voided', 'hold.expired'
+));
+ALTER TABLE audit_logs ADD CONSTRAINT audit_schema_version_positive CHECK (schema_version > 0);
+
+CREATE INDEX IF NOT EXISTS idx_audit_logs_event_created_at
+    ON audit_logs(event, created_at DESC, id DESC);
@@ -0,0 +1,32 @@
+-- Tamper-evident audit log
+--
+-- Each new audit entry gets the next sequence number and stores the hash of
+-- its canonical content together with the previous entry's hash, so editing,
+-- reordering or deleting an entry breaks every later link. The single row
+-- of audit_chain_head holds the last sequence number and hash; writers lock
+-- it for the rest of their transaction, which serialises appends.
+--
+-- Entries written before this migration have no sequence and are not part
+-- of the chain.
+
+ALTER TABLE audit_logs ADD COLUMN IF NOT EXISTS sequence BIGINT;
+ALTER TABLE audit_logs ADD COLUMN IF NOT EXISTS prev_hash CHAR(64);
+ALTER TABLE audit_logs ADD COLUMN IF NOT EXISTS hash CHAR(64);
+
+ALTER TABLE audit_logs ADD CONSTRAINT audit_chain_fields_consistent CHECK (
+    (sequence IS NULL AND prev_hash IS NULL AND hash IS NULL)
+    OR (sequence > 0 AND prev_hash IS NOT NULL AND hash IS NOT NULL)
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_audit_logs_sequence ON audit_logs(sequence) WHERE sequence IS NOT NULL;
+
+CREATE TABLE IF NOT EXISTS audit_chain_head (
+    id BOOLEAN PRIMARY KEY DEFAULT TRUE,
+    sequence BIGINT NOT NULL,
+    hash CHAR(64) NOT NULL,
+    CONSTRAINT audit_chain_head_single_row CHECK (id)
+);
+
+INSERT INTO audit_chain_head (id, sequence, hash)
+VALUES (TRUE, 0, '0000000000000000000000000000000000000000000000000000000000000000')
+ON CONFLICT (id) DO NOTHING;
@@ -0,0 +1,20 @@
+-- Audit actor attribution
+--
+-- Every audit entry records who made the change and from where: the
+-- authenticated principal, the client's IP address and user agent, the
+-- request ID and an optional reason given by the caller. Entries written
+-- before this migration have none of them. Investigations look up
+-- everything one principal, address or request did, newest first.
+
+ALTER TABLE audit_logs ADD COLUMN IF NOT EXISTS principal VARCHAR(255);
+ALTER TABLE audit_logs ADD COLUMN IF NOT EXISTS client_ip VARCHAR(45);
+ALTER TABLE audit_logs ADD COLUMN IF NOT EXISTS user_agent VARCHAR(512);
+ALTER TABLE audit_logs ADD COLUMN IF NOT EXISTS request_id VARCHAR(128);
+ALTER TABLE audit_logs ADD COLUMN IF NOT EXISTS reason VARCHAR(1000);
+
+CREATE INDEX IF NOT EXISTS idx_audit_logs_principal_created_at
+    ON audit_logs(principal, created_at DESC, id DESC) WHERE principal IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_audit_logs_client_ip_created_at
+    ON audit_logs(client_ip, created_at DESC, id DESC) WHERE client_ip IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_audit_logs_request_id
+    ON audit_logs(request_id) WHERE request_id IS NOT NULL;
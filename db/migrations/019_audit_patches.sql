@@ -0,0 +1,14 @@
+-- Audit patches
+--
+-- Audit entries store the RFC 6902 JSON Patch from old_value to new_value
+-- alongside the two snapshots, so reviewers can see what changed and an
+-- entity's state can be rebuilt by replaying its patches. The patch is
+-- derived from the snapshots, so it is not covered by the entry's hash;
+-- chain verification recomputes it instead. Entries written before this
+-- migration have none and get one computed when read.
+
+ALTER TABLE audit_logs ADD COLUMN IF NOT EXISTS patch JSONB;
+
+-- Rebuilding an entity's state reads its entries in chain order
+CREATE INDEX IF NOT EXISTS idx_audit_logs_entity_sequence
+    ON audit_logs(entity_type, entity_id, sequence);
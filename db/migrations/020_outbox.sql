@@ -0,0 +1,25 @@
+-- Transactional outbox
+--
+-- Domain events are inserted in the same db transaction as the change they
+-- announce, so an event exists exactly when its change was committed. A
+-- relay reads unpublished events in sequence order, hands them to a
+-- publisher and marks them published, retrying failures on its next run.
+-- Delivery is at least once. Changes to one account lock its row, so their
+-- events get increasing sequence numbers in commit order; the relay keeps
+-- that order per account by holding back an account's later events while
+-- an earlier one fails.
+
+CREATE TABLE IF NOT EXISTS outbox_events (
+    sequence BIGSERIAL PRIMARY KEY,
+    id UUID NOT NULL UNIQUE,
+    event_type VARCHAR(64) NOT NULL,
+    account_ids VARCHAR(36)[] NOT NULL,
+    data JSONB NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    published_at TIMESTAMP,
+    attempts INTEGER NOT NULL DEFAULT 0,
+    last_error TEXT
+);
+
+CREATE INDEX IF NOT EXISTS idx_outbox_events_unpublished
+    ON outbox_events(sequence) WHERE published_at IS NULL;
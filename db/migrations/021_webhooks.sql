@@ -0,0 +1,55 @@
+-- Webhooks
+--
+-- Partners subscribe a URL to domain event types. Every event relayed from
+-- the outbox becomes one delivery per matching subscription, which is
+-- POSTed with an HMAC signature and retried with exponential backoff until
+-- the receiver answers 2xx or attempts run out. Each POST is logged with
+-- its response code. An event is delivered at most once per subscription
+-- unless redelivered by hand.
+
+CREATE TABLE IF NOT EXISTS webhook_subscriptions (
+    id UUID PRIMARY KEY,
+    url TEXT NOT NULL,
+    event_types VARCHAR(64)[] NOT NULL DEFAULT '{}',
+    secret VARCHAR(255) NOT NULL,
+    description VARCHAR(255),
+    active BOOLEAN NOT NULL DEFAULT TRUE,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS webhook_deliveries (
+    id UUID PRIMARY KEY,
+    subscription_id UUID NOT NULL REFERENCES webhook_subscriptions(id) ON DELETE CASCADE,
+    event_id UUID NOT NULL,
+    event_type VARCHAR(64) NOT NULL,
+    payload JSONB NOT NULL,
+    status VARCHAR(20) NOT NULL,
+    attempts INTEGER NOT NULL DEFAULT 0,
+    next_attempt_at TIMESTAMP,
+    last_response_code INTEGER,
+    last_error TEXT,
+    delivered_at TIMESTAMP,
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL,
+    CONSTRAINT webhook_delivery_status_valid CHECK (status IN ('PENDING', 'SUCCEEDED', 'FAILED')),
+    CONSTRAINT webhook_delivery_scheduled_iff_pending CHECK ((status = 'PENDING') = (next_attempt_at IS NOT NULL)),
+    CONSTRAINT webhook_delivery_once_per_event UNIQUE (subscription_id, event_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_due
+    ON webhook_deliveries(next_attempt_at) WHERE status = 'PENDING';
+CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_subscription_created_at
+    ON webhook_deliveries(subscription_id, created_at DESC, id DESC);
+CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_created_at
+    ON webhook_deliveries(created_at DESC, id DESC);
+
+CREATE TABLE IF NOT EXISTS webhook_delivery_attempts (
+    delivery_id UUID NOT NULL REFERENCES webhook_deliveries(id) ON DELETE CASCADE,
+    attempt INTEGER NOT NULL,
+    requested_at TIMESTAMP NOT NULL,
+    duration_ms BIGINT NOT NULL,
+    response_code INTEGER,
+    error TEXT,
+    PRIMARY KEY (delivery_id, attempt)
+);
@@ -0,0 +1,9 @@
+-- Held-back outbox events
+--
+-- The relay leaves out of each batch the events that share an account with
+-- an earlier unpublished event that failed, following overlapping
+-- account_ids from event to event. This index keeps that lookup cheap
+-- while a failing event holds many others back.
+
+CREATE INDEX IF NOT EXISTS idx_outbox_events_unpublished_accounts
+    ON outbox_events USING GIN (account_ids) WHERE published_at IS NULL;
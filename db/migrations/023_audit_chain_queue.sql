@@ -0,0 +1,26 @@
+-- Audit chain appended in the background
+--
+-- Writers used to lock audit_chain_head inside the transaction that made
+-- the audited change. Under SERIALIZABLE isolation that made every audited
+-- write conflict with every other, so concurrent transfers on unrelated
+-- accounts aborted and ran out of retries. Entries are now inserted
+-- unchained, numbered by write_order in the order they were written, and a
+-- chainer links them into the hash chain after commit in its own
+-- READ COMMITTED transaction, in write_order order. An entity's changes lock
+-- its row before their entries are written, so one entity's entries are
+-- written, and chained, in commit order.
+--
+-- Entries chained before this migration keep their sequence as their
+-- write_order. Entries written before the chain existed have neither.
+
+ALTER TABLE audit_logs ADD COLUMN IF NOT EXISTS write_order BIGINT;
+
+UPDATE audit_logs SET write_order = sequence WHERE sequence IS NOT NULL AND write_order IS NULL;
+
+CREATE SEQUENCE IF NOT EXISTS audit_logs_write_order_seq OWNED BY audit_logs.write_order;
+SELECT setval('audit_logs_write_order_seq', COALESCE((SELECT MAX(write_order) FROM audit_logs), 0) + 1, false);
+ALTER TABLE audit_logs ALTER COLUMN write_order SET DEFAULT nextval('audit_logs_write_order_seq');
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_audit_logs_write_order ON audit_logs(write_order) WHERE write_order IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_audit_logs_unchained
+    ON audit_logs(write_order) WHERE sequence IS NULL AND write_order IS NOT NULL;
@@ -0,0 +1,9 @@
+-- Webhook delivery leases
+--
+-- A dispatcher claims a delivery before POSTing it by setting leased_until,
+-- and clears it when it records the attempt. Other dispatchers skip the
+-- delivery until then, and it can't be redelivered by hand while in
+-- flight. A dispatcher that dies mid-attempt leaves the lease to run out,
+-- after which the delivery is due again.
+
+ALTER TABLE webhook_deliveries ADD COLUMN IF NOT EXISTS leased_until TIMESTAMP;
@@ -0,0 +1,8 @@
+-- Webhook redelivery retry budget
+--
+-- A manual redelivery gives a delivery a fresh set of retries, whatever its
+-- status. retry_budget_start is its attempt count when the current set
+-- began, so it fails once attempts - retry_budget_start reaches the
+-- maximum. Attempts keep counting up, numbering the attempt log.
+
+ALTER TABLE webhook_deliveries ADD COLUMN IF NOT EXISTS retry_budget_start INTEGER NOT NULL DEFAULT 0;
@@ -0,0 +1,14 @@
+-- Audit entries chained by the transaction that writes them
+--
+-- Migration 023 left entries unchained until a background chainer linked
+-- them after commit, so an entry could be edited or deleted before it was
+-- covered by the chain. Writers chain their entries again, in the same
+-- transaction. Instead of locking a chain-head row, which makes concurrent
+-- SERIALIZABLE writers fail on the row they all update, they take a
+-- transaction-scoped advisory lock right before inserting and link to the
+-- entry with the highest sequence number, so the head row goes.
+--
+-- Entries left unchained by servers running the background chainer are
+-- linked when a server starts. Stop those servers before applying this.
+
+DROP TABLE IF EXISTS audit_chain_head;
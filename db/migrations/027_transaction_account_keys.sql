@@ -0,0 +1,37 @@
+-- Account foreign keys on transactions
+--
+-- Migration 012 dropped the account foreign keys so that FAILED transfers
+-- could name accounts that don't exist. The keys are back, for every row:
+-- a FAILED transfer stores an account ID that doesn't exist in
+-- requested_source_account_id or requested_destination_account_id instead,
+-- leaving the keyed column NULL. Every other transaction names real
+-- accounts in the keyed columns.
+
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS requested_source_account_id VARCHAR(36);
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS requested_destination_account_id VARCHAR(36);
+ALTER TABLE transactions ALTER COLUMN source_account_id DROP NOT NULL;
+ALTER TABLE transactions ALTER COLUMN destination_account_id DROP NOT NULL;
+
+UPDATE transactions t
+SET requested_source_account_id = t.source_account_id, source_account_id = NULL
+WHERE t.status = 'FAILED' AND NOT EXISTS (SELECT 1 FROM accounts a WHERE a.id = t.source_account_id);
+
+UPDATE transactions t
+SET requested_destination_account_id = t.destination_account_id, destination_account_id = NULL
+WHERE t.status = 'FAILED' AND NOT EXISTS (SELECT 1 FROM accounts a WHERE a.id = t.destination_account_id);
+
+ALTER TABLE transactions ADD CONSTRAINT transactions_source_account_id_fkey
+    FOREIGN KEY (source_account_id) REFERENCES accounts(id);
+ALTER TABLE transactions ADD CONSTRAINT transactions_destination_account_id_fkey
+    FOREIGN KEY (destination_account_id) REFERENCES accounts(id);
+
+-- Each side names its account in exactly one column, and only a FAILED
+-- transfer may name an unknown one.
+ALTER TABLE transactions ADD CONSTRAINT source_account_named_once
+    CHECK ((source_account_id IS NULL) != (requested_source_account_id IS NULL));
+ALTER TABLE transactions ADD CONSTRAINT destination_account_named_once
+    CHECK ((destination_account_id IS NULL) != (requested_destination_account_id IS NULL));
+ALTER TABLE transactions ADD CONSTRAINT accounts_known_unless_failed CHECK (
+    status = 'FAILED'
+    OR (requested_source_account_id IS NULL AND requested_destination_account_id IS NULL)
+);
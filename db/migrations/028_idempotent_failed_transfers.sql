@@ -0,0 +1,8 @@
+-- Idempotent failed transfers
+--
+-- A transfer rejected and recorded as FAILED keeps its failure under the
+-- request's Idempotency-Key, in the same transaction as the FAILED record,
+-- so a retry replays the error instead of recording the failure again.
+-- response then holds the failure rather than a response body.
+
+ALTER TABLE idempotency_keys ADD COLUMN IF NOT EXISTS failed BOOLEAN NOT NULL DEFAULT FALSE;
@@ -0,0 +1,10 @@
+-- Idempotency keys scoped to their caller
+--
+-- Keys were scoped to the endpoint only, so two callers that picked the same
+-- key would replay each other's responses. Each key now also belongs to the
+-- authenticated principal that sent it (X-Authenticated-Principal, empty
+-- when none was sent). Existing keys belong to no principal.
+
+ALTER TABLE idempotency_keys ADD COLUMN IF NOT EXISTS principal VARCHAR(255) NOT NULL DEFAULT '';
+ALTER TABLE idempotency_keys DROP CONSTRAINT IF EXISTS idempotency_keys_pkey;
+ALTER TABLE idempotency_keys ADD PRIMARY KEY (principal, scope, key);
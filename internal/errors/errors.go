@@ -12,8 +12,38 @@ var (
 	ErrInsufficentBalance   = errors.New("insufficient balance")
 	ErrInvalidAmount        = errors.New("invalid amount")
 	ErrInvalidAccountID     = errors.New("invalid account ID")
+	ErrInvalidTransactionID = errors.New("invalid transaction ID")
 	ErrSameAccount          = errors.New("source and destination accounts cannot be the same")
 	ErrNegativeBalance      = errors.New("balance cannot be negative")
+	ErrFXRateNotFound       = errors.New("no fx rate available")
+	ErrHoldNotFound         = errors.New("hold not found")
+	ErrHoldNotActive        = errors.New("hold is not active")
+	ErrHoldAmountExceeded   = errors.New("capture amount exceeds held amount")
+	ErrInvalidStatusChange  = errors.New("account status transition not allowed")
+	ErrAccountNotEmpty      = errors.New("account still has a balance or active holds")
+	ErrTransactionNotFound  = errors.New("transaction not found")
+	ErrAlreadyReversed      = errors.New("transaction already fully reversed")
+	ErrReversalExceeded     = errors.New("reversal amount exceeds the unreversed amount")
+	ErrIdempotencyKeyReused = errors.New("idempotency key was used with a different request")
+	ErrIdempotencyKeyInUse  = errors.New("idempotency key is being used by a concurrent request")
+	ErrConcurrentUpdate     = errors.New("conflicting concurrent update, retry later")
+	ErrVersionMismatch      = errors.New("account has changed since the given version")
+	ErrDuplicateReference   = errors.New("reference already used for this source account")
+	ErrTransactionNotPosted = errors.New("transaction is not posted")
+
+	ErrInvalidTransactionStatusChange = errors.New("transaction status transition not allowed")
+
+	ErrUnbalancedJournalEntry = errors.New("journal entry does not balance")
+	ErrInvalidAuditLog        = errors.New("audit log does not match its event schema")
+	ErrAuditLogNotFound       = errors.New("audit log not found")
+	ErrInvalidAuditLogID      = errors.New("invalid audit log ID")
+
+	ErrWebhookNotFound          = errors.New("webhook not found")
+	ErrInvalidWebhookID         = errors.New("invalid webhook ID")
+	ErrWebhookDeliveryNotFound  = errors.New("webhook delivery not found")
+	ErrInvalidWebhookDeliveryID = errors.New("invalid webhook delivery ID")
+	ErrWebhookDeliveryInFlight  = errors.New("webhook delivery is being attempted")
+	ErrWebhookDeliveryLeaseLost = errors.New("webhook delivery lease ran out before the attempt was recorded")
 )
 
 type ValidationError struct {
@@ -52,6 +82,76 @@ func NewTransactionError(operation string, cause error) error {
 	}
 }
 
+// CurrencyMismatchError is returned when a transfer between accounts held in
+// different currencies cannot be carried out. Cause explains why, e.g.
+// ErrFXRateNotFound when no rate covers the currency pair.
+type CurrencyMismatchError struct {
+	SourceCurrency      string
+	DestinationCurrency string
+	Cause               error
+}
+
+func (e *CurrencyMismatchError) Error() string {
+	return fmt.Sprintf("cannot transfer from %s to %s: %v", e.SourceCurrency, e.DestinationCurrency, e.Cause)
+}
+
+func (e *CurrencyMismatchError) Unwrap() error {
+	return e.Cause
+}
+
+func NewCurrencyMismatchError(sourceCurrency, destinationCurrency string, cause error) error {
+	return &CurrencyMismatchError{
+		SourceCurrency:      sourceCurrency,
+		DestinationCurrency: destinationCurrency,
+		Cause:               cause,
+	}
+}
+
+// AccountStatusError is returned when an account's status does not allow
+// money to move in the requested Direction ("debit" or "credit").
+type AccountStatusError struct {
+	AccountID string
+	Status    string
+	Direction string
+}
+
+func (e *AccountStatusError) Error() string {
+	return fmt.Sprintf("account %s is %s and cannot be %sed", e.AccountID, e.Status, e.Direction)
+}
+
+func NewAccountStatusError(accountID, status, direction string) error {
+	return &AccountStatusError{
+		AccountID: accountID,
+		Status:    status,
+		Direction: direction,
+	}
+}
+
+// TransferFailedError is returned when a transfer was rejected and recorded
+// as a FAILED transaction. Cause is the original error, so checks such as
+// IsInsufficientBalance still see through it.
+type TransferFailedError struct {
+	TransactionID string
+	Reason        string
+	Cause         error
+}
+
+func (e *TransferFailedError) Error() string {
+	return fmt.Sprintf("transfer %s failed (%s): %v", e.TransactionID, e.Reason, e.Cause)
+}
+
+func (e *TransferFailedError) Unwrap() error {
+	return e.Cause
+}
+
+func NewTransferFailedError(transactionID, reason string, cause error) error {
+	return &TransferFailedError{
+		TransactionID: transactionID,
+		Reason:        reason,
+		Cause:         cause,
+	}
+}
+
 func IsNotFound(err error) bool {
 	return errors.Is(err, ErrAccountNotFound)
 }
@@ -65,6 +165,78 @@ func IsValidationError(err error) bool {
 	return errors.As(err, &validationErr)
 }
 
+// ValidationErrorField returns the field of the ValidationError in err's
+// chain, or "" if there is none.
+func ValidationErrorField(err error) string {
+	var validationErr *ValidationError
+	if errors.As(err, &validationErr) {
+		return validationErr.Field
+	}
+	return ""
+}
+
 func IsAlreadyExists(err error) bool {
 	return errors.Is(err, ErrAccountAlreadyExists)
 }
+
+func IsCurrencyMismatch(err error) bool {
+	var mismatchErr *CurrencyMismatchError
+	return errors.As(err, &mismatchErr)
+}
+
+func IsFXRateNotFound(err error) bool {
+	return errors.Is(err, ErrFXRateNotFound)
+}
+
+func IsHoldNotFound(err error) bool {
+	return errors.Is(err, ErrHoldNotFound)
+}
+
+func IsHoldNotActive(err error) bool {
+	return errors.Is(err, ErrHoldNotActive)
+}
+
+func IsAccountStatusError(err error) bool {
+	var statusErr *AccountStatusError
+	return errors.As(err, &statusErr)
+}
+
+func IsInvalidStatusChange(err error) bool {
+	return errors.Is(err, ErrInvalidStatusChange)
+}
+
+func IsTransactionNotFound(err error) bool {
+	return errors.Is(err, ErrTransactionNotFound)
+}
+
+func IsConcurrentUpdate(err error) bool {
+	return errors.Is(err, ErrConcurrentUpdate)
+}
+
+func IsVersionMismatch(err error) bool {
+	return errors.Is(err, ErrVersionMismatch)
+}
+
+func IsDuplicateReference(err error) bool {
+	return errors.Is(err, ErrDuplicateReference)
+}
+
+// FailedTransactionID returns the id of the FAILED transaction recorded for
+// err, or "" if none was.
+func FailedTransactionID(err error) string {
+	var failedErr *TransferFailedError
+	if errors.As(err, &failedErr) {
+		return failedErr.TransactionID
+	}
+	return ""
+}
+
+// FailedTransferReason returns the reason code of the FAILED transaction
+// recorded for err, or "" if none was.
+func FailedTransferReason(err error) string {
+	var failedErr *TransferFailedError
+	if errors.As(err, &failedErr) {
+		return failedErr.Reason
+	}
+	return ""
+}
@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"log/slog"
 	"net/http"
+	"net/url"
 
 	"github.com/gorilla/mux"
 
@@ -14,20 +15,26 @@ import (
 )
 
 type AccountHandler struct {
-	accountService service.AccountService
-	logger         *slog.Logger
+	accountService     service.AccountService
+	idempotencyService service.IdempotencyService
+	logger             *slog.Logger
 }
 
-func NewAccountHandler(accountService service.AccountService, logger *slog.Logger) *AccountHandler {
+func NewAccountHandler(accountService service.AccountService, idempotencyService service.IdempotencyService, logger *slog.Logger) *AccountHandler {
 	return &AccountHandler{
-		accountService: accountService,
-		logger:         logger,
+		accountService:     accountService,
+		idempotencyService: idempotencyService,
+		logger:             logger,
 	}
 }
 
 func (h *AccountHandler) RegisterRoutes(router *mux.Router) {
 	router.HandleFunc("/accounts", h.CreateAccount).Methods(http.MethodPost)
+	router.HandleFunc("/accounts", h.ListAccounts).Methods(http.MethodGet)
+	router.HandleFunc("/accounts:batchGet", h.BatchGetAccounts).Methods(http.MethodPost)
 	router.HandleFunc("/accounts/{id}", h.GetAccount).Methods(http.MethodGet)
+	router.HandleFunc("/admin/accounts/{id}/overdraft-limit", h.SetOverdraftLimit).Methods(http.MethodPut)
+	router.HandleFunc("/admin/accounts/{id}/status", h.SetStatus).Methods(http.MethodPut)
 }
 
 func (h *AccountHandler) CreateAccount(w http.ResponseWriter, r *http.Request) {
@@ -38,16 +45,21 @@ func (h *AccountHandler) CreateAccount(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	account, err := h.accountService.CreateAccount(r.Context(), &req)
+	ctx, done := checkIdempotency(w, r, h.idempotencyService, h.logger, &req, http.StatusCreated)
+	if done {
+		return
+	}
+
+	account, err := h.accountService.CreateAccount(ctx, &req)
 	if err != nil {
+		if replayConcurrent(ctx, w, h.idempotencyService, h.logger, err, http.StatusCreated) {
+			return
+		}
 		h.handleServiceError(w, err, "create account")
 		return
 	}
 
-	u.WriteJSON(w, http.StatusCreated, models.AccountResponse{
-		ID:      account.ID,
-		Balance: account.Balance,
-	})
+	writeAccount(w, http.StatusCreated, account)
 }
 
 func (h *AccountHandler) GetAccount(w http.ResponseWriter, r *http.Request) {
@@ -65,16 +77,140 @@ func (h *AccountHandler) GetAccount(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	u.WriteJSON(w, http.StatusOK, models.AccountResponse{
-		ID:      account.ID,
-		Balance: account.Balance,
-	})
+	etag := accountETag(account)
+	if !noneMatch(r.Header.Get("If-None-Match"), etag) {
+		w.Header().Set("ETag", etag)
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	writeAccount(w, http.StatusOK, account)
+}
+
+func (h *AccountHandler) ListAccounts(w http.ResponseWriter, r *http.Request) {
+	filter, err := parseAccountListFilter(r.URL.Query())
+	if err != nil {
+		h.handleServiceError(w, err, "list accounts")
+		return
+	}
+
+	response, err := h.accountService.ListAccounts(r.Context(), filter)
+	if err != nil {
+		h.handleServiceError(w, err, "list accounts")
+		return
+	}
+
+	u.WriteJSON(w, http.StatusOK, response)
+}
+
+func (h *AccountHandler) BatchGetAccounts(w http.ResponseWriter, r *http.Request) {
+	var req models.BatchGetAccountsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.logger.Warn("invalid batch get accounts request", "error", err.Error())
+		u.WriteError(w, http.StatusBadRequest, "invalid request payload", err.Error())
+		return
+	}
+
+	response, err := h.accountService.BatchGetAccounts(r.Context(), &req)
+	if err != nil {
+		h.handleServiceError(w, err, "batch get accounts")
+		return
+	}
+
+	u.WriteJSON(w, http.StatusOK, response)
+}
+
+// parseAccountListFilter reads the listing query. order is "asc" or "desc"
+// and defaults to "desc", newest or largest first.
+func parseAccountListFilter(query url.Values) (models.AccountListFilter, error) {
+	filter := models.AccountListFilter{
+		IDPrefix: query.Get("id_prefix"),
+		SortBy:   query.Get("sort"),
+	}
+	switch query.Get("order") {
+	case "", "desc":
+		filter.Descending = true
+	case "asc":
+	default:
+		return filter, errors.NewValidationError("order", "must be asc or desc")
+	}
+
+	var err error
+	if filter.MinBalance, err = queryAmount(query, "min_balance"); err != nil {
+		return filter, err
+	}
+	if filter.MaxBalance, err = queryAmount(query, "max_balance"); err != nil {
+		return filter, err
+	}
+	if filter.CreatedFrom, err = queryTime(query, "created_from"); err != nil {
+		return filter, err
+	}
+	if filter.CreatedTo, err = queryTime(query, "created_to"); err != nil {
+		return filter, err
+	}
+	if filter.After, err = queryCursor(query, "cursor"); err != nil {
+		return filter, err
+	}
+	if filter.Limit, err = queryInt(query, "limit"); err != nil {
+		return filter, err
+	}
+	return filter, nil
+}
+
+func (h *AccountHandler) SetOverdraftLimit(w http.ResponseWriter, r *http.Request) {
+	var req models.SetOverdraftLimitRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.logger.Warn("invalid set overdraft limit request", "error", err.Error())
+		u.WriteError(w, http.StatusBadRequest, "invalid request payload", err.Error())
+		return
+	}
+
+	expectedETag, err := parseIfMatch(r.Header.Get("If-Match"))
+	if err != nil {
+		h.handleServiceError(w, err, "set overdraft limit")
+		return
+	}
+	req.ExpectedETag = expectedETag
+
+	account, err := h.accountService.SetOverdraftLimit(r.Context(), mux.Vars(r)["id"], &req)
+	if err != nil {
+		h.handleServiceError(w, err, "set overdraft limit")
+		return
+	}
+
+	writeAccount(w, http.StatusOK, account)
+}
+
+func (h *AccountHandler) SetStatus(w http.ResponseWriter, r *http.Request) {
+	var req models.SetAccountStatusRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.logger.Warn("invalid set account status request", "error", err.Error())
+		u.WriteError(w, http.StatusBadRequest, "invalid request payload", err.Error())
+		return
+	}
+
+	expectedETag, err := parseIfMatch(r.Header.Get("If-Match"))
+	if err != nil {
+		h.handleServiceError(w, err, "set account status")
+		return
+	}
+	req.ExpectedETag = expectedETag
+
+	account, err := h.accountService.SetStatus(r.Context(), mux.Vars(r)["id"], &req)
+	if err != nil {
+		h.handleServiceError(w, err, "set account status")
+		return
+	}
+
+	writeAccount(w, http.StatusOK, account)
 }
 
 func (h *AccountHandler) handleServiceError(w http.ResponseWriter, err error, operation string) {
 	switch {
 	case errors.IsNotFound(err):
 		u.WriteError(w, http.StatusNotFound, "account not found", "")
+	case err == errors.ErrIdempotencyKeyInUse:
+		u.WriteError(w, http.StatusConflict, "idempotency key in use", err.Error())
 	case errors.IsAlreadyExists(err):
 		u.WriteError(w, http.StatusConflict, "account already exists", "")
 	case errors.IsValidationError(err):
@@ -83,6 +219,12 @@ func (h *AccountHandler) handleServiceError(w http.ResponseWriter, err error, op
 		u.WriteError(w, http.StatusBadRequest, "invalid account ID", "")
 	case err == errors.ErrNegativeBalance:
 		u.WriteError(w, http.StatusBadRequest, "negative balance not allowed", "")
+	case errors.IsVersionMismatch(err):
+		u.WriteError(w, http.StatusPreconditionFailed, "account version mismatch", err.Error())
+	case errors.IsInvalidStatusChange(err):
+		u.WriteError(w, http.StatusConflict, "account status transition not allowed", err.Error())
+	case err == errors.ErrAccountNotEmpty:
+		u.WriteError(w, http.StatusConflict, "account cannot be closed", err.Error())
 	default:
 		h.logger.Error("internal server error during "+operation, "error", err.Error())
 		u.WriteError(w, http.StatusInternalServerError, "internal server error", "")
@@ -0,0 +1,127 @@
+package handler
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+
+	"github.com/riteshkumar/internal-transfers/internal/models"
+	u "github.com/riteshkumar/internal-transfers/internal/utils"
+)
+
+const (
+	// principalHeader carries the caller authenticated by the gateway in
+	// front of the service, which must strip it from incoming requests.
+	principalHeader    = "X-Authenticated-Principal"
+	requestIDHeader    = "X-Request-ID"
+	auditReasonHeader  = "X-Audit-Reason"
+	forwardedForHeader = "X-Forwarded-For"
+)
+
+// ActorMiddleware attributes the audit entries written while serving a
+// request to its caller. It reads the principal, client address, user agent
+// and reason from the request, and takes the request ID from X-Request-ID
+// or generates one. The request ID is echoed back on the response.
+// X-Forwarded-For is only read from the proxies in trustedProxies.
+func ActorMiddleware(trustedProxies []netip.Prefix) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			actor := &models.AuditActor{
+				Principal: r.Header.Get(principalHeader),
+				ClientIP:  clientIP(r, trustedProxies),
+				UserAgent: r.UserAgent(),
+				RequestID: r.Header.Get(requestIDHeader),
+				Reason:    strings.TrimSpace(r.Header.Get(auditReasonHeader)),
+			}
+			if actor.RequestID == "" || len(actor.RequestID) > models.MaxAuditRequestIDLength {
+				actor.RequestID = uuid.New().String()
+			}
+			w.Header().Set(requestIDHeader, actor.RequestID)
+
+			if len(actor.Principal) > models.MaxAuditPrincipalLength {
+				u.WriteError(w, http.StatusBadRequest, "invalid "+principalHeader,
+					fmt.Sprintf("must be at most %d characters", models.MaxAuditPrincipalLength))
+				return
+			}
+			if len(actor.Reason) > models.MaxAuditReasonLength {
+				u.WriteError(w, http.StatusBadRequest, "invalid "+auditReasonHeader,
+					fmt.Sprintf("must be at most %d characters", models.MaxAuditReasonLength))
+				return
+			}
+			if utf8.RuneCountInString(actor.UserAgent) > models.MaxAuditUserAgentLength {
+				actor.UserAgent = string([]rune(actor.UserAgent)[:models.MaxAuditUserAgentLength])
+			}
+
+			next.ServeHTTP(w, r.WithContext(models.WithAuditActor(r.Context(), actor)))
+		})
+	}
+}
+
+// clientIP returns the address of the client that sent r. When the
+// connection comes from a trusted proxy, X-Forwarded-For is walked from the
+// end, past any further trusted proxies, to the first address the proxies
+// did not add themselves; entries before it are supplied by the client and
+// can't be trusted.
+func clientIP(r *http.Request, trustedProxies []netip.Prefix) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return ""
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return host
+	}
+	addr = addr.Unmap()
+
+	hops := strings.Split(strings.Join(r.Header.Values(forwardedForHeader), ","), ",")
+	for i := len(hops) - 1; i >= 0 && isTrustedProxy(addr, trustedProxies); i-- {
+		hop, err := netip.ParseAddr(strings.TrimSpace(hops[i]))
+		if err != nil {
+			break
+		}
+		addr = hop.Unmap()
+	}
+	return addr.String()
+}
+
+func isTrustedProxy(addr netip.Addr, trustedProxies []netip.Prefix) bool {
+	for _, prefix := range trustedProxies {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseTrustedProxies parses a comma-separated list of proxy addresses and
+// CIDR ranges, e.g. "10.0.0.0/8, 192.168.1.10".
+func ParseTrustedProxies(list string) ([]netip.Prefix, error) {
+	var prefixes []netip.Prefix
+	for _, entry := range strings.Split(list, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if strings.Contains(entry, "/") {
+			prefix, err := netip.ParsePrefix(entry)
+			if err != nil {
+				return nil, err
+			}
+			prefixes = append(prefixes, prefix.Masked())
+			continue
+		}
+		addr, err := netip.ParseAddr(entry)
+		if err != nil {
+			return nil, err
+		}
+		addr = addr.Unmap()
+		prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+	}
+	return prefixes, nil
+}
@@ -0,0 +1,139 @@
+package handler
+
+import (
+	"log/slog"
+	"net/http"
+	"net/url"
+
+	"github.com/gorilla/mux"
+
+	"github.com/riteshkumar/internal-transfers/internal/errors"
+	"github.com/riteshkumar/internal-transfers/internal/models"
+	"github.com/riteshkumar/internal-transfers/internal/service"
+	u "github.com/riteshkumar/internal-transfers/internal/utils"
+)
+
+type AuditHandler struct {
+	auditService service.AuditService
+	logger       *slog.Logger
+}
+
+func NewAuditHandler(auditService service.AuditService, logger *slog.Logger) *AuditHandler {
+	return &AuditHandler{
+		auditService: auditService,
+		logger:       logger,
+	}
+}
+
+func (h *AuditHandler) RegisterRoutes(router *mux.Router) {
+	router.HandleFunc("/audit-logs", h.ListAuditLogs).Methods(http.MethodGet)
+	router.HandleFunc("/audit-logs/{id}/state", h.GetEntityState).Methods(http.MethodGet)
+	router.HandleFunc("/admin/audit-logs/verify", h.VerifyChain).Methods(http.MethodGet)
+	router.HandleFunc("/accounts/{id}/audit", h.entityAuditLogs(models.EntityTypeAccount)).Methods(http.MethodGet)
+	router.HandleFunc("/transactions/{id}/audit", h.entityAuditLogs(models.EntityTypeTransaction)).Methods(http.MethodGet)
+}
+
+func (h *AuditHandler) ListAuditLogs(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	filter, err := parseAuditLogFilter(query)
+	if err != nil {
+		h.handleServiceError(w, err, "list audit logs")
+		return
+	}
+	filter.EntityType = query.Get("entity_type")
+	filter.EntityID = query.Get("entity_id")
+
+	h.listAuditLogs(w, r, filter)
+}
+
+// entityAuditLogs serves the audit trail of the entity of entityType named
+// by the {id} path variable.
+func (h *AuditHandler) entityAuditLogs(entityType string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		filter, err := parseAuditLogFilter(r.URL.Query())
+		if err != nil {
+			h.handleServiceError(w, err, "list audit logs")
+			return
+		}
+		filter.EntityType = entityType
+		filter.EntityID = mux.Vars(r)["id"]
+
+		h.listAuditLogs(w, r, filter)
+	}
+}
+
+// GetEntityState serves the state of an audit log's entity as of that log.
+func (h *AuditHandler) GetEntityState(w http.ResponseWriter, r *http.Request) {
+	state, err := h.auditService.GetEntityState(r.Context(), mux.Vars(r)["id"])
+	if err != nil {
+		h.handleServiceError(w, err, "get audit entity state")
+		return
+	}
+
+	u.WriteJSON(w, http.StatusOK, state)
+}
+
+// VerifyChain reports whether the audit hash chain is intact. A broken chain
+// is still a 200; the report says where it breaks.
+func (h *AuditHandler) VerifyChain(w http.ResponseWriter, r *http.Request) {
+	report, err := h.auditService.VerifyChain(r.Context())
+	if err != nil {
+		h.handleServiceError(w, err, "verify audit chain")
+		return
+	}
+
+	u.WriteJSON(w, http.StatusOK, report)
+}
+
+func (h *AuditHandler) listAuditLogs(w http.ResponseWriter, r *http.Request, filter models.AuditLogFilter) {
+	response, err := h.auditService.ListAuditLogs(r.Context(), filter)
+	if err != nil {
+		h.handleServiceError(w, err, "list audit logs")
+		return
+	}
+
+	u.WriteJSON(w, http.StatusOK, response)
+}
+
+// parseAuditLogFilter reads the query parameters shared by all audit log
+// routes.
+func parseAuditLogFilter(query url.Values) (models.AuditLogFilter, error) {
+	filter := models.AuditLogFilter{
+		Event:     models.AuditEvent(query.Get("event")),
+		Action:    query.Get("action"),
+		Principal: query.Get("principal"),
+		ClientIP:  query.Get("client_ip"),
+		RequestID: query.Get("request_id"),
+	}
+	var err error
+	if filter.From, err = queryTime(query, "from"); err != nil {
+		return filter, err
+	}
+	if filter.To, err = queryTime(query, "to"); err != nil {
+		return filter, err
+	}
+	if filter.After, err = queryCursor(query, "cursor"); err != nil {
+		return filter, err
+	}
+	if filter.Limit, err = queryInt(query, "limit"); err != nil {
+		return filter, err
+	}
+	if filter.ChangesOnly, err = queryBool(query, "changes_only"); err != nil {
+		return filter, err
+	}
+	return filter, nil
+}
+
+func (h *AuditHandler) handleServiceError(w http.ResponseWriter, err error, operation string) {
+	switch {
+	case errors.IsValidationError(err):
+		u.WriteError(w, http.StatusBadRequest, "validation error", err.Error())
+	case err == errors.ErrInvalidAuditLogID:
+		u.WriteError(w, http.StatusBadRequest, "invalid audit log ID", "")
+	case err == errors.ErrAuditLogNotFound:
+		u.WriteError(w, http.StatusNotFound, "audit log not found", "")
+	default:
+		h.logger.Error("internal server error during "+operation, "error", err.Error())
+		u.WriteError(w, http.StatusInternalServerError, "internal server error", "")
+	}
+}
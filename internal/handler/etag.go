@@ -0,0 +1,53 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/riteshkumar/internal-transfers/internal/errors"
+	"github.com/riteshkumar/internal-transfers/internal/models"
+	u "github.com/riteshkumar/internal-transfers/internal/utils"
+)
+
+// accountETag is the strong entity tag of account.
+func accountETag(account *models.Account) string {
+	return `"` + account.ETag() + `"`
+}
+
+// writeAccount writes account with its ETag.
+func writeAccount(w http.ResponseWriter, status int, account *models.Account) {
+	w.Header().Set("ETag", accountETag(account))
+	u.WriteJSON(w, status, models.NewAccountResponse(account))
+}
+
+// parseIfMatch returns the account ETag required by an If-Match header,
+// without its quotes, or nil when there is no header or it is "*". Only a
+// single strong ETag is supported.
+func parseIfMatch(header string) (*string, error) {
+	header = strings.TrimSpace(header)
+	if header == "" || header == "*" {
+		return nil, nil
+	}
+
+	unquoted, err := strconv.Unquote(header)
+	if err != nil || !strings.HasPrefix(header, `"`) || unquoted == "" {
+		return nil, errors.NewValidationError("If-Match", "must be a single strong ETag or *")
+	}
+	return &unquoted, nil
+}
+
+// noneMatch reports whether an If-None-Match header lets the request
+// through, i.e. none of its ETags weakly match etag.
+func noneMatch(header, etag string) bool {
+	if header == "" {
+		return true
+	}
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == "*" || candidate == etag {
+			return false
+		}
+	}
+	return true
+}
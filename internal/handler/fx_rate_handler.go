@@ -0,0 +1,85 @@
+package handler
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+
+	"github.com/gorilla/mux"
+
+	"github.com/riteshkumar/internal-transfers/internal/errors"
+	"github.com/riteshkumar/internal-transfers/internal/models"
+	"github.com/riteshkumar/internal-transfers/internal/service"
+	u "github.com/riteshkumar/internal-transfers/internal/utils"
+)
+
+type FXRateHandler struct {
+	fxRateService service.FXRateService
+	logger        *slog.Logger
+}
+
+func NewFXRateHandler(fxRateService service.FXRateService, logger *slog.Logger) *FXRateHandler {
+	return &FXRateHandler{
+		fxRateService: fxRateService,
+		logger:        logger,
+	}
+}
+
+func (h *FXRateHandler) RegisterRoutes(router *mux.Router) {
+	router.HandleFunc("/admin/fx-rates", h.UploadRates).Methods(http.MethodPost)
+	router.HandleFunc("/admin/fx-rates", h.ListRates).Methods(http.MethodGet)
+}
+
+func (h *FXRateHandler) UploadRates(w http.ResponseWriter, r *http.Request) {
+	var req models.UploadFXRatesRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.logger.Warn("invalid upload fx rates request", "error", err.Error())
+		u.WriteError(w, http.StatusBadRequest, "invalid request payload", err.Error())
+		return
+	}
+
+	rates, err := h.fxRateService.UploadRates(r.Context(), &req)
+	if err != nil {
+		h.handleServiceError(w, err, "upload fx rates")
+		return
+	}
+
+	u.WriteJSON(w, http.StatusCreated, toFXRateResponses(rates))
+}
+
+func (h *FXRateHandler) ListRates(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	rates, err := h.fxRateService.ListRates(r.Context(), query.Get("base_currency"), query.Get("quote_currency"))
+	if err != nil {
+		h.handleServiceError(w, err, "list fx rates")
+		return
+	}
+
+	u.WriteJSON(w, http.StatusOK, toFXRateResponses(rates))
+}
+
+func toFXRateResponses(rates []*models.FXRate) []models.FXRateResponse {
+	responses := make([]models.FXRateResponse, 0, len(rates))
+	for _, rate := range rates {
+		responses = append(responses, models.FXRateResponse{
+			ID:            rate.ID,
+			BaseCurrency:  rate.BaseCurrency,
+			QuoteCurrency: rate.QuoteCurrency,
+			Rate:          rate.Rate,
+			ValidFrom:     rate.ValidFrom,
+			ValidTo:       rate.ValidTo,
+		})
+	}
+	return responses
+}
+
+func (h *FXRateHandler) handleServiceError(w http.ResponseWriter, err error, operation string) {
+	switch {
+	case errors.IsValidationError(err):
+		u.WriteError(w, http.StatusBadRequest, "validation error", err.Error())
+	default:
+		h.logger.Error("internal server error during "+operation, "error", err.Error())
+		u.WriteError(w, http.StatusInternalServerError, "internal server error", "")
+	}
+}
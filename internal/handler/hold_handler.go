@@ -0,0 +1,154 @@
+package handler
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+
+	"github.com/gorilla/mux"
+
+	"github.com/riteshkumar/internal-transfers/internal/errors"
+	"github.com/riteshkumar/internal-transfers/internal/models"
+	"github.com/riteshkumar/internal-transfers/internal/service"
+	u "github.com/riteshkumar/internal-transfers/internal/utils"
+)
+
+type HoldHandler struct {
+	holdService service.HoldService
+	logger      *slog.Logger
+}
+
+func NewHoldHandler(holdService service.HoldService, logger *slog.Logger) *HoldHandler {
+	return &HoldHandler{
+		holdService: holdService,
+		logger:      logger,
+	}
+}
+
+func (h *HoldHandler) RegisterRoutes(router *mux.Router) {
+	router.HandleFunc("/holds", h.CreateHold).Methods(http.MethodPost)
+	router.HandleFunc("/holds/{id}", h.GetHold).Methods(http.MethodGet)
+	router.HandleFunc("/holds/{id}/capture", h.CaptureHold).Methods(http.MethodPost)
+	router.HandleFunc("/holds/{id}/void", h.VoidHold).Methods(http.MethodPost)
+}
+
+func (h *HoldHandler) CreateHold(w http.ResponseWriter, r *http.Request) {
+	var req models.CreateHoldRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.logger.Warn("invalid create hold request", "error", err.Error())
+		u.WriteError(w, http.StatusBadRequest, "invalid request payload", err.Error())
+		return
+	}
+
+	expectedETag, err := parseIfMatch(r.Header.Get("If-Match"))
+	if err != nil {
+		h.handleServiceError(w, err, "create hold")
+		return
+	}
+	req.ExpectedETag = expectedETag
+
+	hold, err := h.holdService.Authorize(r.Context(), &req)
+	if err != nil {
+		h.handleServiceError(w, err, "create hold")
+		return
+	}
+
+	u.WriteJSON(w, http.StatusCreated, toHoldResponse(hold))
+}
+
+func (h *HoldHandler) GetHold(w http.ResponseWriter, r *http.Request) {
+	hold, err := h.holdService.GetHold(r.Context(), mux.Vars(r)["id"])
+	if err != nil {
+		h.handleServiceError(w, err, "get hold")
+		return
+	}
+
+	u.WriteJSON(w, http.StatusOK, toHoldResponse(hold))
+}
+
+func (h *HoldHandler) CaptureHold(w http.ResponseWriter, r *http.Request) {
+	var req models.CaptureHoldRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.logger.Warn("invalid capture hold request", "error", err.Error())
+		u.WriteError(w, http.StatusBadRequest, "invalid request payload", err.Error())
+		return
+	}
+
+	expectedETag, err := parseIfMatch(r.Header.Get("If-Match"))
+	if err != nil {
+		h.handleServiceError(w, err, "capture hold")
+		return
+	}
+	req.ExpectedETag = expectedETag
+
+	transaction, err := h.holdService.Capture(r.Context(), mux.Vars(r)["id"], &req)
+	if err != nil {
+		h.handleServiceError(w, err, "capture hold")
+		return
+	}
+
+	u.WriteJSON(w, http.StatusCreated, models.NewTransactionResponse(transaction))
+}
+
+func (h *HoldHandler) VoidHold(w http.ResponseWriter, r *http.Request) {
+	expectedETag, err := parseIfMatch(r.Header.Get("If-Match"))
+	if err != nil {
+		h.handleServiceError(w, err, "void hold")
+		return
+	}
+
+	hold, err := h.holdService.Void(r.Context(), mux.Vars(r)["id"], &models.VoidHoldRequest{ExpectedETag: expectedETag})
+	if err != nil {
+		h.handleServiceError(w, err, "void hold")
+		return
+	}
+
+	u.WriteJSON(w, http.StatusOK, toHoldResponse(hold))
+}
+
+func toHoldResponse(hold *models.Hold) models.HoldResponse {
+	return models.HoldResponse{
+		ID:             hold.ID,
+		AccountID:      hold.AccountID,
+		Amount:         hold.Amount,
+		Currency:       hold.Currency,
+		Status:         hold.Status,
+		CapturedAmount: hold.CapturedAmount,
+		TransactionID:  hold.TransactionID,
+		ExpiresAt:      hold.ExpiresAt,
+		CreatedAt:      hold.CreatedAt,
+	}
+}
+
+func (h *HoldHandler) handleServiceError(w http.ResponseWriter, err error, operation string) {
+	switch {
+	case errors.IsHoldNotFound(err):
+		u.WriteError(w, http.StatusNotFound, "hold not found", "")
+	case errors.IsNotFound(err):
+		u.WriteError(w, http.StatusNotFound, "account not found", err.Error())
+	case errors.IsHoldNotActive(err):
+		u.WriteError(w, http.StatusConflict, "hold is not active", err.Error())
+	case err == errors.ErrHoldAmountExceeded:
+		u.WriteError(w, http.StatusBadRequest, "capture amount exceeds held amount", "")
+	case errors.IsInsufficientBalance(err):
+		u.WriteError(w, http.StatusBadRequest, "insufficient balance", "account does not have enough available funds")
+	case errors.IsAccountStatusError(err):
+		u.WriteError(w, http.StatusConflict, "account not available", err.Error())
+	case errors.IsCurrencyMismatch(err):
+		u.WriteError(w, http.StatusUnprocessableEntity, "currency mismatch", err.Error())
+	case errors.IsVersionMismatch(err):
+		u.WriteError(w, http.StatusPreconditionFailed, "account version mismatch", err.Error())
+	case errors.IsValidationError(err):
+		u.WriteError(w, http.StatusBadRequest, "validation error", err.Error())
+	case err == errors.ErrSameAccount:
+		u.WriteError(w, http.StatusBadRequest, "same source and destination account", err.Error())
+	case err == errors.ErrInvalidAmount:
+		u.WriteError(w, http.StatusBadRequest, "invalid amount", err.Error())
+	case errors.IsConcurrentUpdate(err):
+		w.Header().Set("Retry-After", "1")
+		u.WriteError(w, http.StatusServiceUnavailable, "too many concurrent updates", "retry the request")
+	default:
+		h.logger.Error("internal server error during "+operation, "error", err.Error())
+		u.WriteError(w, http.StatusInternalServerError, "internal server error", "")
+	}
+}
@@ -0,0 +1,85 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+
+	"github.com/riteshkumar/internal-transfers/internal/errors"
+	"github.com/riteshkumar/internal-transfers/internal/models"
+	"github.com/riteshkumar/internal-transfers/internal/service"
+	u "github.com/riteshkumar/internal-transfers/internal/utils"
+)
+
+const (
+	idempotencyKeyHeader     = "Idempotency-Key"
+	idempotentReplayedHeader = "Idempotent-Replayed"
+)
+
+// checkIdempotency handles the Idempotency-Key header of r, whose decoded
+// body is req. Keys are scoped to the caller's principal and the endpoint.
+// If the same request was already completed under the key it replays the
+// stored response with status, or the stored failure of a rejected
+// transfer, and reports done. Otherwise it returns the context to call the
+// service with, carrying the key when one was sent so the service stores its
+// response.
+func checkIdempotency(w http.ResponseWriter, r *http.Request, idempotencyService service.IdempotencyService, logger *slog.Logger, req interface{}, status int) (context.Context, bool) {
+	ctx := r.Context()
+
+	header := r.Header.Get(idempotencyKeyHeader)
+	if header == "" {
+		return ctx, false
+	}
+
+	key, err := service.NewIdempotencyKey(r.Header.Get(principalHeader), r.Method+" "+r.URL.Path, header, req)
+	if err != nil {
+		u.WriteError(w, http.StatusBadRequest, "invalid idempotency key", err.Error())
+		return nil, true
+	}
+
+	if replayIdempotent(ctx, w, idempotencyService, logger, key, status) {
+		return nil, true
+	}
+	return service.WithIdempotencyKey(ctx, key), false
+}
+
+// replayConcurrent handles err from a service called with the context
+// returned by checkIdempotency. When err says a concurrent request with the
+// same key got there first, the key is looked up again and, if that request
+// has completed, its response is replayed. It reports whether it answered.
+func replayConcurrent(ctx context.Context, w http.ResponseWriter, idempotencyService service.IdempotencyService, logger *slog.Logger, err error, status int) bool {
+	key := service.IdempotencyKeyFromContext(ctx)
+	if key == nil || (err != errors.ErrIdempotencyKeyInUse && !errors.IsConcurrentUpdate(err)) {
+		return false
+	}
+	return replayIdempotent(ctx, w, idempotencyService, logger, key, status)
+}
+
+// replayIdempotent answers with the response stored under key, if there is
+// one, and reports whether it answered.
+func replayIdempotent(ctx context.Context, w http.ResponseWriter, idempotencyService service.IdempotencyService, logger *slog.Logger, key *service.IdempotencyKey, status int) bool {
+	record, err := idempotencyService.Lookup(ctx, key)
+	switch {
+	case err == errors.ErrIdempotencyKeyReused:
+		u.WriteError(w, http.StatusUnprocessableEntity, "idempotency key reused", err.Error())
+	case err != nil:
+		logger.Error("internal server error during idempotency lookup", "error", err.Error())
+		u.WriteError(w, http.StatusInternalServerError, "internal server error", "")
+	case record == nil:
+		return false
+	case record.Failed:
+		var failure models.TransferFailure
+		if err := json.Unmarshal(record.Response, &failure); err != nil {
+			logger.Error("internal server error during idempotency replay", "error", err.Error())
+			u.WriteError(w, http.StatusInternalServerError, "internal server error", "")
+			return true
+		}
+		w.Header().Set(idempotentReplayedHeader, "true")
+		writeTransferFailure(w, &failure)
+	default:
+		w.Header().Set(idempotentReplayedHeader, "true")
+		u.WriteJSON(w, status, record.Response)
+	}
+	return true
+}
@@ -0,0 +1,76 @@
+package handler
+
+import (
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/riteshkumar/internal-transfers/internal/errors"
+	"github.com/riteshkumar/internal-transfers/internal/models"
+	"github.com/riteshkumar/internal-transfers/internal/money"
+)
+
+// The query parameter parsers below return nil for an absent parameter and a
+// validation error naming the parameter for a malformed one.
+
+func queryAmount(query url.Values, name string) (*money.Amount, error) {
+	value := query.Get(name)
+	if value == "" {
+		return nil, nil
+	}
+	amount, err := money.Parse(value)
+	if err != nil {
+		return nil, errors.NewValidationError(name, "must be a decimal amount")
+	}
+	return &amount, nil
+}
+
+func queryTime(query url.Values, name string) (*time.Time, error) {
+	value := query.Get(name)
+	if value == "" {
+		return nil, nil
+	}
+	t, err := time.Parse(time.RFC3339Nano, value)
+	if err != nil {
+		return nil, errors.NewValidationError(name, "must be an RFC 3339 timestamp")
+	}
+	return &t, nil
+}
+
+func queryCursor(query url.Values, name string) (*models.Cursor, error) {
+	value := query.Get(name)
+	if value == "" {
+		return nil, nil
+	}
+	cursor, err := models.DecodeCursor(value)
+	if err != nil {
+		return nil, errors.NewValidationError(name, "is malformed")
+	}
+	return cursor, nil
+}
+
+// queryInt returns 0 for an absent parameter.
+func queryInt(query url.Values, name string) (int, error) {
+	value := query.Get(name)
+	if value == "" {
+		return 0, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, errors.NewValidationError(name, "must be an integer")
+	}
+	return n, nil
+}
+
+// queryBool returns false for an absent parameter.
+func queryBool(query url.Values, name string) (bool, error) {
+	value := query.Get(name)
+	if value == "" {
+		return false, nil
+	}
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, errors.NewValidationError(name, "must be true or false")
+	}
+	return b, nil
+}
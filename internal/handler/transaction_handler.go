@@ -2,8 +2,10 @@ package handler
 
 import (
 	"encoding/json"
+	"io"
 	"log/slog"
 	"net/http"
+	"net/url"
 
 	"github.com/gorilla/mux"
 
@@ -15,18 +17,23 @@ import (
 
 type TransactionHandler struct {
 	transactionService service.TransactionService
+	idempotencyService service.IdempotencyService
 	logger             *slog.Logger
 }
 
-func NewTransactionHandler(transactionService service.TransactionService, logger *slog.Logger) *TransactionHandler {
+func NewTransactionHandler(transactionService service.TransactionService, idempotencyService service.IdempotencyService, logger *slog.Logger) *TransactionHandler {
 	return &TransactionHandler{
 		transactionService: transactionService,
+		idempotencyService: idempotencyService,
 		logger:             logger,
 	}
 }
 
 func (h *TransactionHandler) RegisterRoutes(router *mux.Router) {
 	router.HandleFunc("/transactions", h.CreateTransaction).Methods(http.MethodPost)
+	router.HandleFunc("/transactions/{id}", h.GetTransaction).Methods(http.MethodGet)
+	router.HandleFunc("/transactions/{id}/reversal", h.ReverseTransaction).Methods(http.MethodPost)
+	router.HandleFunc("/accounts/{id}/transactions", h.ListAccountTransactions).Methods(http.MethodGet)
 }
 
 func (h *TransactionHandler) CreateTransaction(w http.ResponseWriter, r *http.Request) {
@@ -37,35 +44,177 @@ func (h *TransactionHandler) CreateTransaction(w http.ResponseWriter, r *http.Re
 		return
 	}
 
-	transaction, err := h.transactionService.Transfer(r.Context(), &req)
+	expectedETag, err := parseIfMatch(r.Header.Get("If-Match"))
 	if err != nil {
 		h.handleServiceError(w, err, "create transaction")
 		return
 	}
+	req.ExpectedETag = expectedETag
 
-	u.WriteJSON(w, http.StatusCreated, models.TransactionResponse{
-		ID:                   transaction.ID,
-		SourceAccountID:      transaction.SourceAccountID,
-		DestinationAccountID: transaction.DestinationAccountID,
-		Amount:               transaction.Amount,
-		CreatedAt:            transaction.CreatedAt,
-	})
+	ctx, done := checkIdempotency(w, r, h.idempotencyService, h.logger, &req, http.StatusCreated)
+	if done {
+		return
+	}
+
+	transaction, err := h.transactionService.Transfer(ctx, &req)
+	if err != nil {
+		if replayConcurrent(ctx, w, h.idempotencyService, h.logger, err, http.StatusCreated) {
+			return
+		}
+		h.handleServiceError(w, err, "create transaction")
+		return
+	}
+
+	u.WriteJSON(w, http.StatusCreated, models.NewTransactionResponse(transaction))
+}
+
+func (h *TransactionHandler) GetTransaction(w http.ResponseWriter, r *http.Request) {
+	transaction, err := h.transactionService.GetTransaction(r.Context(), mux.Vars(r)["id"])
+	if err != nil {
+		h.handleServiceError(w, err, "get transaction")
+		return
+	}
+
+	u.WriteJSON(w, http.StatusOK, models.NewTransactionResponse(transaction))
+}
+
+func (h *TransactionHandler) ListAccountTransactions(w http.ResponseWriter, r *http.Request) {
+	filter, err := parseHistoryFilter(r.URL.Query())
+	if err != nil {
+		h.handleServiceError(w, err, "list account transactions")
+		return
+	}
+
+	response, err := h.transactionService.ListAccountTransactions(r.Context(), mux.Vars(r)["id"], filter)
+	if err != nil {
+		h.handleServiceError(w, err, "list account transactions")
+		return
+	}
+
+	u.WriteJSON(w, http.StatusOK, response)
+}
+
+func parseHistoryFilter(query url.Values) (models.TransactionHistoryFilter, error) {
+	filter := models.TransactionHistoryFilter{
+		Direction:             query.Get("direction"),
+		CounterpartyAccountID: query.Get("counterparty"),
+	}
+	var err error
+	if filter.MinAmount, err = queryAmount(query, "min_amount"); err != nil {
+		return filter, err
+	}
+	if filter.MaxAmount, err = queryAmount(query, "max_amount"); err != nil {
+		return filter, err
+	}
+	if filter.From, err = queryTime(query, "from"); err != nil {
+		return filter, err
+	}
+	if filter.To, err = queryTime(query, "to"); err != nil {
+		return filter, err
+	}
+	if filter.After, err = queryCursor(query, "cursor"); err != nil {
+		return filter, err
+	}
+	if filter.Limit, err = queryInt(query, "limit"); err != nil {
+		return filter, err
+	}
+	return filter, nil
+}
+
+func (h *TransactionHandler) ReverseTransaction(w http.ResponseWriter, r *http.Request) {
+	var req models.ReverseTransactionRequest
+	// An empty body reverses the whole remaining amount
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+		h.logger.Warn("invalid reverse transaction request", "error", err.Error())
+		u.WriteError(w, http.StatusBadRequest, "invalid request payload", err.Error())
+		return
+	}
+
+	expectedETag, err := parseIfMatch(r.Header.Get("If-Match"))
+	if err != nil {
+		h.handleServiceError(w, err, "reverse transaction")
+		return
+	}
+	req.ExpectedETag = expectedETag
+
+	reversal, err := h.transactionService.Reverse(r.Context(), mux.Vars(r)["id"], &req)
+	if err != nil {
+		h.handleServiceError(w, err, "reverse transaction")
+		return
+	}
+
+	u.WriteJSON(w, http.StatusCreated, models.NewTransactionResponse(reversal))
 }
 
 func (h *TransactionHandler) handleServiceError(w http.ResponseWriter, err error, action string) {
+	// Rejected transfers are recorded; point the client at the record
+	if id := errors.FailedTransactionID(err); id != "" {
+		writeTransferFailure(w, &models.TransferFailure{
+			TransactionID: id,
+			FailureReason: errors.FailedTransferReason(err),
+			Message:       err.Error(),
+		})
+		return
+	}
+
 	switch {
+	case errors.IsDuplicateReference(err):
+		u.WriteError(w, http.StatusConflict, "duplicate reference", err.Error())
+	case err == errors.ErrIdempotencyKeyInUse:
+		u.WriteError(w, http.StatusConflict, "idempotency key in use", err.Error())
+	case errors.IsTransactionNotFound(err):
+		u.WriteError(w, http.StatusNotFound, "transaction not found", "")
+	case err == errors.ErrAlreadyReversed:
+		u.WriteError(w, http.StatusConflict, "transaction already reversed", err.Error())
+	case err == errors.ErrTransactionNotPosted:
+		u.WriteError(w, http.StatusConflict, "transaction not posted", err.Error())
+	case err == errors.ErrReversalExceeded:
+		u.WriteError(w, http.StatusBadRequest, "reversal amount too large", err.Error())
 	case errors.IsNotFound(err):
 		u.WriteError(w, http.StatusNotFound, "acount not found", err.Error())
 	case errors.IsInsufficientBalance(err):
 		u.WriteError(w, http.StatusBadRequest, "insufficient balance", "source account does not have enough funds for txn")
+	case errors.IsAccountStatusError(err):
+		u.WriteError(w, http.StatusConflict, "account not available", err.Error())
+	case errors.IsCurrencyMismatch(err):
+		u.WriteError(w, http.StatusUnprocessableEntity, "currency mismatch", err.Error())
+	case errors.IsVersionMismatch(err):
+		u.WriteError(w, http.StatusPreconditionFailed, "account version mismatch", err.Error())
 	case errors.IsValidationError(err):
 		u.WriteError(w, http.StatusBadRequest, "validation error", err.Error())
+	case err == errors.ErrInvalidTransactionID:
+		u.WriteError(w, http.StatusBadRequest, "invalid transaction ID", err.Error())
 	case err == errors.ErrSameAccount:
 		u.WriteError(w, http.StatusBadRequest, "same source and destination account", err.Error())
 	case err == errors.ErrInvalidAmount:
 		u.WriteError(w, http.StatusBadRequest, "invalid amount", err.Error())
+	case errors.IsConcurrentUpdate(err):
+		w.Header().Set("Retry-After", "1")
+		u.WriteError(w, http.StatusServiceUnavailable, "too many concurrent updates", "retry the request")
 	default:
 		h.logger.Error("internal server error during "+action, "error", err.Error())
 		u.WriteError(w, http.StatusInternalServerError, "internal server error", "")
 	}
 }
+
+// writeTransferFailure answers with a transfer that was rejected and
+// recorded as FAILED. Replays of the transfer's Idempotency-Key answer the
+// same way.
+func writeTransferFailure(w http.ResponseWriter, failure *models.TransferFailure) {
+	w.Header().Set("X-Transaction-ID", failure.TransactionID)
+
+	switch failure.FailureReason {
+	case models.FailureReasonDuplicateReference:
+		u.WriteError(w, http.StatusConflict, "duplicate reference", failure.Message)
+	case models.FailureReasonAccountNotFound:
+		u.WriteError(w, http.StatusNotFound, "acount not found", failure.Message)
+	case models.FailureReasonInsufficientFunds:
+		u.WriteError(w, http.StatusBadRequest, "insufficient balance", "source account does not have enough funds for txn")
+	case models.FailureReasonAccountNotActive:
+		u.WriteError(w, http.StatusConflict, "account not available", failure.Message)
+	case models.FailureReasonCurrencyMismatch:
+		u.WriteError(w, http.StatusUnprocessableEntity, "currency mismatch", failure.Message)
+	default:
+		u.WriteError(w, http.StatusBadRequest, "validation error", failure.Message)
+	}
+}
@@ -0,0 +1,172 @@
+package handler
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/url"
+
+	"github.com/gorilla/mux"
+
+	"github.com/riteshkumar/internal-transfers/internal/errors"
+	"github.com/riteshkumar/internal-transfers/internal/models"
+	"github.com/riteshkumar/internal-transfers/internal/service"
+	u "github.com/riteshkumar/internal-transfers/internal/utils"
+)
+
+type WebhookHandler struct {
+	webhookService service.WebhookService
+	logger         *slog.Logger
+}
+
+func NewWebhookHandler(webhookService service.WebhookService, logger *slog.Logger) *WebhookHandler {
+	return &WebhookHandler{
+		webhookService: webhookService,
+		logger:         logger,
+	}
+}
+
+func (h *WebhookHandler) RegisterRoutes(router *mux.Router) {
+	router.HandleFunc("/admin/webhooks", h.CreateWebhook).Methods(http.MethodPost)
+	router.HandleFunc("/admin/webhooks", h.ListWebhooks).Methods(http.MethodGet)
+	router.HandleFunc("/admin/webhooks/{id}", h.GetWebhook).Methods(http.MethodGet)
+	router.HandleFunc("/admin/webhooks/{id}", h.UpdateWebhook).Methods(http.MethodPut)
+	router.HandleFunc("/admin/webhooks/{id}", h.DeleteWebhook).Methods(http.MethodDelete)
+	router.HandleFunc("/admin/webhooks/{id}/deliveries", h.ListDeliveries).Methods(http.MethodGet)
+	router.HandleFunc("/admin/webhook-deliveries/{id}", h.GetDelivery).Methods(http.MethodGet)
+	router.HandleFunc("/admin/webhook-deliveries/{id}/redeliver", h.Redeliver).Methods(http.MethodPost)
+}
+
+func (h *WebhookHandler) CreateWebhook(w http.ResponseWriter, r *http.Request) {
+	var req models.CreateWebhookSubscriptionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.logger.Warn("invalid create webhook request", "error", err.Error())
+		u.WriteError(w, http.StatusBadRequest, "invalid request payload", err.Error())
+		return
+	}
+
+	subscription, err := h.webhookService.CreateSubscription(r.Context(), &req)
+	if err != nil {
+		h.handleServiceError(w, err, "create webhook")
+		return
+	}
+
+	u.WriteJSON(w, http.StatusCreated, subscription)
+}
+
+func (h *WebhookHandler) ListWebhooks(w http.ResponseWriter, r *http.Request) {
+	response, err := h.webhookService.ListSubscriptions(r.Context())
+	if err != nil {
+		h.handleServiceError(w, err, "list webhooks")
+		return
+	}
+
+	u.WriteJSON(w, http.StatusOK, response)
+}
+
+func (h *WebhookHandler) GetWebhook(w http.ResponseWriter, r *http.Request) {
+	subscription, err := h.webhookService.GetSubscription(r.Context(), mux.Vars(r)["id"])
+	if err != nil {
+		h.handleServiceError(w, err, "get webhook")
+		return
+	}
+
+	u.WriteJSON(w, http.StatusOK, subscription)
+}
+
+func (h *WebhookHandler) UpdateWebhook(w http.ResponseWriter, r *http.Request) {
+	var req models.UpdateWebhookSubscriptionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.logger.Warn("invalid update webhook request", "error", err.Error())
+		u.WriteError(w, http.StatusBadRequest, "invalid request payload", err.Error())
+		return
+	}
+
+	subscription, err := h.webhookService.UpdateSubscription(r.Context(), mux.Vars(r)["id"], &req)
+	if err != nil {
+		h.handleServiceError(w, err, "update webhook")
+		return
+	}
+
+	u.WriteJSON(w, http.StatusOK, subscription)
+}
+
+func (h *WebhookHandler) DeleteWebhook(w http.ResponseWriter, r *http.Request) {
+	if err := h.webhookService.DeleteSubscription(r.Context(), mux.Vars(r)["id"]); err != nil {
+		h.handleServiceError(w, err, "delete webhook")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *WebhookHandler) ListDeliveries(w http.ResponseWriter, r *http.Request) {
+	filter, err := parseWebhookDeliveryFilter(r.URL.Query())
+	if err != nil {
+		h.handleServiceError(w, err, "list webhook deliveries")
+		return
+	}
+	filter.SubscriptionID = mux.Vars(r)["id"]
+
+	response, err := h.webhookService.ListDeliveries(r.Context(), filter)
+	if err != nil {
+		h.handleServiceError(w, err, "list webhook deliveries")
+		return
+	}
+
+	u.WriteJSON(w, http.StatusOK, response)
+}
+
+func (h *WebhookHandler) GetDelivery(w http.ResponseWriter, r *http.Request) {
+	delivery, err := h.webhookService.GetDelivery(r.Context(), mux.Vars(r)["id"])
+	if err != nil {
+		h.handleServiceError(w, err, "get webhook delivery")
+		return
+	}
+
+	u.WriteJSON(w, http.StatusOK, delivery)
+}
+
+// Redeliver answers 202 as the delivery is only scheduled; its outcome shows
+// in the delivery log.
+func (h *WebhookHandler) Redeliver(w http.ResponseWriter, r *http.Request) {
+	delivery, err := h.webhookService.Redeliver(r.Context(), mux.Vars(r)["id"])
+	if err != nil {
+		h.handleServiceError(w, err, "redeliver webhook delivery")
+		return
+	}
+
+	u.WriteJSON(w, http.StatusAccepted, delivery)
+}
+
+func parseWebhookDeliveryFilter(query url.Values) (models.WebhookDeliveryFilter, error) {
+	filter := models.WebhookDeliveryFilter{Status: query.Get("status")}
+	var err error
+	if filter.After, err = queryCursor(query, "cursor"); err != nil {
+		return filter, err
+	}
+	if filter.Limit, err = queryInt(query, "limit"); err != nil {
+		return filter, err
+	}
+	return filter, nil
+}
+
+func (h *WebhookHandler) handleServiceError(w http.ResponseWriter, err error, operation string) {
+	switch {
+	case errors.IsValidationError(err):
+		u.WriteError(w, http.StatusBadRequest, "validation error", err.Error())
+	case err == errors.ErrInvalidWebhookID:
+		u.WriteError(w, http.StatusBadRequest, "invalid webhook ID", "")
+	case err == errors.ErrInvalidWebhookDeliveryID:
+		u.WriteError(w, http.StatusBadRequest, "invalid webhook delivery ID", "")
+	case err == errors.ErrWebhookNotFound:
+		u.WriteError(w, http.StatusNotFound, "webhook not found", "")
+	case err == errors.ErrWebhookDeliveryNotFound:
+		u.WriteError(w, http.StatusNotFound, "webhook delivery not found", "")
+	case err == errors.ErrWebhookDeliveryInFlight:
+		u.WriteError(w, http.StatusConflict, "webhook delivery is being attempted", "retry once the attempt is recorded")
+	default:
+		h.logger.Error("internal server error during "+operation, "error", err.Error())
+		u.WriteError(w, http.StatusInternalServerError, "internal server error", "")
+	}
+}
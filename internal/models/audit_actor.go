@@ -0,0 +1,37 @@
+package models
+
+import "context"
+
+// AuditActor says who made a change and why. Principal is the authenticated
+// caller, or a "system:" name for background jobs; the other fields describe
+// the HTTP request it came in on. Reason is supplied by the caller and may
+// be empty.
+type AuditActor struct {
+	Principal string `json:"principal,omitempty"`
+	ClientIP  string `json:"client_ip,omitempty"`
+	UserAgent string `json:"user_agent,omitempty"`
+	RequestID string `json:"request_id,omitempty"`
+	Reason    string `json:"reason,omitempty"`
+}
+
+// Limits of the audit_logs actor columns.
+const (
+	MaxAuditPrincipalLength = 255
+	MaxAuditUserAgentLength = 512
+	MaxAuditRequestIDLength = 128
+	MaxAuditReasonLength    = 1000
+)
+
+type auditActorContextKey struct{}
+
+// WithAuditActor returns a context whose audit entries are attributed to
+// actor.
+func WithAuditActor(ctx context.Context, actor *AuditActor) context.Context {
+	return context.WithValue(ctx, auditActorContextKey{}, actor)
+}
+
+// AuditActorFromContext returns the actor set by WithAuditActor, or nil.
+func AuditActorFromContext(ctx context.Context) *AuditActor {
+	actor, _ := ctx.Value(auditActorContextKey{}).(*AuditActor)
+	return actor
+}
@@ -0,0 +1,110 @@
+package models
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+)
+
+// AuditEvent is the kind of change an audit entry records. The set is
+// closed: every audit entry has one of the events below, and its event fixes
+// the entry's entity type, action and payload schema.
+type AuditEvent string
+
+const (
+	AuditEventAccountCreated               AuditEvent = "account.created"
+	AuditEventAccountDebited               AuditEvent = "account.debited"
+	AuditEventAccountCredited              AuditEvent = "account.credited"
+	AuditEventAccountOverdraftLimitChanged AuditEvent = "account.overdraft_limit_changed"
+	AuditEventAccountStatusChanged         AuditEvent = "account.status_changed"
+	AuditEventTransactionPosted            AuditEvent = "transaction.posted"
+	AuditEventTransactionReversalPosted    AuditEvent = "transaction.reversal_posted"
+	AuditEventTransactionReversed          AuditEvent = "transaction.reversed"
+	AuditEventTransactionFailed            AuditEvent = "transaction.failed"
+	AuditEventFXRateCreated                AuditEvent = "fx_rate.created"
+	AuditEventHoldCreated                  AuditEvent = "hold.created"
+	AuditEventHoldCaptured                 AuditEvent = "hold.captured"
+	AuditEventHoldVoided                   AuditEvent = "hold.voided"
+	AuditEventHoldExpired                  AuditEvent = "hold.expired"
+)
+
+// AuditEventSpec describes the entries of one AuditEvent. OldValue and
+// NewValue must decode into the type returned by payload, with no unknown
+// fields; OldValue is present exactly when HasOldValue is set.
+// SchemaVersion is bumped whenever the payload type changes incompatibly, so
+// that readers can tell old entries from new ones.
+type AuditEventSpec struct {
+	EntityType    string
+	Action        string
+	SchemaVersion int
+	HasOldValue   bool
+	payload       func() interface{}
+}
+
+var auditEvents = map[AuditEvent]AuditEventSpec{
+	AuditEventAccountCreated:               {EntityTypeAccount, AuditActionCreate, 1, false, func() interface{} { return &AccountBalanceSnapshot{} }},
+	AuditEventAccountDebited:               {EntityTypeAccount, AuditActionDebit, 1, true, func() interface{} { return &AccountBalanceSnapshot{} }},
+	AuditEventAccountCredited:              {EntityTypeAccount, AuditActionCredit, 1, true, func() interface{} { return &AccountBalanceSnapshot{} }},
+	AuditEventAccountOverdraftLimitChanged: {EntityTypeAccount, AuditActionUpdate, 1, true, func() interface{} { return &AccountOverdraftSnapshot{} }},
+	AuditEventAccountStatusChanged:         {EntityTypeAccount, AuditActionUpdate, 1, true, func() interface{} { return &AccountStatusSnapshot{} }},
+	AuditEventTransactionPosted:            {EntityTypeTransaction, AuditActionTransfer, 1, false, func() interface{} { return &TransactionSnapshot{} }},
+	AuditEventTransactionReversalPosted:    {EntityTypeTransaction, AuditActionReverse, 1, false, func() interface{} { return &TransactionSnapshot{} }},
+	AuditEventTransactionReversed:          {EntityTypeTransaction, AuditActionUpdate, 1, true, func() interface{} { return &TransactionReversalSnapshot{} }},
+	AuditEventTransactionFailed:            {EntityTypeTransaction, AuditActionFail, 1, false, func() interface{} { return &TransactionSnapshot{} }},
+	AuditEventFXRateCreated:                {EntityTypeFXRate, AuditActionCreate, 1, false, func() interface{} { return &FXRate{} }},
+	AuditEventHoldCreated:                  {EntityTypeHold, AuditActionCreate, 1, false, func() interface{} { return &Hold{} }},
+	AuditEventHoldCaptured:                 {EntityTypeHold, AuditActionCapture, 1, true, func() interface{} { return &Hold{} }},
+	AuditEventHoldVoided:                   {EntityTypeHold, AuditActionVoid, 1, true, func() interface{} { return &Hold{} }},
+	AuditEventHoldExpired:                  {EntityTypeHold, AuditActionExpire, 1, true, func() interface{} { return &Hold{} }},
+}
+
+// LookupAuditEvent returns the spec of event, if it is a known event.
+func LookupAuditEvent(event AuditEvent) (AuditEventSpec, bool) {
+	spec, ok := auditEvents[event]
+	return spec, ok
+}
+
+// Validate checks that log's event is known and its payload matches the
+// event's schema, and fills in the entity type, action and schema version
+// the event implies.
+func (log *AuditLog) Validate() error {
+	spec, ok := auditEvents[log.Event]
+	if !ok {
+		return fmt.Errorf("unknown audit event %q", log.Event)
+	}
+	if log.EntityID == "" {
+		return fmt.Errorf("%s: missing entity id", log.Event)
+	}
+	if log.EntityType != "" && log.EntityType != spec.EntityType {
+		return fmt.Errorf("%s: entity type must be %s, not %s", log.Event, spec.EntityType, log.EntityType)
+	}
+	if log.Action != "" && log.Action != spec.Action {
+		return fmt.Errorf("%s: action must be %s, not %s", log.Event, spec.Action, log.Action)
+	}
+
+	if spec.HasOldValue != (log.OldValue != nil) {
+		return fmt.Errorf("%s: old value must be present only for changes", log.Event)
+	}
+	if log.OldValue != nil {
+		if err := decodeAuditPayload(log.OldValue, spec.payload()); err != nil {
+			return fmt.Errorf("%s: old value: %w", log.Event, err)
+		}
+	}
+	if err := decodeAuditPayload(log.NewValue, spec.payload()); err != nil {
+		return fmt.Errorf("%s: new value: %w", log.Event, err)
+	}
+
+	log.EntityType = spec.EntityType
+	log.Action = spec.Action
+	log.SchemaVersion = spec.SchemaVersion
+	return nil
+}
+
+func decodeAuditPayload(data json.RawMessage, payload interface{}) error {
+	if len(data) == 0 {
+		return fmt.Errorf("missing")
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	return decoder.Decode(payload)
+}
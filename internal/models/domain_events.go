@@ -0,0 +1,69 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// DomainEventType is the kind of change a domain event tells downstream
+// systems about.
+type DomainEventType string
+
+const (
+	DomainEventTransferPosted               DomainEventType = "transfer.posted"
+	DomainEventTransferReversed             DomainEventType = "transfer.reversed"
+	DomainEventTransferFailed               DomainEventType = "transfer.failed"
+	DomainEventAccountCreated               DomainEventType = "account.created"
+	DomainEventAccountOverdraftLimitChanged DomainEventType = "account.overdraft_limit_changed"
+	DomainEventAccountFrozen                DomainEventType = "account.frozen"
+	DomainEventAccountUnfrozen              DomainEventType = "account.unfrozen"
+	DomainEventAccountClosed                DomainEventType = "account.closed"
+)
+
+// DomainEventTypes lists every domain event type.
+var DomainEventTypes = []DomainEventType{
+	DomainEventTransferPosted,
+	DomainEventTransferReversed,
+	DomainEventTransferFailed,
+	DomainEventAccountCreated,
+	DomainEventAccountOverdraftLimitChanged,
+	DomainEventAccountFrozen,
+	DomainEventAccountUnfrozen,
+	DomainEventAccountClosed,
+}
+
+// AccountStatusDomainEvent returns the event type announcing a move to
+// status. Every partly or fully frozen status counts as frozen.
+func AccountStatusDomainEvent(status string) DomainEventType {
+	switch status {
+	case AccountStatusActive:
+		return DomainEventAccountUnfrozen
+	case AccountStatusClosed:
+		return DomainEventAccountClosed
+	default:
+		return DomainEventAccountFrozen
+	}
+}
+
+// OutboxEvent is a domain event, stored in the outbox in the same db txn as
+// the change it announces and relayed to publishers after commit. Sequence
+// orders events; AccountIDs are the accounts the event concerns, and events
+// are delivered in order per account. Transfer events carry a
+// TransactionResponse, account events an AccountResponse, and status events
+// an AccountStatusEventData.
+type OutboxEvent struct {
+	Sequence   int64           `json:"sequence"`
+	ID         string          `json:"id"`
+	Type       DomainEventType `json:"type"`
+	AccountIDs []string        `json:"account_ids"`
+	Data       json.RawMessage `json:"data"`
+	CreatedAt  time.Time       `json:"created_at"`
+}
+
+// AccountStatusEventData is the data of account.frozen, account.unfrozen
+// and account.closed events.
+type AccountStatusEventData struct {
+	Account        AccountResponse `json:"account"`
+	PreviousStatus string          `json:"previous_status"`
+	Reason         string          `json:"reason"`
+}
@@ -0,0 +1,297 @@
+package models
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// JSON Patch operations produced by DiffJSON.
+const (
+	JSONPatchAdd     = "add"
+	JSONPatchRemove  = "remove"
+	JSONPatchReplace = "replace"
+)
+
+// JSONPatchOperation is one RFC 6902 operation. Path is a JSON Pointer
+// (RFC 6901); Value is omitted for removals.
+type JSONPatchOperation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+// JSONPatch is an RFC 6902 JSON Patch document.
+type JSONPatch []JSONPatchOperation
+
+// DiffJSON returns the patch that turns oldDoc into newDoc. Objects are
+// compared member by member, in key order; arrays and scalars that differ
+// are replaced whole. An empty or null oldDoc gives a single add of newDoc
+// at the root. Numbers are kept as written.
+func DiffJSON(oldDoc, newDoc json.RawMessage) (JSONPatch, error) {
+	newValue, err := decodeJSONValue(newDoc)
+	if err != nil {
+		return nil, fmt.Errorf("new document: %w", err)
+	}
+	if isJSONNull(oldDoc) {
+		value, err := json.Marshal(newValue)
+		if err != nil {
+			return nil, err
+		}
+		return JSONPatch{{Op: JSONPatchAdd, Path: "", Value: value}}, nil
+	}
+	oldValue, err := decodeJSONValue(oldDoc)
+	if err != nil {
+		return nil, fmt.Errorf("old document: %w", err)
+	}
+
+	patch := JSONPatch{}
+	if err := diffJSONValues(&patch, "", oldValue, newValue); err != nil {
+		return nil, err
+	}
+	return patch, nil
+}
+
+func diffJSONValues(patch *JSONPatch, path string, oldValue, newValue interface{}) error {
+	if reflect.DeepEqual(oldValue, newValue) {
+		return nil
+	}
+
+	oldObject, oldIsObject := oldValue.(map[string]interface{})
+	newObject, newIsObject := newValue.(map[string]interface{})
+	if !oldIsObject || !newIsObject {
+		value, err := json.Marshal(newValue)
+		if err != nil {
+			return err
+		}
+		*patch = append(*patch, JSONPatchOperation{Op: JSONPatchReplace, Path: path, Value: value})
+		return nil
+	}
+
+	keys := make([]string, 0, len(oldObject)+len(newObject))
+	for key := range oldObject {
+		keys = append(keys, key)
+	}
+	for key := range newObject {
+		if _, ok := oldObject[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		memberPath := path + "/" + escapeJSONPointer(key)
+		oldMember, inOld := oldObject[key]
+		newMember, inNew := newObject[key]
+		switch {
+		case !inNew:
+			*patch = append(*patch, JSONPatchOperation{Op: JSONPatchRemove, Path: memberPath})
+		case !inOld:
+			value, err := json.Marshal(newMember)
+			if err != nil {
+				return err
+			}
+			*patch = append(*patch, JSONPatchOperation{Op: JSONPatchAdd, Path: memberPath, Value: value})
+		default:
+			if err := diffJSONValues(patch, memberPath, oldMember, newMember); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Apply applies p to doc as RFC 6902 specifies, failing on a path that
+// does not exist. Only add, remove and replace are supported.
+func (p JSONPatch) Apply(doc json.RawMessage) (json.RawMessage, error) {
+	return p.apply(doc, true)
+}
+
+// Merge applies p to doc, which may hold more than the document p was
+// computed against, or less of it. A replace of a missing object member adds
+// it and a remove of one is skipped, so patches of partial snapshots of an
+// entity can be replayed onto its accumulated state.
+func (p JSONPatch) Merge(doc json.RawMessage) (json.RawMessage, error) {
+	return p.apply(doc, false)
+}
+
+func (p JSONPatch) apply(doc json.RawMessage, strict bool) (json.RawMessage, error) {
+	var value interface{}
+	if !isJSONNull(doc) {
+		var err error
+		if value, err = decodeJSONValue(doc); err != nil {
+			return nil, err
+		}
+	}
+
+	for i, operation := range p {
+		var err error
+		if value, err = applyJSONPatchOperation(value, operation, strict); err != nil {
+			return nil, fmt.Errorf("operation %d (%s %q): %w", i, operation.Op, operation.Path, err)
+		}
+	}
+	return json.Marshal(value)
+}
+
+func applyJSONPatchOperation(doc interface{}, operation JSONPatchOperation, strict bool) (interface{}, error) {
+	var operand interface{}
+	switch operation.Op {
+	case JSONPatchAdd, JSONPatchReplace:
+		if len(operation.Value) == 0 {
+			return nil, fmt.Errorf("missing value")
+		}
+		var err error
+		if operand, err = decodeJSONValue(operation.Value); err != nil {
+			return nil, fmt.Errorf("value: %w", err)
+		}
+	case JSONPatchRemove:
+	default:
+		return nil, fmt.Errorf("unsupported operation")
+	}
+
+	if operation.Path == "" {
+		if operation.Op == JSONPatchRemove {
+			return nil, nil
+		}
+		return operand, nil
+	}
+	if !strings.HasPrefix(operation.Path, "/") {
+		return nil, fmt.Errorf("path is not a JSON pointer")
+	}
+	tokens := strings.Split(operation.Path[1:], "/")
+	for i := range tokens {
+		tokens[i] = unescapeJSONPointer(tokens[i])
+	}
+
+	// Walk to the parent of the target
+	parent := doc
+	for _, token := range tokens[:len(tokens)-1] {
+		child, ok := jsonChild(parent, token)
+		if !ok {
+			return nil, fmt.Errorf("path does not exist")
+		}
+		parent = child
+	}
+	last := tokens[len(tokens)-1]
+
+	switch container := parent.(type) {
+	case map[string]interface{}:
+		_, exists := container[last]
+		switch {
+		case operation.Op == JSONPatchAdd, exists:
+		case strict:
+			return nil, fmt.Errorf("path does not exist")
+		case operation.Op == JSONPatchRemove:
+			return doc, nil
+		}
+		if operation.Op == JSONPatchRemove {
+			delete(container, last)
+		} else {
+			container[last] = operand
+		}
+	case []interface{}:
+		// DiffJSON replaces arrays whole, so elements are only ever replaced
+		if operation.Op != JSONPatchReplace {
+			return nil, fmt.Errorf("unsupported operation on an array element")
+		}
+		index, err := strconv.Atoi(last)
+		if err != nil || index < 0 || index >= len(container) {
+			return nil, fmt.Errorf("path does not exist")
+		}
+		container[index] = operand
+	default:
+		return nil, fmt.Errorf("path does not exist")
+	}
+	return doc, nil
+}
+
+func jsonChild(value interface{}, token string) (interface{}, bool) {
+	switch container := value.(type) {
+	case map[string]interface{}:
+		child, ok := container[token]
+		return child, ok
+	case []interface{}:
+		index, err := strconv.Atoi(token)
+		if err != nil || index < 0 || index >= len(container) {
+			return nil, false
+		}
+		return container[index], true
+	}
+	return nil, false
+}
+
+// decodeJSONValue decodes data keeping numbers as json.Number.
+func decodeJSONValue(data json.RawMessage) (interface{}, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return nil, err
+	}
+	return value, nil
+}
+
+func isJSONNull(data json.RawMessage) bool {
+	trimmed := bytes.TrimSpace(data)
+	return len(trimmed) == 0 || bytes.Equal(trimmed, []byte("null"))
+}
+
+var (
+	jsonPointerEscaper   = strings.NewReplacer("~", "~0", "/", "~1")
+	jsonPointerUnescaper = strings.NewReplacer("~1", "/", "~0", "~")
+)
+
+func escapeJSONPointer(token string) string {
+	return jsonPointerEscaper.Replace(token)
+}
+
+func unescapeJSONPointer(token string) string {
+	return jsonPointerUnescaper.Replace(token)
+}
+
+// ComputePatch sets log.Patch to the patch from its old value to its new
+// value.
+func (log *AuditLog) ComputePatch() error {
+	patch, err := DiffJSON(log.OldValue, log.NewValue)
+	if err != nil {
+		return err
+	}
+	log.Patch = patch
+	return nil
+}
+
+// PatchMatches reports whether log.Patch is the patch from its old value to
+// its new value, ignoring formatting and key order within values.
+func (log *AuditLog) PatchMatches() (bool, error) {
+	expected, err := DiffJSON(log.OldValue, log.NewValue)
+	if err != nil {
+		return false, err
+	}
+	if expected, err = expected.canonical(); err != nil {
+		return false, err
+	}
+	actual, err := log.Patch.canonical()
+	if err != nil {
+		return false, err
+	}
+	return reflect.DeepEqual(expected, actual), nil
+}
+
+// canonical returns a copy of p with its values in canonical JSON.
+func (p JSONPatch) canonical() (JSONPatch, error) {
+	canonical := make(JSONPatch, len(p))
+	for i, operation := range p {
+		if len(operation.Value) > 0 {
+			var err error
+			if operation.Value, err = canonicalJSON(operation.Value); err != nil {
+				return nil, err
+			}
+		}
+		canonical[i] = operation
+	}
+	return canonical, nil
+}
@@ -0,0 +1,253 @@
+package models
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+// assertJSONEqual fails t if got and want are not the same JSON value,
+// ignoring formatting and key order. Numbers must be written alike.
+func assertJSONEqual(t *testing.T, what string, got, want []byte) {
+	t.Helper()
+	gotValue, err := decodeJSONValue(got)
+	if err != nil {
+		t.Fatalf("%s: decoding %s: %v", what, got, err)
+	}
+	wantValue, err := decodeJSONValue(want)
+	if err != nil {
+		t.Fatalf("%s: decoding %s: %v", what, want, err)
+	}
+	if !reflect.DeepEqual(gotValue, wantValue) {
+		t.Errorf("%s = %s, want %s", what, got, want)
+	}
+}
+
+func TestDiffJSONRoundTrips(t *testing.T) {
+	tests := []struct {
+		name      string
+		oldDoc    string
+		newDoc    string
+		wantPatch string
+	}{
+		{
+			name:      "unchanged",
+			oldDoc:    `{"a": 1, "b": [1, 2]}`,
+			newDoc:    `{"b": [1, 2], "a": 1}`,
+			wantPatch: `[]`,
+		},
+		{
+			name:      "null old document",
+			oldDoc:    `null`,
+			newDoc:    `{"a": 1}`,
+			wantPatch: `[{"op": "add", "path": "", "value": {"a": 1}}]`,
+		},
+		{
+			name:      "empty old document",
+			oldDoc:    ``,
+			newDoc:    `{"a": 1}`,
+			wantPatch: `[{"op": "add", "path": "", "value": {"a": 1}}]`,
+		},
+		{
+			name:      "member replaced",
+			oldDoc:    `{"a": 1, "b": "x"}`,
+			newDoc:    `{"a": 2, "b": "x"}`,
+			wantPatch: `[{"op": "replace", "path": "/a", "value": 2}]`,
+		},
+		{
+			name:   "members added and removed in key order",
+			oldDoc: `{"c": 1, "a": 1}`,
+			newDoc: `{"b": true, "d": null}`,
+			wantPatch: `[
+				{"op": "remove", "path": "/a"},
+				{"op": "add", "path": "/b", "value": true},
+				{"op": "remove", "path": "/c"},
+				{"op": "add", "path": "/d", "value": null}
+			]`,
+		},
+		{
+			name:      "nested objects",
+			oldDoc:    `{"a": {"b": {"c": 1, "d": 2}, "e": 3}}`,
+			newDoc:    `{"a": {"b": {"c": 1, "d": 4}, "e": 3}}`,
+			wantPatch: `[{"op": "replace", "path": "/a/b/d", "value": 4}]`,
+		},
+		{
+			name:      "nested member added",
+			oldDoc:    `{"a": {"b": {}}}`,
+			newDoc:    `{"a": {"b": {"c": [1]}}}`,
+			wantPatch: `[{"op": "add", "path": "/a/b/c", "value": [1]}]`,
+		},
+		{
+			name:      "array shortened",
+			oldDoc:    `{"list": [1, 2, 3]}`,
+			newDoc:    `{"list": [1, 2]}`,
+			wantPatch: `[{"op": "replace", "path": "/list", "value": [1, 2]}]`,
+		},
+		{
+			name:      "array of objects",
+			oldDoc:    `{"list": [{"id": 1}]}`,
+			newDoc:    `{"list": [{"id": 1}, {"id": 2}]}`,
+			wantPatch: `[{"op": "replace", "path": "/list", "value": [{"id": 1}, {"id": 2}]}]`,
+		},
+		{
+			name:      "object replaced by scalar",
+			oldDoc:    `{"a": {"b": 1}}`,
+			newDoc:    `{"a": null}`,
+			wantPatch: `[{"op": "replace", "path": "/a", "value": null}]`,
+		},
+		{
+			name:      "root replaced",
+			oldDoc:    `[1, 2]`,
+			newDoc:    `{"a": 1}`,
+			wantPatch: `[{"op": "replace", "path": "", "value": {"a": 1}}]`,
+		},
+		{
+			name:   "escaped keys",
+			oldDoc: `{"a/b": 1, "m~n": 2, "~1": {"/": 3}}`,
+			newDoc: `{"a/b": 5, "m~n": 6, "~1": {"/": 7}}`,
+			wantPatch: `[
+				{"op": "replace", "path": "/a~1b", "value": 5},
+				{"op": "replace", "path": "/m~0n", "value": 6},
+				{"op": "replace", "path": "/~01/~1", "value": 7}
+			]`,
+		},
+		{
+			name:      "numbers kept as written",
+			oldDoc:    `{"rate": 1.50}`,
+			newDoc:    `{"rate": 1.5}`,
+			wantPatch: `[{"op": "replace", "path": "/rate", "value": 1.5}]`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			patch, err := DiffJSON(json.RawMessage(tt.oldDoc), json.RawMessage(tt.newDoc))
+			if err != nil {
+				t.Fatalf("DiffJSON: %v", err)
+			}
+			got, err := json.Marshal(patch)
+			if err != nil {
+				t.Fatalf("marshal patch: %v", err)
+			}
+			assertJSONEqual(t, "DiffJSON", got, []byte(tt.wantPatch))
+
+			applied, err := patch.Apply(json.RawMessage(tt.oldDoc))
+			if err != nil {
+				t.Fatalf("Apply: %v", err)
+			}
+			assertJSONEqual(t, "Apply(old, DiffJSON(old, new))", applied, []byte(tt.newDoc))
+		})
+	}
+}
+
+func TestDiffJSONRejectsInvalidDocuments(t *testing.T) {
+	if _, err := DiffJSON(json.RawMessage(`{"a": 1}`), json.RawMessage(`{"a":`)); err == nil {
+		t.Error("DiffJSON with an invalid new document succeeded")
+	}
+	if _, err := DiffJSON(json.RawMessage(`{"a":`), json.RawMessage(`{"a": 1}`)); err == nil {
+		t.Error("DiffJSON with an invalid old document succeeded")
+	}
+}
+
+func TestJSONPatchApplyFailsOnMissingPaths(t *testing.T) {
+	tests := []struct {
+		name  string
+		doc   string
+		patch string
+	}{
+		{"remove of missing member", `{"a": 1}`, `[{"op": "remove", "path": "/b"}]`},
+		{"replace of missing member", `{"a": 1}`, `[{"op": "replace", "path": "/b", "value": 2}]`},
+		{"missing parent", `{"a": 1}`, `[{"op": "add", "path": "/b/c", "value": 2}]`},
+		{"array index out of range", `{"a": [1]}`, `[{"op": "replace", "path": "/a/1", "value": 2}]`},
+		{"add to array", `{"a": [1]}`, `[{"op": "add", "path": "/a/0", "value": 2}]`},
+		{"not a pointer", `{"a": 1}`, `[{"op": "replace", "path": "a", "value": 2}]`},
+		{"missing value", `{"a": 1}`, `[{"op": "replace", "path": "/a"}]`},
+		{"unsupported operation", `{"a": 1}`, `[{"op": "move", "from": "/a", "path": "/b"}]`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var patch JSONPatch
+			if err := json.Unmarshal([]byte(tt.patch), &patch); err != nil {
+				t.Fatalf("unmarshal patch: %v", err)
+			}
+			if got, err := patch.Apply(json.RawMessage(tt.doc)); err == nil {
+				t.Errorf("Apply = %s, want an error", got)
+			}
+		})
+	}
+}
+
+func TestJSONPatchMerge(t *testing.T) {
+	tests := []struct {
+		name  string
+		doc   string
+		patch string
+		want  string
+	}{
+		{
+			name:  "replace of missing member adds it",
+			doc:   `{"a": 1}`,
+			patch: `[{"op": "replace", "path": "/b", "value": 2}]`,
+			want:  `{"a": 1, "b": 2}`,
+		},
+		{
+			name:  "remove of missing member is skipped",
+			doc:   `{"a": 1}`,
+			patch: `[{"op": "remove", "path": "/b"}]`,
+			want:  `{"a": 1}`,
+		},
+		{
+			name:  "members the patch does not know are kept",
+			doc:   `{"a": 1, "extra": {"x": true}}`,
+			patch: `[{"op": "replace", "path": "/a", "value": 2}, {"op": "remove", "path": "/extra/y"}]`,
+			want:  `{"a": 2, "extra": {"x": true}}`,
+		},
+		{
+			name:  "escaped keys",
+			doc:   `{}`,
+			patch: `[{"op": "replace", "path": "/a~1b", "value": 1}, {"op": "add", "path": "/m~0n", "value": 2}]`,
+			want:  `{"a/b": 1, "m~n": 2}`,
+		},
+		{
+			name:  "null document",
+			doc:   `null`,
+			patch: `[{"op": "add", "path": "", "value": {"a": 1}}]`,
+			want:  `{"a": 1}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var patch JSONPatch
+			if err := json.Unmarshal([]byte(tt.patch), &patch); err != nil {
+				t.Fatalf("unmarshal patch: %v", err)
+			}
+			got, err := patch.Merge(json.RawMessage(tt.doc))
+			if err != nil {
+				t.Fatalf("Merge: %v", err)
+			}
+			assertJSONEqual(t, "Merge", got, []byte(tt.want))
+		})
+	}
+}
+
+func TestJSONPatchMergeReplaysPartialSnapshots(t *testing.T) {
+	// Each change records only the members it touched, so its patch is
+	// computed against part of the entity
+	changes := []struct{ oldDoc, newDoc string }{
+		{``, `{"id": "acc1", "balance": "10.00", "status": "ACTIVE"}`},
+		{`{"balance": "10.00"}`, `{"balance": "7.50"}`},
+		{`{"status": "ACTIVE"}`, `{"status": "FROZEN", "reason": "review"}`},
+		{`{"status": "FROZEN", "reason": "review"}`, `{"status": "ACTIVE"}`},
+	}
+
+	state := json.RawMessage(`null`)
+	for i, change := range changes {
+		patch, err := DiffJSON(json.RawMessage(change.oldDoc), json.RawMessage(change.newDoc))
+		if err != nil {
+			t.Fatalf("change %d: DiffJSON: %v", i, err)
+		}
+		if state, err = patch.Merge(state); err != nil {
+			t.Fatalf("change %d: Merge: %v", i, err)
+		}
+	}
+	assertJSONEqual(t, "replayed state", state, []byte(`{"id": "acc1", "balance": "7.50", "status": "ACTIVE"}`))
+}
@@ -1,68 +1,664 @@
 package models
 
 import (
+	"database/sql/driver"
+	"encoding/base64"
 	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
 	"time"
+
+	"github.com/riteshkumar/internal-transfers/internal/money"
 )
 
 type Account struct {
-	ID        string    `json:"id"`
-	Balance   float64   `json:"balance"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
+	ID       string         `json:"id"`
+	Type     string         `json:"type"`
+	Currency money.Currency `json:"currency"`
+	Status   string         `json:"status"`
+	Balance  money.Amount   `json:"balance"`
+	// OverdraftLimit is how far below zero Balance may go.
+	OverdraftLimit money.Amount `json:"overdraft_limit"`
+	// HeldBalance is the total of active, unexpired holds on the account.
+	HeldBalance money.Amount `json:"held_balance"`
+	// Version increases by one with every change to the account row.
+	Version int64 `json:"version"`
+	// LapsedHolds counts holds still ACTIVE but past their expiry. They no
+	// longer count in HeldBalance, but only change Version once expired.
+	LapsedHolds int       `json:"-"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// AvailableBalance is the amount that can still be spent: Balance plus the
+// overdraft limit, minus funds reserved by holds.
+func (a *Account) AvailableBalance() money.Amount {
+	return a.Balance.Add(a.OverdraftLimit).Sub(a.HeldBalance)
+}
+
+// ETag identifies what the account looks like, for HTTP entity tags: the
+// version, followed by the number of lapsed holds when there are any, since
+// a lapsing hold changes the available balance before the version.
+func (a *Account) ETag() string {
+	if a.LapsedHolds == 0 {
+		return strconv.FormatInt(a.Version, 10)
+	}
+	return strconv.FormatInt(a.Version, 10) + "." + strconv.Itoa(a.LapsedHolds)
+}
+
+// CanDebit reports whether money may leave the account.
+func (a *Account) CanDebit() bool {
+	return a.Status == AccountStatusActive || a.Status == AccountStatusCreditFrozen
+}
+
+// CanCredit reports whether money may enter the account.
+func (a *Account) CanCredit() bool {
+	return a.Status == AccountStatusActive || a.Status == AccountStatusDebitFrozen
 }
 
 type Transaction struct {
-	ID                   string    `json:"id"`
-	SourceAccountID      string    `json:"source_account_id"`
-	DestinationAccountID string    `json:"destination_account_id"`
-	Amount               float64   `json:"amount"`
-	CreatedAt            time.Time `json:"created_at"`
+	ID                   string         `json:"id"`
+	SourceAccountID      string         `json:"source_account_id"`
+	DestinationAccountID string         `json:"destination_account_id"`
+	Amount               money.Amount   `json:"amount"`
+	Currency             money.Currency `json:"currency,omitempty"`
+	DestinationAmount    money.Amount   `json:"destination_amount,omitempty"`
+	DestinationCurrency  money.Currency `json:"destination_currency,omitempty"`
+	FXRateID             *string        `json:"fx_rate_id,omitempty"`
+	FXRate               *money.Rate    `json:"fx_rate,omitempty"`
+	FXRoundingAdjustment *string        `json:"fx_rounding_adjustment,omitempty"`
+	ReversalOfID         *string        `json:"reversal_of_id,omitempty"`
+	ReversedAmount       money.Amount   `json:"reversed_amount"`
+	Reference            *string        `json:"reference,omitempty"`
+	Description          string         `json:"description,omitempty"`
+	Metadata             Metadata       `json:"metadata,omitempty"`
+	Status               string         `json:"status"`
+	FailureReason        *string        `json:"failure_reason,omitempty"`
+	CreatedAt            time.Time      `json:"created_at"`
+}
+
+// Metadata is a small map of client-defined string tags, stored as a JSON
+// object.
+type Metadata map[string]string
+
+// Metadata limits, checked when a transfer is created.
+const (
+	MaxMetadataEntries     = 20
+	MaxMetadataKeyLength   = 40
+	MaxMetadataValueLength = 500
+)
+
+func (m *Metadata) Scan(src interface{}) error {
+	var data []byte
+	switch v := src.(type) {
+	case []byte:
+		data = v
+	case string:
+		data = []byte(v)
+	case nil:
+		*m = nil
+		return nil
+	default:
+		return fmt.Errorf("cannot scan %T into Metadata", src)
+	}
+	return json.Unmarshal(data, m)
+}
+
+func (m Metadata) Value() (driver.Value, error) {
+	if m == nil {
+		return []byte("{}"), nil
+	}
+	return json.Marshal(m)
+}
+
+// RemainingReversible is how much of the transaction, in its source
+// currency, can still be reversed.
+func (t *Transaction) RemainingReversible() money.Amount {
+	return t.Amount.Sub(t.ReversedAmount)
+}
+
+// Transaction statuses. A transfer is PENDING until its journal entry is
+// posted and then POSTED; a rejected transfer is recorded as FAILED with a
+// reason code. A POSTED transfer becomes REVERSED once fully reversed.
+const (
+	TransactionStatusPending  = "PENDING"
+	TransactionStatusPosted   = "POSTED"
+	TransactionStatusFailed   = "FAILED"
+	TransactionStatusReversed = "REVERSED"
+)
+
+// transactionStatusTransitions lists the statuses each status may move to.
+var transactionStatusTransitions = map[string][]string{
+	TransactionStatusPending: {TransactionStatusPosted, TransactionStatusFailed},
+	TransactionStatusPosted:  {TransactionStatusReversed},
+}
+
+// CanTransitionTransactionStatus reports whether a transaction may move from
+// one status to another.
+func CanTransitionTransactionStatus(from, to string) bool {
+	for _, next := range transactionStatusTransitions[from] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
+
+// Reason codes recorded on FAILED transactions.
+const (
+	FailureReasonAccountNotFound    = "ACCOUNT_NOT_FOUND"
+	FailureReasonAccountNotActive   = "ACCOUNT_NOT_ACTIVE"
+	FailureReasonInsufficientFunds  = "INSUFFICIENT_FUNDS"
+	FailureReasonCurrencyMismatch   = "CURRENCY_MISMATCH"
+	FailureReasonInvalidAmount      = "INVALID_AMOUNT"
+	FailureReasonDuplicateReference = "DUPLICATE_REFERENCE"
+)
+
+// Directions of money movement from an account's point of view.
+const (
+	DirectionDebit  = "debit"
+	DirectionCredit = "credit"
+)
+
+// AccountTransaction is one line of an account's transaction history. Amount
+// is signed from the account's point of view: negative when money left it,
+// positive when money came in, in the currency of that side.
+type AccountTransaction struct {
+	TransactionID         string         `json:"transaction_id"`
+	Direction             string         `json:"direction"`
+	CounterpartyAccountID string         `json:"counterparty_account_id"`
+	Amount                money.Amount   `json:"amount"`
+	Currency              money.Currency `json:"currency"`
+	Status                string         `json:"status"`
+	ReversalOfID          *string        `json:"reversal_of_id,omitempty"`
+	Reference             *string        `json:"reference,omitempty"`
+	Description           string         `json:"description,omitempty"`
+	CreatedAt             time.Time      `json:"created_at"`
+}
+
+// TransactionHistoryFilter narrows an account's transaction history. Zero
+// fields don't filter. Amounts bound the unsigned amount on the account's
+// side, From is inclusive and To exclusive.
+type TransactionHistoryFilter struct {
+	Direction             string
+	CounterpartyAccountID string
+	MinAmount             *money.Amount
+	MaxAmount             *money.Amount
+	From                  *time.Time
+	To                    *time.Time
+	After                 *Cursor
+	Limit                 int
+}
+
+type AccountTransactionsResponse struct {
+	Transactions []*AccountTransaction `json:"transactions"`
+	NextCursor   string                `json:"next_cursor,omitempty"`
+}
+
+// Sort keys for account listings.
+const (
+	AccountSortCreatedAt = "created_at"
+	AccountSortUpdatedAt = "updated_at"
+	AccountSortBalance   = "balance"
+)
+
+// AccountListFilter narrows and orders an account listing. Zero fields don't
+// filter. Balance bounds are inclusive, CreatedFrom is inclusive and
+// CreatedTo exclusive. System ledger accounts are never listed.
+type AccountListFilter struct {
+	IDPrefix    string
+	MinBalance  *money.Amount
+	MaxBalance  *money.Amount
+	CreatedFrom *time.Time
+	CreatedTo   *time.Time
+	SortBy      string
+	Descending  bool
+	After       *Cursor
+	Limit       int
+}
+
+// BatchGetAccountsRequest looks up many accounts at once.
+type BatchGetAccountsRequest struct {
+	IDs []string `json:"ids"`
+}
+
+// BatchGetAccountsResponse lists the accounts found, in request order, and
+// separately the requested ids that don't exist.
+type BatchGetAccountsResponse struct {
+	Accounts []AccountResponse `json:"accounts"`
+	NotFound []string          `json:"not_found"`
+}
+
+type AccountListResponse struct {
+	Accounts   []AccountResponse `json:"accounts"`
+	NextCursor string            `json:"next_cursor,omitempty"`
+}
+
+// Cursor is a position in a keyset-paginated list: the sort value and id of
+// the last item of the previous page. Clients see it as an opaque string.
+type Cursor struct {
+	Value string `json:"v"`
+	ID    string `json:"id"`
+}
+
+// Encode returns the opaque form of c.
+func (c Cursor) Encode() string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
 }
 
+// DecodeCursor parses a cursor returned by Encode.
+func DecodeCursor(s string) (*Cursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("malformed cursor: %w", err)
+	}
+	var cursor Cursor
+	if err := json.Unmarshal(data, &cursor); err != nil {
+		return nil, fmt.Errorf("malformed cursor: %w", err)
+	}
+	if cursor.ID == "" {
+		return nil, fmt.Errorf("malformed cursor: missing id")
+	}
+	return &cursor, nil
+}
+
+// FXRate converts BaseCurrency into QuoteCurrency during [ValidFrom, ValidTo).
+// A nil ValidTo leaves the window open-ended.
+type FXRate struct {
+	ID            string         `json:"id"`
+	BaseCurrency  money.Currency `json:"base_currency"`
+	QuoteCurrency money.Currency `json:"quote_currency"`
+	Rate          money.Rate     `json:"rate"`
+	ValidFrom     time.Time      `json:"valid_from"`
+	ValidTo       *time.Time     `json:"valid_to"`
+	CreatedAt     time.Time      `json:"created_at"`
+}
+
+// Hold reserves funds on an account without moving them. An active hold
+// reduces the account's available balance until it is captured into a
+// transfer, voided, or expires.
+type Hold struct {
+	ID             string         `json:"id"`
+	AccountID      string         `json:"account_id"`
+	Amount         money.Amount   `json:"amount"`
+	Currency       money.Currency `json:"currency"`
+	Status         string         `json:"status"`
+	CapturedAmount *money.Amount  `json:"captured_amount,omitempty"`
+	TransactionID  *string        `json:"transaction_id,omitempty"`
+	ExpiresAt      time.Time      `json:"expires_at"`
+	CreatedAt      time.Time      `json:"created_at"`
+	UpdatedAt      time.Time      `json:"updated_at"`
+}
+
+const (
+	HoldStatusActive   = "ACTIVE"
+	HoldStatusCaptured = "CAPTURED"
+	HoldStatusVoided   = "VOIDED"
+	HoldStatusExpired  = "EXPIRED"
+)
+
+// Account statuses. DEBIT_FROZEN blocks money leaving the account and
+// CREDIT_FROZEN blocks money entering it; FROZEN blocks both. CLOSED is
+// final.
+const (
+	AccountStatusActive       = "ACTIVE"
+	AccountStatusFrozen       = "FROZEN"
+	AccountStatusDebitFrozen  = "DEBIT_FROZEN"
+	AccountStatusCreditFrozen = "CREDIT_FROZEN"
+	AccountStatusClosed       = "CLOSED"
+)
+
+// accountStatusTransitions lists the statuses each status may move to.
+var accountStatusTransitions = map[string][]string{
+	AccountStatusActive:       {AccountStatusFrozen, AccountStatusDebitFrozen, AccountStatusCreditFrozen, AccountStatusClosed},
+	AccountStatusFrozen:       {AccountStatusActive},
+	AccountStatusDebitFrozen:  {AccountStatusActive},
+	AccountStatusCreditFrozen: {AccountStatusActive},
+}
+
+// IsValidAccountStatus reports whether status is a known account status.
+func IsValidAccountStatus(status string) bool {
+	_, ok := accountStatusTransitions[status]
+	return ok || status == AccountStatusClosed
+}
+
+// CanTransitionAccountStatus reports whether an account may move from one
+// status to another.
+func CanTransitionAccountStatus(from, to string) bool {
+	for _, next := range accountStatusTransitions[from] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
+
+const (
+	AccountTypeCustomer = "CUSTOMER"
+	AccountTypeSystem   = "SYSTEM"
+)
+
+// SystemAccountPrefix is reserved for internal ledger accounts such as
+// opening-balance equity and FX positions.
+const SystemAccountPrefix = "sys:"
+
+const (
+	SystemAccountOpeningBalance = "opening"
+	SystemAccountFX             = "fx"
+)
+
+// SystemAccountID returns the id of the system account of the given kind
+// for currency, e.g. "sys:fx:EUR".
+func SystemAccountID(kind string, currency money.Currency) string {
+	return SystemAccountPrefix + kind + ":" + currency.String()
+}
+
+func IsSystemAccountID(id string) bool {
+	return strings.HasPrefix(id, SystemAccountPrefix)
+}
+
+// JournalEntry is a balanced set of postings recording one business event.
+type JournalEntry struct {
+	ID            string    `json:"id"`
+	Kind          string    `json:"kind"`
+	TransactionID *string   `json:"transaction_id,omitempty"`
+	Postings      []Posting `json:"postings"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+// Posting is one line of a journal entry. Amount is the signed change to the
+// account's balance: credits are positive and debits negative.
+type Posting struct {
+	ID             string         `json:"id"`
+	JournalEntryID string         `json:"journal_entry_id"`
+	AccountID      string         `json:"account_id"`
+	Amount         money.Amount   `json:"amount"`
+	Currency       money.Currency `json:"currency"`
+	CreatedAt      time.Time      `json:"created_at"`
+}
+
+const (
+	JournalKindAccountOpening = "ACCOUNT_OPENING"
+	JournalKindTransfer       = "TRANSFER"
+	JournalKindReversal       = "REVERSAL"
+)
+
+// IdempotencyRecord is the stored outcome of a request made with an
+// Idempotency-Key by Principal. Fingerprint identifies the request body the key was first
+// used with and Response is the body that was sent back. When Failed is set,
+// the request was a transfer rejected and recorded as FAILED, and Response
+// holds its TransferFailure.
+type IdempotencyRecord struct {
+	Principal   string          `json:"principal"`
+	Scope       string          `json:"scope"`
+	Key         string          `json:"key"`
+	Fingerprint string          `json:"fingerprint"`
+	Response    json.RawMessage `json:"response"`
+	Failed      bool            `json:"failed"`
+	CreatedAt   time.Time       `json:"created_at"`
+	ExpiresAt   time.Time       `json:"expires_at"`
+}
+
+// TransferFailure is what an Idempotency-Key keeps of a rejected transfer,
+// so that a retry gets the same error back.
+type TransferFailure struct {
+	TransactionID string `json:"transaction_id"`
+	FailureReason string `json:"failure_reason"`
+	Message       string `json:"message"`
+}
+
+// AuditLog is one audit entry. Event determines EntityType, Action and the
+// shape of OldValue and NewValue; see AuditEventSpec.
+//
+// Entries form a hash chain: Sequence numbers them without gaps, and Hash
+// covers the entry's content together with PrevHash, the previous entry's
+// Hash. Entries are chained by the transaction that writes them; only
+// servers that chained after commit left entries with a WriteOrder but no
+// Sequence. Entries written before the chain existed have neither.
 type AuditLog struct {
-	ID         string          `json:"id"`
-	EntityType string          `json:"entity_type"`
-	EntityID   string          `json:"entity_id"`
-	Action     string          `json:"action"`
-	OldValue   json.RawMessage `json:"old_value"`
-	NewValue   json.RawMessage `json:"new_value"`
-	CreatedAt  time.Time       `json:"created_at"`
+	ID            string          `json:"id"`
+	WriteOrder    *int64          `json:"-"`
+	Sequence      *int64          `json:"sequence,omitempty"`
+	Event         AuditEvent      `json:"event"`
+	SchemaVersion int             `json:"schema_version"`
+	EntityType    string          `json:"entity_type"`
+	EntityID      string          `json:"entity_id"`
+	Action        string          `json:"action"`
+	OldValue      json.RawMessage `json:"old_value"`
+	NewValue      json.RawMessage `json:"new_value"`
+	Patch         JSONPatch       `json:"patch,omitempty"`
+	PrevHash      string          `json:"prev_hash,omitempty"`
+	Hash          string          `json:"hash,omitempty"`
+	Actor         *AuditActor     `json:"actor,omitempty"`
+	CreatedAt     time.Time       `json:"created_at"`
+}
+
+// AuditLogFilter narrows an audit log query. Zero fields don't filter; From
+// is inclusive and To exclusive.
+type AuditLogFilter struct {
+	Event      AuditEvent
+	EntityType string
+	EntityID   string
+	Action     string
+	Principal  string
+	ClientIP   string
+	RequestID  string
+	From       *time.Time
+	To         *time.Time
+	After      *Cursor
+	Limit      int
+	// ChangesOnly drops the old and new values from the results, leaving
+	// their patches.
+	ChangesOnly bool
+}
+
+type AuditLogListResponse struct {
+	AuditLogs  []*AuditLog `json:"audit_logs"`
+	NextCursor string      `json:"next_cursor,omitempty"`
+}
+
+// AuditEntityState is an entity's state as of one of its audit entries,
+// rebuilt by replaying the patches of its entries up to and including that
+// one.
+type AuditEntityState struct {
+	AuditLogID      string          `json:"audit_log_id"`
+	EntityType      string          `json:"entity_type"`
+	EntityID        string          `json:"entity_id"`
+	State           json.RawMessage `json:"state"`
+	EntriesReplayed int             `json:"entries_replayed"`
+	CreatedAt       time.Time       `json:"created_at"`
 }
 
 const (
 	AuditActionCreate   = "CREATE"
 	AuditActionUpdate   = "UPDATE"
 	AuditActionTransfer = "TRANSFER"
+	AuditActionCapture  = "CAPTURE"
+	AuditActionVoid     = "VOID"
+	AuditActionExpire   = "EXPIRE"
+	AuditActionReverse  = "REVERSE"
+	AuditActionFail     = "FAIL"
+	AuditActionDebit    = "DEBIT"
+	AuditActionCredit   = "CREDIT"
 )
 
 const (
 	EntityTypeAccount     = "ACCOUNT"
 	EntityTypeTransaction = "TRANSACTION"
+	EntityTypeFXRate      = "FX_RATE"
+	EntityTypeHold        = "HOLD"
 )
 
 type CreateAccountRequest struct {
-	ID             string  `json:"id"`
-	InitialBalance float64 `json:"initial_balance"`
+	ID             string       `json:"id"`
+	Currency       string       `json:"currency"`
+	InitialBalance money.Amount `json:"initial_balance"`
 }
 
 type AccountResponse struct {
-	ID      string  `json:"id"`
-	Balance float64 `json:"balance"`
+	ID               string         `json:"id"`
+	Currency         money.Currency `json:"currency"`
+	Status           string         `json:"status"`
+	Balance          money.Amount   `json:"balance"`
+	OverdraftLimit   money.Amount   `json:"overdraft_limit"`
+	AvailableBalance money.Amount   `json:"available_balance"`
+	Version          int64          `json:"version"`
+}
+
+// NewAccountResponse builds the API representation of an account.
+func NewAccountResponse(account *Account) AccountResponse {
+	return AccountResponse{
+		ID:               account.ID,
+		Currency:         account.Currency,
+		Status:           account.Status,
+		Balance:          account.Balance,
+		OverdraftLimit:   account.OverdraftLimit,
+		AvailableBalance: account.AvailableBalance(),
+		Version:          account.Version,
+	}
+}
+
+// SetOverdraftLimitRequest sets how far below zero an account may go. Zero
+// means the account must never go negative.
+type SetOverdraftLimitRequest struct {
+	OverdraftLimit money.Amount `json:"overdraft_limit"`
+
+	// ExpectedETag, when set from If-Match, makes the change fail with
+	// ErrVersionMismatch unless the account's ETag still matches it.
+	ExpectedETag *string `json:"-"`
 }
 
 type CreateTransactionRequest struct {
-	SourceAccountID      string  `json:"source_account_id"`
-	DestinationAccountID string  `json:"destination_account_id"`
-	Amount               float64 `json:"amount"`
+	SourceAccountID      string       `json:"source_account_id"`
+	DestinationAccountID string       `json:"destination_account_id"`
+	Amount               money.Amount `json:"amount"`
+	// Reference is an optional client reference, unique per source account.
+	Reference   *string  `json:"reference,omitempty"`
+	Description string   `json:"description,omitempty"`
+	Metadata    Metadata `json:"metadata,omitempty"`
+
+	// ExpectedETag is checked against the source account, as in
+	// SetOverdraftLimitRequest.
+	ExpectedETag *string `json:"-"`
 }
 
 type TransactionResponse struct {
-	ID                   string    `json:"id"`
-	SourceAccountID      string    `json:"source_account_id"`
-	DestinationAccountID string    `json:"destination_account_id"`
-	Amount               float64   `json:"amount"`
-	CreatedAt            time.Time `json:"created_at"`
+	ID                   string         `json:"id"`
+	SourceAccountID      string         `json:"source_account_id"`
+	DestinationAccountID string         `json:"destination_account_id"`
+	Amount               money.Amount   `json:"amount"`
+	Currency             money.Currency `json:"currency,omitempty"`
+	DestinationAmount    money.Amount   `json:"destination_amount,omitempty"`
+	DestinationCurrency  money.Currency `json:"destination_currency,omitempty"`
+	FXRateID             *string        `json:"fx_rate_id,omitempty"`
+	FXRate               *money.Rate    `json:"fx_rate,omitempty"`
+	FXRoundingAdjustment *string        `json:"fx_rounding_adjustment,omitempty"`
+	ReversalOfID         *string        `json:"reversal_of_id,omitempty"`
+	ReversedAmount       money.Amount   `json:"reversed_amount"`
+	Reference            *string        `json:"reference,omitempty"`
+	Description          string         `json:"description,omitempty"`
+	Metadata             Metadata       `json:"metadata,omitempty"`
+	Status               string         `json:"status"`
+	FailureReason        *string        `json:"failure_reason,omitempty"`
+	CreatedAt            time.Time      `json:"created_at"`
+}
+
+// NewTransactionResponse builds the API representation of a transaction.
+func NewTransactionResponse(transaction *Transaction) TransactionResponse {
+	return TransactionResponse{
+		ID:                   transaction.ID,
+		SourceAccountID:      transaction.SourceAccountID,
+		DestinationAccountID: transaction.DestinationAccountID,
+		Amount:               transaction.Amount,
+		Currency:             transaction.Currency,
+		DestinationAmount:    transaction.DestinationAmount,
+		DestinationCurrency:  transaction.DestinationCurrency,
+		FXRateID:             transaction.FXRateID,
+		FXRate:               transaction.FXRate,
+		FXRoundingAdjustment: transaction.FXRoundingAdjustment,
+		ReversalOfID:         transaction.ReversalOfID,
+		ReversedAmount:       transaction.ReversedAmount,
+		Reference:            transaction.Reference,
+		Description:          transaction.Description,
+		Metadata:             transaction.Metadata,
+		Status:               transaction.Status,
+		FailureReason:        transaction.FailureReason,
+		CreatedAt:            transaction.CreatedAt,
+	}
+}
+
+// ReverseTransactionRequest reverses all or part of a transfer. Amount is
+// in the original transfer's source currency; nil reverses whatever has not
+// been reversed yet.
+type ReverseTransactionRequest struct {
+	Amount *money.Amount `json:"amount"`
+
+	// ExpectedETag is checked against the account the reversal takes money
+	// from, the original destination.
+	ExpectedETag *string `json:"-"`
+}
+
+type CreateHoldRequest struct {
+	AccountID string       `json:"account_id"`
+	Amount    money.Amount `json:"amount"`
+	// ExpiresInSeconds defaults to DefaultHoldTTL when zero.
+	ExpiresInSeconds int64 `json:"expires_in_seconds"`
+
+	// ExpectedETag is checked against the held account, as in
+	// SetOverdraftLimitRequest.
+	ExpectedETag *string `json:"-"`
+}
+
+// CaptureHoldRequest captures a hold into a transfer. A nil Amount captures
+// the full held amount.
+type CaptureHoldRequest struct {
+	DestinationAccountID string        `json:"destination_account_id"`
+	Amount               *money.Amount `json:"amount"`
+
+	// ExpectedETag is checked against the held account.
+	ExpectedETag *string `json:"-"`
+}
+
+// VoidHoldRequest carries the preconditions of voiding a hold; the void
+// itself takes no body.
+type VoidHoldRequest struct {
+	// ExpectedETag is checked against the held account.
+	ExpectedETag *string `json:"-"`
+}
+
+type HoldResponse struct {
+	ID             string         `json:"id"`
+	AccountID      string         `json:"account_id"`
+	Amount         money.Amount   `json:"amount"`
+	Currency       money.Currency `json:"currency"`
+	Status         string         `json:"status"`
+	CapturedAmount *money.Amount  `json:"captured_amount,omitempty"`
+	TransactionID  *string        `json:"transaction_id,omitempty"`
+	ExpiresAt      time.Time      `json:"expires_at"`
+	CreatedAt      time.Time      `json:"created_at"`
+}
+
+type CreateFXRateRequest struct {
+	BaseCurrency  string     `json:"base_currency"`
+	QuoteCurrency string     `json:"quote_currency"`
+	Rate          money.Rate `json:"rate"`
+	ValidFrom     time.Time  `json:"valid_from"`
+	ValidTo       *time.Time `json:"valid_to"`
+}
+
+type UploadFXRatesRequest struct {
+	Rates []CreateFXRateRequest `json:"rates"`
+}
+
+type FXRateResponse struct {
+	ID            string         `json:"id"`
+	BaseCurrency  money.Currency `json:"base_currency"`
+	QuoteCurrency money.Currency `json:"quote_currency"`
+	Rate          money.Rate     `json:"rate"`
+	ValidFrom     time.Time      `json:"valid_from"`
+	ValidTo       *time.Time     `json:"valid_to"`
 }
 
 type ErrorResponse struct {
@@ -71,6 +667,83 @@ type ErrorResponse struct {
 }
 
 type AccountBalanceSnapshot struct {
-	ID      string  `json:"id"`
-	Balance float64 `json:"balance"`
+	ID       string         `json:"id"`
+	Currency money.Currency `json:"currency"`
+	Balance  money.Amount   `json:"balance"`
+}
+
+// SetAccountStatusRequest moves an account to a new status. Reason is
+// required and recorded in the audit log.
+type SetAccountStatusRequest struct {
+	Status string `json:"status"`
+	Reason string `json:"reason"`
+
+	// ExpectedETag works as in SetOverdraftLimitRequest.
+	ExpectedETag *string `json:"-"`
+}
+
+type AccountStatusSnapshot struct {
+	ID     string `json:"id"`
+	Status string `json:"status"`
+	Reason string `json:"reason,omitempty"`
+}
+
+type TransactionReversalSnapshot struct {
+	ID             string         `json:"id"`
+	Amount         money.Amount   `json:"amount"`
+	Currency       money.Currency `json:"currency"`
+	ReversedAmount money.Amount   `json:"reversed_amount"`
+}
+
+type AccountOverdraftSnapshot struct {
+	ID             string         `json:"id"`
+	Currency       money.Currency `json:"currency"`
+	OverdraftLimit money.Amount   `json:"overdraft_limit"`
+}
+
+// TransactionSnapshot is the audit representation of a transaction.
+type TransactionSnapshot struct {
+	ID                   string         `json:"id"`
+	SourceAccountID      string         `json:"source_account_id"`
+	DestinationAccountID string         `json:"destination_account_id"`
+	Amount               money.Amount   `json:"amount"`
+	Currency             money.Currency `json:"currency,omitempty"`
+	DestinationAmount    money.Amount   `json:"destination_amount,omitempty"`
+	DestinationCurrency  money.Currency `json:"destination_currency,omitempty"`
+	FXRateID             *string        `json:"fx_rate_id,omitempty"`
+	FXRate               *money.Rate    `json:"fx_rate,omitempty"`
+	FXRoundingAdjustment *string        `json:"fx_rounding_adjustment,omitempty"`
+	FXRoundingMode       string         `json:"fx_rounding_mode,omitempty"`
+	ReversalOfID         *string        `json:"reversal_of_id,omitempty"`
+	Reference            *string        `json:"reference,omitempty"`
+	Description          string         `json:"description,omitempty"`
+	Metadata             Metadata       `json:"metadata,omitempty"`
+	Status               string         `json:"status"`
+	FailureReason        *string        `json:"failure_reason,omitempty"`
+}
+
+// NewTransactionSnapshot captures transaction for the audit log.
+func NewTransactionSnapshot(transaction *Transaction) TransactionSnapshot {
+	snapshot := TransactionSnapshot{
+		ID:                   transaction.ID,
+		SourceAccountID:      transaction.SourceAccountID,
+		DestinationAccountID: transaction.DestinationAccountID,
+		Amount:               transaction.Amount,
+		Currency:             transaction.Currency,
+		DestinationAmount:    transaction.DestinationAmount,
+		DestinationCurrency:  transaction.DestinationCurrency,
+		FXRateID:             transaction.FXRateID,
+		FXRate:               transaction.FXRate,
+		FXRoundingAdjustment: transaction.FXRoundingAdjustment,
+		ReversalOfID:         transaction.ReversalOfID,
+		Reference:            transaction.Reference,
+		Description:          transaction.Description,
+		Metadata:             transaction.Metadata,
+		Status:               transaction.Status,
+		FailureReason:        transaction.FailureReason,
+	}
+	if transaction.FXRate != nil {
+		snapshot.FXRoundingMode = money.RoundingMode
+	}
+	return snapshot
 }
@@ -0,0 +1,120 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// WebhookSubscription asks for the events of EventTypes to be POSTed to URL,
+// signed with Secret. No EventTypes means every event. Secret is only
+// returned when the subscription is created.
+type WebhookSubscription struct {
+	ID          string            `json:"id"`
+	URL         string            `json:"url"`
+	EventTypes  []DomainEventType `json:"event_types"`
+	Secret      string            `json:"secret,omitempty"`
+	Description string            `json:"description,omitempty"`
+	Active      bool              `json:"active"`
+	CreatedAt   time.Time         `json:"created_at"`
+	UpdatedAt   time.Time         `json:"updated_at"`
+}
+
+// Matches reports whether the subscription wants events of eventType.
+func (s *WebhookSubscription) Matches(eventType DomainEventType) bool {
+	if !s.Active {
+		return false
+	}
+	if len(s.EventTypes) == 0 {
+		return true
+	}
+	for _, t := range s.EventTypes {
+		if t == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// CreateWebhookSubscriptionRequest creates a subscription. A secret is
+// generated when none is given.
+type CreateWebhookSubscriptionRequest struct {
+	URL         string            `json:"url"`
+	EventTypes  []DomainEventType `json:"event_types"`
+	Secret      string            `json:"secret,omitempty"`
+	Description string            `json:"description,omitempty"`
+}
+
+// UpdateWebhookSubscriptionRequest replaces a subscription's URL, event
+// filter and description. Active is left alone when nil.
+type UpdateWebhookSubscriptionRequest struct {
+	URL         string            `json:"url"`
+	EventTypes  []DomainEventType `json:"event_types"`
+	Description string            `json:"description,omitempty"`
+	Active      *bool             `json:"active,omitempty"`
+}
+
+type WebhookSubscriptionListResponse struct {
+	Webhooks []*WebhookSubscription `json:"webhooks"`
+}
+
+// Webhook delivery statuses. A delivery is PENDING until the receiver
+// accepts it, or until it runs out of attempts and becomes FAILED. A manual
+// redelivery makes it PENDING again with a fresh set of retries.
+const (
+	WebhookDeliveryStatusPending   = "PENDING"
+	WebhookDeliveryStatusSucceeded = "SUCCEEDED"
+	WebhookDeliveryStatusFailed    = "FAILED"
+)
+
+// WebhookDelivery is one event to be delivered to one subscription. Payload
+// is the event as POSTed. NextAttemptAt is set while the delivery is
+// PENDING, and LeasedUntil while a dispatcher is attempting it.
+// RetryBudgetStart is the attempt count when its current set of retries
+// began, at creation or at the last manual redelivery.
+type WebhookDelivery struct {
+	ID               string                    `json:"id"`
+	SubscriptionID   string                    `json:"subscription_id"`
+	EventID          string                    `json:"event_id"`
+	EventType        DomainEventType           `json:"event_type"`
+	Payload          json.RawMessage           `json:"payload"`
+	Status           string                    `json:"status"`
+	Attempts         int                       `json:"attempts"`
+	RetryBudgetStart int                       `json:"-"`
+	NextAttemptAt    *time.Time                `json:"next_attempt_at,omitempty"`
+	LeasedUntil      *time.Time                `json:"leased_until,omitempty"`
+	LastResponseCode *int                      `json:"last_response_code,omitempty"`
+	LastError        *string                   `json:"last_error,omitempty"`
+	DeliveredAt      *time.Time                `json:"delivered_at,omitempty"`
+	CreatedAt        time.Time                 `json:"created_at"`
+	UpdatedAt        time.Time                 `json:"updated_at"`
+	AttemptLog       []*WebhookDeliveryAttempt `json:"attempt_log,omitempty"`
+}
+
+// WebhookDeliveryAttempt is one POST of a delivery. ResponseCode is missing
+// when no response came back, and Error says why the attempt failed.
+type WebhookDeliveryAttempt struct {
+	Attempt      int       `json:"attempt"`
+	RequestedAt  time.Time `json:"requested_at"`
+	DurationMs   int64     `json:"duration_ms"`
+	ResponseCode *int      `json:"response_code,omitempty"`
+	Error        *string   `json:"error,omitempty"`
+}
+
+// Succeeded reports whether the receiver accepted the attempt with a 2xx.
+func (a *WebhookDeliveryAttempt) Succeeded() bool {
+	return a.ResponseCode != nil && *a.ResponseCode >= 200 && *a.ResponseCode < 300
+}
+
+// WebhookDeliveryFilter narrows a delivery log query. Zero fields don't
+// filter.
+type WebhookDeliveryFilter struct {
+	SubscriptionID string
+	Status         string
+	After          *Cursor
+	Limit          int
+}
+
+type WebhookDeliveryListResponse struct {
+	Deliveries []*WebhookDelivery `json:"deliveries"`
+	NextCursor string             `json:"next_cursor,omitempty"`
+}
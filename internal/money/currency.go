@@ -0,0 +1,68 @@
+package money
+
+import (
+	"errors"
+	"strings"
+)
+
+var ErrUnknownCurrency = errors.New("unknown currency code")
+
+// Currency is an ISO 4217 alphabetic currency code such as "USD".
+type Currency string
+
+// exponents maps each supported currency to its ISO 4217 minor-unit
+// exponent, i.e. the number of decimal places amounts may carry.
+// No supported currency may exceed Scale.
+var exponents = map[Currency]int{
+	"AED": 2,
+	"AUD": 2,
+	"BHD": 3,
+	"BRL": 2,
+	"CAD": 2,
+	"CHF": 2,
+	"CNY": 2,
+	"DKK": 2,
+	"EUR": 2,
+	"GBP": 2,
+	"HKD": 2,
+	"IDR": 2,
+	"INR": 2,
+	"JOD": 3,
+	"JPY": 0,
+	"KRW": 0,
+	"KWD": 3,
+	"MXN": 2,
+	"NOK": 2,
+	"NZD": 2,
+	"OMR": 3,
+	"SAR": 2,
+	"SEK": 2,
+	"SGD": 2,
+	"TND": 3,
+	"USD": 2,
+	"ZAR": 2,
+}
+
+// ParseCurrency normalises code to upper case and checks that it is a
+// supported ISO 4217 currency.
+func ParseCurrency(code string) (Currency, error) {
+	c := Currency(strings.ToUpper(strings.TrimSpace(code)))
+	if _, ok := exponents[c]; !ok {
+		return "", ErrUnknownCurrency
+	}
+	return c, nil
+}
+
+// Exponent returns the number of decimal places amounts in c may carry.
+func (c Currency) Exponent() int {
+	return exponents[c]
+}
+
+func (c Currency) String() string {
+	return string(c)
+}
+
+// FitsCurrency reports whether a can be expressed in whole minor units of c.
+func (a Amount) FitsCurrency(c Currency) bool {
+	return a.Decimals() <= c.Exponent()
+}
@@ -0,0 +1,246 @@
+package money
+
+import (
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Scale is the number of fractional decimal digits an Amount can hold.
+// It is deliberately finer than any precision the API accepts so that
+// over-precise input can be detected and rejected by validation instead
+// of being silently rounded.
+const Scale = 4
+
+// maxIntegerDigits bounds the integer part of an Amount so that adding or
+// subtracting two valid amounts can never overflow int64.
+const maxIntegerDigits = 14
+
+var (
+	ErrMalformed   = errors.New("malformed decimal amount")
+	ErrTooPrecise  = errors.New("amount has too many decimal places")
+	ErrOutOfRange  = errors.New("amount is out of range")
+	errUnsupported = errors.New("unsupported amount source type")
+)
+
+// Amount is an exact decimal quantity of money, stored as an integer number
+// of 10^-Scale units. The zero value is zero.
+type Amount int64
+
+var pow10 = [...]int64{1, 10, 100, 1000, 10000}
+
+// New returns the Amount for a whole number of currency units.
+func New(units int64) Amount {
+	return Amount(units * pow10[Scale])
+}
+
+// Parse converts a plain decimal string such as "-12.50" into an Amount.
+// Exponent notation is not accepted.
+func Parse(s string) (Amount, error) {
+	units, err := parseUnits(s, Scale, maxIntegerDigits)
+	if err != nil {
+		return 0, err
+	}
+	return Amount(units), nil
+}
+
+// parseUnits parses a plain decimal string into an integer count of
+// 10^-scale units.
+func parseUnits(s string, scale, maxIntDigits int) (int64, error) {
+	if s == "" {
+		return 0, ErrMalformed
+	}
+
+	neg := false
+	switch s[0] {
+	case '-':
+		neg = true
+		s = s[1:]
+	case '+':
+		s = s[1:]
+	}
+
+	intPart, fracPart, hasPoint := strings.Cut(s, ".")
+	if intPart == "" && fracPart == "" {
+		return 0, ErrMalformed
+	}
+	if hasPoint && fracPart == "" {
+		return 0, ErrMalformed
+	}
+	if !isDigits(intPart) || !isDigits(fracPart) {
+		return 0, ErrMalformed
+	}
+
+	intPart = strings.TrimLeft(intPart, "0")
+	if len(intPart) > maxIntDigits {
+		return 0, ErrOutOfRange
+	}
+
+	fracPart = strings.TrimRight(fracPart, "0")
+	if len(fracPart) > scale {
+		return 0, ErrTooPrecise
+	}
+	fracPart += strings.Repeat("0", scale-len(fracPart))
+
+	units, err := strconv.ParseInt("0"+intPart+fracPart, 10, 64)
+	if err != nil {
+		return 0, ErrOutOfRange
+	}
+	if neg {
+		units = -units
+	}
+	return units, nil
+}
+
+// MustParse is like Parse but panics on error. Intended for constants.
+func MustParse(s string) Amount {
+	a, err := Parse(s)
+	if err != nil {
+		panic(fmt.Sprintf("money: MustParse(%q): %v", s, err))
+	}
+	return a
+}
+
+func isDigits(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+func (a Amount) Add(b Amount) Amount { return a + b }
+
+func (a Amount) Sub(b Amount) Amount { return a - b }
+
+func (a Amount) Neg() Amount { return -a }
+
+// Cmp returns -1, 0 or +1 depending on whether a is less than, equal to or
+// greater than b.
+func (a Amount) Cmp(b Amount) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	default:
+		return 0
+	}
+}
+
+func (a Amount) IsZero() bool { return a == 0 }
+
+func (a Amount) IsPositive() bool { return a > 0 }
+
+func (a Amount) IsNegative() bool { return a < 0 }
+
+// Decimals reports how many fractional digits are needed to represent a
+// exactly, e.g. 1.50 needs 1 and 1.05 needs 2.
+func (a Amount) Decimals() int {
+	frac := int64(a) % pow10[Scale]
+	if frac == 0 {
+		return 0
+	}
+	d := Scale
+	for frac%10 == 0 {
+		frac /= 10
+		d--
+	}
+	return d
+}
+
+// Format renders a with at least minDecimals fractional digits, adding more
+// when needed so that the value is never truncated.
+func (a Amount) Format(minDecimals int) string {
+	return formatUnits(strconv.FormatInt(int64(a), 10), Scale, minDecimals)
+}
+
+// formatUnits renders the base-10 integer in digits, interpreted as a count
+// of 10^-scale units, with trailing fractional zeros trimmed down to
+// minDecimals.
+func formatUnits(digits string, scale, minDecimals int) string {
+	sign := ""
+	if strings.HasPrefix(digits, "-") {
+		sign = "-"
+		digits = digits[1:]
+	}
+	if len(digits) <= scale {
+		digits = strings.Repeat("0", scale-len(digits)+1) + digits
+	}
+
+	whole := digits[:len(digits)-scale]
+	frac := digits[len(digits)-scale:]
+
+	keep := len(strings.TrimRight(frac, "0"))
+	keep = max(keep, min(minDecimals, scale))
+	if keep == 0 {
+		return sign + whole
+	}
+	return sign + whole + "." + frac[:keep]
+}
+
+// String renders a with at least two fractional digits, e.g. "1000.00".
+func (a Amount) String() string {
+	return a.Format(2)
+}
+
+// MarshalJSON encodes the amount as a JSON string to avoid any float
+// conversion on the client side.
+func (a Amount) MarshalJSON() ([]byte, error) {
+	return []byte(strconv.Quote(a.String())), nil
+}
+
+// UnmarshalJSON accepts either a JSON string ("12.34") or a bare JSON number
+// (12.34). Numbers are parsed from their literal text, never via float64.
+func (a *Amount) UnmarshalJSON(data []byte) error {
+	s := string(data)
+	if s == "null" {
+		return nil
+	}
+	if strings.HasPrefix(s, `"`) {
+		unquoted, err := strconv.Unquote(s)
+		if err != nil {
+			return ErrMalformed
+		}
+		s = unquoted
+	}
+
+	parsed, err := Parse(s)
+	if err != nil {
+		return err
+	}
+	*a = parsed
+	return nil
+}
+
+// Scan implements sql.Scanner for NUMERIC/DECIMAL columns.
+func (a *Amount) Scan(src interface{}) error {
+	var s string
+	switch v := src.(type) {
+	case []byte:
+		s = string(v)
+	case string:
+		s = v
+	case int64:
+		*a = New(v)
+		return nil
+	default:
+		return fmt.Errorf("%w: %T", errUnsupported, src)
+	}
+
+	parsed, err := Parse(s)
+	if err != nil {
+		return fmt.Errorf("failed to scan amount %q: %w", s, err)
+	}
+	*a = parsed
+	return nil
+}
+
+// Value implements driver.Valuer, sending the amount as an exact decimal
+// string so that Postgres never sees a float.
+func (a Amount) Value() (driver.Value, error) {
+	return a.Format(0), nil
+}
@@ -0,0 +1,158 @@
+package money
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// RateScale is the number of fractional digits an exchange Rate can hold.
+const RateScale = 10
+
+// maxRateIntegerDigits keeps rates within DECIMAL(20,10).
+const maxRateIntegerDigits = 8
+
+// Rate is an exact exchange rate: one unit of the base currency buys Rate
+// units of the quote currency. It is stored as an integer number of
+// 10^-RateScale units.
+type Rate int64
+
+// RoundingMode names the rounding applied when converting between currencies.
+const RoundingMode = "HALF_EVEN"
+
+// ParseRate converts a plain decimal string such as "1.0853" into a Rate.
+func ParseRate(s string) (Rate, error) {
+	units, err := parseUnits(s, RateScale, maxRateIntegerDigits)
+	if err != nil {
+		return 0, err
+	}
+	return Rate(units), nil
+}
+
+func (r Rate) IsPositive() bool { return r > 0 }
+
+func (r Rate) String() string {
+	return formatUnits(strconv.FormatInt(int64(r), 10), RateScale, 1)
+}
+
+func (r Rate) MarshalJSON() ([]byte, error) {
+	return []byte(strconv.Quote(r.String())), nil
+}
+
+// UnmarshalJSON accepts either a JSON string or a bare JSON number, parsed
+// from its literal text.
+func (r *Rate) UnmarshalJSON(data []byte) error {
+	s := string(data)
+	if s == "null" {
+		return nil
+	}
+	if strings.HasPrefix(s, `"`) {
+		unquoted, err := strconv.Unquote(s)
+		if err != nil {
+			return ErrMalformed
+		}
+		s = unquoted
+	}
+
+	parsed, err := ParseRate(s)
+	if err != nil {
+		return err
+	}
+	*r = parsed
+	return nil
+}
+
+func (r *Rate) Scan(src interface{}) error {
+	var s string
+	switch v := src.(type) {
+	case []byte:
+		s = string(v)
+	case string:
+		s = v
+	default:
+		return fmt.Errorf("%w: %T", errUnsupported, src)
+	}
+
+	parsed, err := ParseRate(s)
+	if err != nil {
+		return fmt.Errorf("failed to scan rate %q: %w", s, err)
+	}
+	*r = parsed
+	return nil
+}
+
+func (r Rate) Value() (driver.Value, error) {
+	return formatUnits(strconv.FormatInt(int64(r), 10), RateScale, 0), nil
+}
+
+// Conversion is the outcome of converting an amount at a given rate.
+type Conversion struct {
+	Rate Rate
+	// Amount is the converted amount, rounded to the target currency's
+	// minor unit using RoundingMode.
+	Amount Amount
+	// RoundingAdjustment is Amount minus the exact, unrounded product, as
+	// an exact decimal string. It is "0" when no rounding was needed.
+	RoundingAdjustment string
+
+	// exact is the unrounded product at Scale+RateScale.
+	exact *big.Int
+}
+
+// WithAmount returns c settled at a instead of the rounded amount, with
+// RoundingAdjustment recomputed against the same exact product. It is used
+// when the converted amount is fixed by other means, such as the remainder
+// of a partially reversed transfer. c must come from Convert.
+func (c Conversion) WithAmount(a Amount) Conversion {
+	settled := new(big.Int).Mul(big.NewInt(int64(a)), new(big.Int).Exp(big.NewInt(10), big.NewInt(RateScale), nil))
+	adjustment := settled.Sub(settled, c.exact)
+
+	c.Amount = a
+	c.RoundingAdjustment = formatUnits(adjustment.String(), Scale+RateScale, 0)
+	return c
+}
+
+// Convert multiplies a by r and rounds the result half-to-even to the
+// minor unit of the target currency. It fails with ErrOutOfRange if the
+// result does not fit in an Amount.
+func Convert(a Amount, r Rate, to Currency) (Conversion, error) {
+	const exactScale = Scale + RateScale
+
+	exact := new(big.Int).Mul(big.NewInt(int64(a)), big.NewInt(int64(r)))
+
+	// Drop to the target currency's minor unit with half-even rounding.
+	divisor := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(exactScale-to.Exponent())), nil)
+	quotient, remainder := new(big.Int).QuoRem(exact, divisor, new(big.Int))
+
+	twiceRemainder := new(big.Int).Abs(remainder)
+	twiceRemainder.Lsh(twiceRemainder, 1)
+	switch cmp := twiceRemainder.Cmp(divisor); {
+	case cmp > 0, cmp == 0 && quotient.Bit(0) == 1:
+		if exact.Sign() < 0 {
+			quotient.Sub(quotient, big.NewInt(1))
+		} else {
+			quotient.Add(quotient, big.NewInt(1))
+		}
+	}
+
+	units := new(big.Int).Mul(quotient, big.NewInt(pow10[Scale-to.Exponent()]))
+	if new(big.Int).Abs(units).Cmp(maxUnits) >= 0 {
+		return Conversion{}, ErrOutOfRange
+	}
+
+	rounded := new(big.Int).Mul(quotient, divisor)
+	adjustment := new(big.Int).Sub(rounded, exact)
+
+	return Conversion{
+		Rate:               r,
+		Amount:             Amount(units.Int64()),
+		RoundingAdjustment: formatUnits(adjustment.String(), exactScale, 0),
+		exact:              exact,
+	}, nil
+}
+
+// maxUnits is the exclusive upper bound on the magnitude of an Amount's
+// units, matching the limit enforced by Parse.
+var maxUnits = new(big.Int).Exp(big.NewInt(10), big.NewInt(maxIntegerDigits+Scale), nil)
@@ -4,19 +4,61 @@ import (
 	"context"
 	"database/sql"
 	"fmt"
+	"strings"
 
 	"github.com/lib/pq"
 
 	"github.com/riteshkumar/internal-transfers/internal/errors"
 	"github.com/riteshkumar/internal-transfers/internal/models"
+	"github.com/riteshkumar/internal-transfers/internal/money"
 )
 
+// AccountRepository stores accounts. Every update bumps the account's
+// version; callers holding the row locked mirror this by incrementing
+// Version on their copy.
 type AccountRepository interface {
-	CreateAccount(ctx context.Context, account *models.Account) error
+	CreateAccount(ctx context.Context, tx *sql.Tx, account *models.Account) error
+	EnsureSystemAccount(ctx context.Context, tx *sql.Tx, id string, currency money.Currency) error
 	GetAccountByID(ctx context.Context, id string) (*models.Account, error)
 	GetAccountByIDForUpdate(ctx context.Context, tx *sql.Tx, id string) (*models.Account, error)
-	UpdateAccountBalance(ctx context.Context, tx *sql.Tx, id string, newBalance float64) error
+	GetAccountsByIDs(ctx context.Context, ids []string) ([]*models.Account, error)
+	UpdateAccountBalance(ctx context.Context, tx *sql.Tx, id string, newBalance money.Amount) error
+	UpdateOverdraftLimit(ctx context.Context, tx *sql.Tx, id string, limit money.Amount) error
+	UpdateAccountStatus(ctx context.Context, tx *sql.Tx, id string, status string) error
+	BumpVersion(ctx context.Context, tx *sql.Tx, id string) error
 	AccountExists(ctx context.Context, id string) (bool, error)
+	ListAccounts(ctx context.Context, filter models.AccountListFilter) ([]*models.Account, error)
+}
+
+// accountColumns lists the columns read by scanAccount, in order. The held
+// balance is derived from active, unexpired holds; lapsed holds are active
+// ones past their expiry that the expiry job has not reached yet.
+const accountColumns = `id, type, currency, status, balance, overdraft_limit,
+		COALESCE((SELECT SUM(h.amount) FROM holds h
+			WHERE h.account_id = accounts.id AND h.status = 'ACTIVE' AND h.expires_at > CURRENT_TIMESTAMP), 0) AS held_balance,
+		(SELECT COUNT(*) FROM holds h
+			WHERE h.account_id = accounts.id AND h.status = 'ACTIVE' AND h.expires_at <= CURRENT_TIMESTAMP) AS lapsed_holds,
+		version, created_at, updated_at`
+
+func scanAccount(row rowScanner) (*models.Account, error) {
+	account := &models.Account{}
+	err := row.Scan(
+		&account.ID,
+		&account.Type,
+		&account.Currency,
+		&account.Status,
+		&account.Balance,
+		&account.OverdraftLimit,
+		&account.HeldBalance,
+		&account.LapsedHolds,
+		&account.Version,
+		&account.CreatedAt,
+		&account.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return account, nil
 }
 
 type PostgresAccountRepository struct {
@@ -27,13 +69,22 @@ func NewAccountRepository(db *sql.DB) *PostgresAccountRepository {
 	return &PostgresAccountRepository{db: db}
 }
 
-func (r *PostgresAccountRepository) CreateAccount(ctx context.Context, account *models.Account) error {
-	query := `INSERT INTO accounts (id, balance, created_at, updated_at)
-		VALUES ($1, $2, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)
-		RETURNING created_at, updated_at`
+// CreateAccount inserts a new account. Balances only ever change through
+// journal postings, so callers post any opening balance separately.
+func (r *PostgresAccountRepository) CreateAccount(ctx context.Context, tx *sql.Tx, account *models.Account) error {
+	if account.Type == "" {
+		account.Type = models.AccountTypeCustomer
+	}
+	if account.Status == "" {
+		account.Status = models.AccountStatusActive
+	}
+
+	query := `INSERT INTO accounts (id, type, currency, status, balance, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)
+		RETURNING version, created_at, updated_at`
 
-	err := r.db.QueryRowContext(ctx, query, account.ID, account.Balance).
-		Scan(&account.CreatedAt, &account.UpdatedAt)
+	err := tx.QueryRowContext(ctx, query, account.ID, account.Type, account.Currency, account.Status, account.Balance).
+		Scan(&account.Version, &account.CreatedAt, &account.UpdatedAt)
 
 	if err != nil {
 		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" {
@@ -44,12 +95,23 @@ func (r *PostgresAccountRepository) CreateAccount(ctx context.Context, account *
 	return nil
 }
 
+// EnsureSystemAccount creates the system account id with a zero balance if it
+// does not exist yet.
+func (r *PostgresAccountRepository) EnsureSystemAccount(ctx context.Context, tx *sql.Tx, id string, currency money.Currency) error {
+	query := `INSERT INTO accounts (id, type, currency, balance, created_at, updated_at)
+		VALUES ($1, $2, $3, 0, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)
+		ON CONFLICT (id) DO NOTHING`
+
+	if _, err := tx.ExecContext(ctx, query, id, models.AccountTypeSystem, currency); err != nil {
+		return fmt.Errorf("failed to ensure system account: %w", err)
+	}
+	return nil
+}
+
 func (r *PostgresAccountRepository) GetAccountByID(ctx context.Context, id string) (*models.Account, error) {
-	query := `SELECT id, balance, created_at, updated_at FROM accounts WHERE id = $1`
+	query := `SELECT ` + accountColumns + ` FROM accounts WHERE id = $1`
 
-	account := &models.Account{}
-	err := r.db.QueryRowContext(ctx, query, id).
-		Scan(&account.ID, &account.Balance, &account.CreatedAt, &account.UpdatedAt)
+	account, err := scanAccount(r.db.QueryRowContext(ctx, query, id))
 
 	if err != nil {
 		if err == sql.ErrNoRows {
@@ -61,11 +123,9 @@ func (r *PostgresAccountRepository) GetAccountByID(ctx context.Context, id strin
 }
 
 func (r *PostgresAccountRepository) GetAccountByIDForUpdate(ctx context.Context, tx *sql.Tx, id string) (*models.Account, error) {
-	query := `SELECT id, balance, created_at, updated_at FROM accounts WHERE id = $1 FOR UPDATE`
+	query := `SELECT ` + accountColumns + ` FROM accounts WHERE id = $1 FOR UPDATE`
 
-	account := &models.Account{}
-	err := tx.QueryRowContext(ctx, query, id).
-		Scan(&account.ID, &account.Balance, &account.CreatedAt, &account.UpdatedAt)
+	account, err := scanAccount(tx.QueryRowContext(ctx, query, id))
 
 	if err != nil {
 		if err == sql.ErrNoRows {
@@ -77,8 +137,8 @@ func (r *PostgresAccountRepository) GetAccountByIDForUpdate(ctx context.Context,
 	return account, nil
 }
 
-func (r *PostgresAccountRepository) UpdateAccountBalance(ctx context.Context, tx *sql.Tx, id string, newBalance float64) error {
-	query := `UPDATE accounts SET balance = $1, updated_at = CURRENT_TIMESTAMP WHERE id = $2`
+func (r *PostgresAccountRepository) UpdateAccountBalance(ctx context.Context, tx *sql.Tx, id string, newBalance money.Amount) error {
+	query := `UPDATE accounts SET balance = $1, version = version + 1, updated_at = CURRENT_TIMESTAMP WHERE id = $2`
 
 	result, err := tx.ExecContext(ctx, query, newBalance, id)
 	if err != nil {
@@ -97,6 +157,68 @@ func (r *PostgresAccountRepository) UpdateAccountBalance(ctx context.Context, tx
 	return nil
 }
 
+func (r *PostgresAccountRepository) UpdateOverdraftLimit(ctx context.Context, tx *sql.Tx, id string, limit money.Amount) error {
+	query := `UPDATE accounts SET overdraft_limit = $1, version = version + 1, updated_at = CURRENT_TIMESTAMP WHERE id = $2`
+
+	result, err := tx.ExecContext(ctx, query, limit, id)
+	if err != nil {
+		return fmt.Errorf("failed to update overdraft limit: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected after updating overdraft limit: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return errors.ErrAccountNotFound
+	}
+
+	return nil
+}
+
+func (r *PostgresAccountRepository) UpdateAccountStatus(ctx context.Context, tx *sql.Tx, id string, status string) error {
+	query := `UPDATE accounts SET status = $1, version = version + 1, updated_at = CURRENT_TIMESTAMP WHERE id = $2`
+
+	result, err := tx.ExecContext(ctx, query, status, id)
+	if err != nil {
+		return fmt.Errorf("failed to update account status: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected after updating account status: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return errors.ErrAccountNotFound
+	}
+
+	return nil
+}
+
+// BumpVersion marks an account as changed by something stored outside its
+// row, such as a hold that alters its available balance.
+func (r *PostgresAccountRepository) BumpVersion(ctx context.Context, tx *sql.Tx, id string) error {
+	query := `UPDATE accounts SET version = version + 1, updated_at = CURRENT_TIMESTAMP WHERE id = $1`
+
+	result, err := tx.ExecContext(ctx, query, id)
+	if err != nil {
+		return fmt.Errorf("failed to bump account version: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected after bumping account version: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return errors.ErrAccountNotFound
+	}
+
+	return nil
+}
+
 func (r *PostgresAccountRepository) AccountExists(ctx context.Context, id string) (bool, error) {
 	query := `SELECT EXISTS(SELECT 1 FROM accounts WHERE id = $1)`
 
@@ -108,3 +230,105 @@ func (r *PostgresAccountRepository) AccountExists(ctx context.Context, id string
 
 	return exists, nil
 }
+
+// GetAccountsByIDs returns the customer accounts among ids that exist, in
+// no particular order, with a single query. System accounts are left out,
+// like in ListAccounts.
+func (r *PostgresAccountRepository) GetAccountsByIDs(ctx context.Context, ids []string) ([]*models.Account, error) {
+	query := `SELECT ` + accountColumns + `
+		FROM accounts WHERE id = ANY($1) AND type <> $2`
+
+	rows, err := r.db.QueryContext(ctx, query, pq.Array(ids), models.AccountTypeSystem)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get accounts by IDs: %w", err)
+	}
+	defer rows.Close()
+
+	accounts := make([]*models.Account, 0, len(ids))
+	for rows.Next() {
+		account, err := scanAccount(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan account: %w", err)
+		}
+		accounts = append(accounts, account)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over accounts: %w", err)
+	}
+	return accounts, nil
+}
+
+// accountSortColumns maps sort keys to their column and the type their
+// cursor value is cast to.
+var accountSortColumns = map[string]struct{ column, cast string }{
+	models.AccountSortCreatedAt: {"created_at", "timestamp"},
+	models.AccountSortUpdatedAt: {"updated_at", "timestamp"},
+	models.AccountSortBalance:   {"balance", "numeric"},
+}
+
+// ListAccounts returns up to filter.Limit customer accounts ordered by
+// filter.SortBy and then id, starting after filter.After.
+func (r *PostgresAccountRepository) ListAccounts(ctx context.Context, filter models.AccountListFilter) ([]*models.Account, error) {
+	sort, ok := accountSortColumns[filter.SortBy]
+	if !ok {
+		return nil, fmt.Errorf("unknown account sort key %q", filter.SortBy)
+	}
+
+	var args []interface{}
+	arg := func(v interface{}) string {
+		args = append(args, v)
+		return fmt.Sprintf("$%d", len(args))
+	}
+
+	conditions := []string{"type <> " + arg(models.AccountTypeSystem)}
+	if filter.IDPrefix != "" {
+		escaped := strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(filter.IDPrefix)
+		conditions = append(conditions, "id LIKE "+arg(escaped+"%"))
+	}
+	if filter.MinBalance != nil {
+		conditions = append(conditions, "balance >= "+arg(*filter.MinBalance))
+	}
+	if filter.MaxBalance != nil {
+		conditions = append(conditions, "balance <= "+arg(*filter.MaxBalance))
+	}
+	if filter.CreatedFrom != nil {
+		conditions = append(conditions, "created_at >= "+arg(*filter.CreatedFrom))
+	}
+	if filter.CreatedTo != nil {
+		conditions = append(conditions, "created_at < "+arg(*filter.CreatedTo))
+	}
+
+	direction, comparison := "ASC", ">"
+	if filter.Descending {
+		direction, comparison = "DESC", "<"
+	}
+	if filter.After != nil {
+		conditions = append(conditions, fmt.Sprintf("(%s, id) %s (%s::%s, %s)",
+			sort.column, comparison, arg(filter.After.Value), sort.cast, arg(filter.After.ID)))
+	}
+
+	query := `SELECT ` + accountColumns + `
+		FROM accounts
+		WHERE ` + strings.Join(conditions, " AND ") + `
+		ORDER BY ` + sort.column + ` ` + direction + `, id ` + direction + `
+		LIMIT ` + arg(filter.Limit)
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list accounts: %w", err)
+	}
+	defer rows.Close()
+
+	var accounts []*models.Account
+	for rows.Next() {
+		account, err := scanAccount(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan account: %w", err)
+		}
+		accounts = append(accounts, account)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over accounts: %w", err)
+	}
+	return accounts, nil
+}
@@ -5,109 +5,458 @@ import (
 	"database/sql"
 	"encoding/json"
 	"fmt"
+	"strconv"
+	"strings"
 
+	"github.com/google/uuid"
+
+	"github.com/riteshkumar/internal-transfers/internal/errors"
 	"github.com/riteshkumar/internal-transfers/internal/models"
 )
 
 type AuditRepository interface {
 	Create(ctx context.Context, tx *sql.Tx, log *models.AuditLog) error
-	CreateWithDB(ctx context.Context, log *models.AuditLog) error
+	GetByID(ctx context.Context, id string) (*models.AuditLog, error)
 	GetByEntityID(ctx context.Context, entityType, entityID string) ([]*models.AuditLog, error)
+	ListEntityHistory(ctx context.Context, upTo *models.AuditLog) ([]*models.AuditLog, error)
+	List(ctx context.Context, filter models.AuditLogFilter) ([]*models.AuditLog, error)
+	GetChainHead(ctx context.Context) (int64, string, error)
+	ChainUnchained(ctx context.Context, limit int) (int, error)
+	CountUnchained(ctx context.Context) (int64, error)
+	ListChain(ctx context.Context, afterSequence, maxSequence int64, limit int) ([]*models.AuditLog, error)
+}
+
+// auditChainLockKey is the advisory lock key held by transactions appending
+// to the audit hash chain, so that appends are serialised and the chain
+// never forks.
+const auditChainLockKey = 0x617564697463
+
+// auditChainHeadSetting holds, for the rest of a transaction, the sequence
+// number and hash of the last entry it chained.
+const auditChainHeadSetting = "audit.chain_head"
+
+// auditChainHeadQuery reads the sequence number and hash of the last
+// chained entry, or 0 and the genesis hash for an empty chain.
+const auditChainHeadQuery = `SELECT COALESCE(MAX(sequence), 0),
+		COALESCE((SELECT hash FROM audit_logs WHERE sequence IS NOT NULL ORDER BY sequence DESC LIMIT 1), $1)
+	FROM audit_logs WHERE sequence IS NOT NULL`
+
+// auditLogColumns lists the columns read by scanAuditLog, in order.
+const auditLogColumns = `id, write_order, sequence, event, schema_version, entity_type, entity_id, action, old_value, new_value,
+		patch, COALESCE(prev_hash, ''), COALESCE(hash, ''), COALESCE(principal, ''), COALESCE(client_ip, ''),
+		COALESCE(user_agent, ''), COALESCE(request_id, ''), COALESCE(reason, ''), created_at`
+
+func scanAuditLog(row rowScanner) (*models.AuditLog, error) {
+	log := &models.AuditLog{}
+	var oldValue, newValue, patch []byte
+	var actor models.AuditActor
+
+	err := row.Scan(
+		&log.ID,
+		&log.WriteOrder,
+		&log.Sequence,
+		&log.Event,
+		&log.SchemaVersion,
+		&log.EntityType,
+		&log.EntityID,
+		&log.Action,
+		&oldValue,
+		&newValue,
+		&patch,
+		&log.PrevHash,
+		&log.Hash,
+		&actor.Principal,
+		&actor.ClientIP,
+		&actor.UserAgent,
+		&actor.RequestID,
+		&actor.Reason,
+		&log.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	// Entries written before actors were recorded have none
+	if actor != (models.AuditActor{}) {
+		log.Actor = &actor
+	}
+
+	if oldValue != nil {
+		log.OldValue = json.RawMessage(oldValue)
+	}
+	log.NewValue = json.RawMessage(newValue)
+	if patch != nil {
+		if err := json.Unmarshal(patch, &log.Patch); err != nil {
+			return nil, fmt.Errorf("failed to decode audit log patch: %w", err)
+		}
+	}
+	return log, nil
 }
 
 type PostgresAuditRepository struct {
 	db *sql.DB
+	// chainDB reads the chain head for the writer holding the chain lock.
+	// It is a pool of its own so that the writer, which already holds a
+	// connection of db, can't wait on db's pool behind writers queued for
+	// the lock.
+	chainDB *sql.DB
 }
 
-func NewAuditRepository(db *sql.DB) *PostgresAuditRepository {
-	return &PostgresAuditRepository{db: db}
+func NewAuditRepository(db, chainDB *sql.DB) *PostgresAuditRepository {
+	return &PostgresAuditRepository{db: db, chainDB: chainDB}
 }
 
-// Create inserts a new audit log entry within a db transaction.
+// Create appends a new audit log entry to the hash chain within a db
+// transaction. tx takes the chain lock until it ends, so concurrent writers
+// are serialised and every entry links to the one committed before it.
+// Entries whose payload does not match their event's schema are rejected
+// with ErrInvalidAuditLog. Unless log already has an actor, it is
+// attributed to the actor of ctx, if any.
 func (r *PostgresAuditRepository) Create(ctx context.Context, tx *sql.Tx, log *models.AuditLog) error {
-	query := `INSERT INTO audit_logs (entity_type, entity_id, action, old_value, new_value, created_at)
-		VALUES ($1, $2, $3, $4, $5, CURRENT_TIMESTAMP)
-		RETURNING id, created_at`
+	if err := log.Validate(); err != nil {
+		return fmt.Errorf("%w: %v", errors.ErrInvalidAuditLog, err)
+	}
+	if log.Actor == nil {
+		log.Actor = models.AuditActorFromContext(ctx)
+	}
+	if err := log.ComputePatch(); err != nil {
+		return fmt.Errorf("failed to diff audit log values: %w", err)
+	}
+	patch, err := json.Marshal(log.Patch)
+	if err != nil {
+		return fmt.Errorf("failed to encode audit log patch: %w", err)
+	}
+	var actor models.AuditActor
+	if log.Actor != nil {
+		actor = *log.Actor
+	}
+
+	sequence, err := r.lockChainHead(ctx, tx, log)
+	if err != nil {
+		return err
+	}
+
+	sequence++
+	log.ID = uuid.New().String()
+	log.Sequence = &sequence
+	if log.Hash, err = log.ComputeHash(); err != nil {
+		return fmt.Errorf("failed to hash audit log: %w", err)
+	}
+
+	query := `INSERT INTO audit_logs (id, sequence, event, schema_version, entity_type, entity_id, action,
+			old_value, new_value, patch, prev_hash, hash, principal, client_ip, user_agent, request_id, reason, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12,
+			NULLIF($13, ''), NULLIF($14, ''), NULLIF($15, ''), NULLIF($16, ''), NULLIF($17, ''), $18)
+		RETURNING write_order`
 
 	var oldValue interface{}
 	if log.OldValue != nil {
 		oldValue = log.OldValue
 	}
-	err := tx.QueryRowContext(ctx, query,
+	err = tx.QueryRowContext(ctx, query,
+		log.ID,
+		sequence,
+		log.Event,
+		log.SchemaVersion,
 		log.EntityType,
 		log.EntityID,
 		log.Action,
 		oldValue,
 		log.NewValue,
-	).Scan(&log.ID, &log.CreatedAt)
-
+		patch,
+		log.PrevHash,
+		log.Hash,
+		actor.Principal,
+		actor.ClientIP,
+		actor.UserAgent,
+		actor.RequestID,
+		actor.Reason,
+		log.CreatedAt,
+	).Scan(&log.WriteOrder)
 	if err != nil {
 		return fmt.Errorf("failed to create audit log: %w", err)
 	}
 
+	head := strconv.FormatInt(sequence, 10) + ":" + log.Hash
+	if _, err := tx.ExecContext(ctx, `SELECT set_config($1, $2, true)`, auditChainHeadSetting, head); err != nil {
+		return fmt.Errorf("failed to record audit chain head: %w", err)
+	}
+
 	return nil
 }
 
-// CreateWithDB inserts a new audit log entry using the db connection directly
-// Used for operations that don't require a transaction (e.g., logging account creation)
-func (r *PostgresAuditRepository) CreateWithDB(ctx context.Context, log *models.AuditLog) error {
-	query := `INSERT INTO audit_logs (entity_type, entity_id, action, old_value, new_value, created_at)
-		VALUES ($1, $2, $3, $4, $5, CURRENT_TIMESTAMP)
-		RETURNING id, created_at`
+// lockChainHead takes the chain lock for tx and returns the sequence number
+// of the chain head, setting log's PrevHash to its hash and CreatedAt to
+// the time tx will store. Once tx has chained an entry, the head is that
+// entry. Otherwise it is read through chainDB: tx's own snapshot may
+// predate the commit of the writer that held the lock before it, which
+// chainDB's fresh one can't.
+func (r *PostgresAuditRepository) lockChainHead(ctx context.Context, tx *sql.Tx, log *models.AuditLog) (int64, error) {
+	if _, err := tx.ExecContext(ctx, `SELECT pg_advisory_xact_lock($1)`, auditChainLockKey); err != nil {
+		return 0, fmt.Errorf("failed to lock audit chain: %w", err)
+	}
 
-	var oldValue interface{}
-	if log.OldValue != nil {
-		oldValue = log.OldValue
+	// LOCALTIMESTAMP is what CURRENT_TIMESTAMP would store; it is read here
+	// because the hash covers it
+	var head string
+	err := tx.QueryRowContext(ctx,
+		`SELECT COALESCE(current_setting($1, true), ''), LOCALTIMESTAMP`, auditChainHeadSetting,
+	).Scan(&head, &log.CreatedAt)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read audit chain head: %w", err)
 	}
 
-	err := r.db.QueryRowContext(ctx, query,
-		log.EntityType,
-		log.EntityID,
-		log.Action,
-		oldValue,
-		log.NewValue,
-	).Scan(&log.ID, &log.CreatedAt)
+	if head != "" {
+		sequenceText, hash, ok := strings.Cut(head, ":")
+		sequence, err := strconv.ParseInt(sequenceText, 10, 64)
+		if !ok || err != nil {
+			return 0, fmt.Errorf("malformed audit chain head %q", head)
+		}
+		log.PrevHash = hash
+		return sequence, nil
+	}
 
+	var sequence int64
+	err = r.chainDB.QueryRowContext(ctx, auditChainHeadQuery, models.AuditChainGenesisHash).Scan(&sequence, &log.PrevHash)
 	if err != nil {
-		return fmt.Errorf("failed to create audit log: %w", err)
+		return 0, fmt.Errorf("failed to get audit chain head: %w", err)
 	}
+	return sequence, nil
+}
 
-	return nil
+// ChainUnchained links up to limit committed but unchained entries into
+// the hash chain, in write order, and returns how many it linked. Only
+// servers that deferred chaining to after commit left such entries. It runs
+// in its own READ COMMITTED transaction holding the chain lock, so it sees
+// the head committed by the last writer. Entries are hashed as read back
+// from the db, which is how VerifyChain reads them.
+func (r *PostgresAuditRepository) ChainUnchained(ctx context.Context, limit int) (int, error) {
+	tx, err := r.db.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelReadCommitted})
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+
+	// Ensure rollback on error
+	defer func() {
+		if tx != nil {
+			tx.Rollback()
+		}
+	}()
+
+	if _, err := tx.ExecContext(ctx, `SELECT pg_advisory_xact_lock($1)`, auditChainLockKey); err != nil {
+		return 0, fmt.Errorf("failed to lock audit chain: %w", err)
+	}
+	var sequence int64
+	var hash string
+	if err := tx.QueryRowContext(ctx, auditChainHeadQuery, models.AuditChainGenesisHash).Scan(&sequence, &hash); err != nil {
+		return 0, fmt.Errorf("failed to get audit chain head: %w", err)
+	}
+
+	rows, err := tx.QueryContext(ctx, `SELECT `+auditLogColumns+`
+		FROM audit_logs
+		WHERE sequence IS NULL AND write_order IS NOT NULL
+		ORDER BY write_order
+		LIMIT $1`, limit)
+	if err != nil {
+		return 0, fmt.Errorf("failed to list unchained audit logs: %w", err)
+	}
+	logs, err := collectAuditLogs(rows)
+	if err != nil {
+		return 0, err
+	}
+	if len(logs) == 0 {
+		return 0, nil
+	}
+
+	for _, log := range logs {
+		sequence++
+		log.Sequence = &sequence
+		log.PrevHash = hash
+		if log.Hash, err = log.ComputeHash(); err != nil {
+			return 0, fmt.Errorf("failed to hash audit log %s: %w", log.ID, err)
+		}
+		_, err = tx.ExecContext(ctx,
+			`UPDATE audit_logs SET sequence = $1, prev_hash = $2, hash = $3 WHERE id = $4`,
+			sequence, log.PrevHash, log.Hash, log.ID,
+		)
+		if err != nil {
+			return 0, fmt.Errorf("failed to chain audit log: %w", err)
+		}
+		hash = log.Hash
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	tx = nil
+
+	return len(logs), nil
+}
+
+// CountUnchained returns how many entries are waiting for ChainUnchained.
+func (r *PostgresAuditRepository) CountUnchained(ctx context.Context) (int64, error) {
+	var count int64
+	err := r.db.QueryRowContext(ctx,
+		`SELECT COUNT(*) FROM audit_logs WHERE sequence IS NULL AND write_order IS NOT NULL`,
+	).Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count unchained audit logs: %w", err)
+	}
+	return count, nil
+}
+
+// GetChainHead returns the sequence number and hash of the last chained
+// entry, or 0 and the genesis hash for an empty chain.
+func (r *PostgresAuditRepository) GetChainHead(ctx context.Context) (int64, string, error) {
+	var sequence int64
+	var hash string
+	err := r.db.QueryRowContext(ctx, auditChainHeadQuery, models.AuditChainGenesisHash).Scan(&sequence, &hash)
+	if err != nil {
+		return 0, "", fmt.Errorf("failed to get audit chain head: %w", err)
+	}
+	return sequence, hash, nil
+}
+
+// ListChain returns up to limit chained entries with sequence numbers above
+// afterSequence and at most maxSequence, in sequence order.
+func (r *PostgresAuditRepository) ListChain(ctx context.Context, afterSequence, maxSequence int64, limit int) ([]*models.AuditLog, error) {
+	query := `SELECT ` + auditLogColumns + `
+		FROM audit_logs
+		WHERE sequence > $1 AND sequence <= $2
+		ORDER BY sequence
+		LIMIT $3`
+
+	rows, err := r.db.QueryContext(ctx, query, afterSequence, maxSequence, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list audit chain: %w", err)
+	}
+	return collectAuditLogs(rows)
+}
+
+// GetByID retrieves a single audit log.
+func (r *PostgresAuditRepository) GetByID(ctx context.Context, id string) (*models.AuditLog, error) {
+	query := `SELECT ` + auditLogColumns + `
+		FROM audit_logs WHERE id = $1`
+
+	log, err := scanAuditLog(r.db.QueryRowContext(ctx, query, id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, errors.ErrAuditLogNotFound
+		}
+		return nil, fmt.Errorf("failed to get audit log by ID: %w", err)
+	}
+	return log, nil
+}
+
+// ListEntityHistory returns the audit logs of upTo's entity in the order
+// they were written, ending with upTo. Entries from before the hash chain
+// come first, ordered by creation time, then the others in write order,
+// whether chained yet or not.
+func (r *PostgresAuditRepository) ListEntityHistory(ctx context.Context, upTo *models.AuditLog) ([]*models.AuditLog, error) {
+	args := []interface{}{upTo.EntityType, upTo.EntityID}
+	var bound string
+	if upTo.WriteOrder != nil {
+		args = append(args, *upTo.WriteOrder)
+		bound = "(write_order IS NULL OR write_order <= $3)"
+	} else {
+		args = append(args, upTo.CreatedAt, upTo.ID)
+		bound = "(write_order IS NULL AND (created_at, id) <= ($3::timestamp, $4::uuid))"
+	}
+
+	query := `SELECT ` + auditLogColumns + `
+		FROM audit_logs
+		WHERE entity_type = $1 AND entity_id = $2 AND ` + bound + `
+		ORDER BY write_order NULLS FIRST, created_at, id`
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list audit log entity history: %w", err)
+	}
+	return collectAuditLogs(rows)
 }
 
 // GetByEntityID retrieves audit logs for a specific entity type and ID.
 func (r *PostgresAuditRepository) GetByEntityID(ctx context.Context, entityType, entityID string) ([]*models.AuditLog, error) {
-	query := `SELECT id, entity_type, entity_id, action, old_value, new_value, created_at
+	query := `SELECT ` + auditLogColumns + `
 		FROM audit_logs
 		WHERE entity_type = $1 AND entity_id = $2
-		ORDER BY created_at DESC`
+		ORDER BY created_at DESC, id DESC`
 
 	rows, err := r.db.QueryContext(ctx, query, entityType, entityID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get audit logs by entity ID: %w", err)
 	}
+	return collectAuditLogs(rows)
+}
+
+// List returns up to filter.Limit audit logs matching filter, newest first,
+// starting after filter.After.
+func (r *PostgresAuditRepository) List(ctx context.Context, filter models.AuditLogFilter) ([]*models.AuditLog, error) {
+	var args []interface{}
+	arg := func(v interface{}) string {
+		args = append(args, v)
+		return fmt.Sprintf("$%d", len(args))
+	}
+
+	conditions := []string{"TRUE"}
+	if filter.Event != "" {
+		conditions = append(conditions, "event = "+arg(filter.Event))
+	}
+	if filter.EntityType != "" {
+		conditions = append(conditions, "entity_type = "+arg(filter.EntityType))
+	}
+	if filter.EntityID != "" {
+		conditions = append(conditions, "entity_id = "+arg(filter.EntityID))
+	}
+	if filter.Action != "" {
+		conditions = append(conditions, "action = "+arg(filter.Action))
+	}
+	if filter.Principal != "" {
+		conditions = append(conditions, "principal = "+arg(filter.Principal))
+	}
+	if filter.ClientIP != "" {
+		conditions = append(conditions, "client_ip = "+arg(filter.ClientIP))
+	}
+	if filter.RequestID != "" {
+		conditions = append(conditions, "request_id = "+arg(filter.RequestID))
+	}
+	if filter.From != nil {
+		conditions = append(conditions, "created_at >= "+arg(*filter.From))
+	}
+	if filter.To != nil {
+		conditions = append(conditions, "created_at < "+arg(*filter.To))
+	}
+	if filter.After != nil {
+		conditions = append(conditions, "(created_at, id) < ("+arg(filter.After.Value)+"::timestamp, "+arg(filter.After.ID)+"::uuid)")
+	}
+
+	query := `SELECT ` + auditLogColumns + `
+		FROM audit_logs
+		WHERE ` + strings.Join(conditions, " AND ") + `
+		ORDER BY created_at DESC, id DESC
+		LIMIT ` + arg(filter.Limit)
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list audit logs: %w", err)
+	}
+	return collectAuditLogs(rows)
+}
+
+// collectAuditLogs scans and closes rows.
+func collectAuditLogs(rows *sql.Rows) ([]*models.AuditLog, error) {
 	defer rows.Close()
 
 	var logs []*models.AuditLog
 	for rows.Next() {
-		log := &models.AuditLog{}
-		var oldValue, newValue []byte
-
-		err := rows.Scan(
-			&log.ID, &log.EntityType, &log.EntityID, &log.Action, &oldValue, &newValue)
+		log, err := scanAuditLog(rows)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan audit log: %w", err)
 		}
-
-		if oldValue != nil {
-			log.OldValue = json.RawMessage(oldValue)
-		}
-		log.NewValue = json.RawMessage(newValue)
-
 		logs = append(logs, log)
 	}
 
-	if err = rows.Err(); err != nil {
+	if err := rows.Err(); err != nil {
 		return nil, fmt.Errorf("error iterating over audit logs: %w", err)
 	}
 	return logs, nil
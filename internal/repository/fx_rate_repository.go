@@ -0,0 +1,95 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/riteshkumar/internal-transfers/internal/errors"
+	"github.com/riteshkumar/internal-transfers/internal/models"
+	"github.com/riteshkumar/internal-transfers/internal/money"
+)
+
+type FXRateRepository interface {
+	Create(ctx context.Context, tx *sql.Tx, rate *models.FXRate) error
+	GetEffectiveRate(ctx context.Context, tx *sql.Tx, base, quote money.Currency, at time.Time) (*models.FXRate, error)
+	List(ctx context.Context, base, quote money.Currency) ([]*models.FXRate, error)
+}
+
+type PostgresFXRateRepository struct {
+	db *sql.DB
+}
+
+func NewFXRateRepository(db *sql.DB) *PostgresFXRateRepository {
+	return &PostgresFXRateRepository{db: db}
+}
+
+func (r *PostgresFXRateRepository) Create(ctx context.Context, tx *sql.Tx, rate *models.FXRate) error {
+	query := `INSERT INTO fx_rates (base_currency, quote_currency, rate, valid_from, valid_to)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, created_at`
+
+	err := tx.QueryRowContext(ctx, query,
+		rate.BaseCurrency,
+		rate.QuoteCurrency,
+		rate.Rate,
+		rate.ValidFrom,
+		rate.ValidTo,
+	).Scan(&rate.ID, &rate.CreatedAt)
+
+	if err != nil {
+		return fmt.Errorf("failed to create fx rate: %w", err)
+	}
+	return nil
+}
+
+// GetEffectiveRate returns the rate for base->quote whose validity window
+// contains at. When windows overlap the most recently started one wins.
+func (r *PostgresFXRateRepository) GetEffectiveRate(ctx context.Context, tx *sql.Tx, base, quote money.Currency, at time.Time) (*models.FXRate, error) {
+	query := `SELECT id, base_currency, quote_currency, rate, valid_from, valid_to, created_at
+		FROM fx_rates
+		WHERE base_currency = $1 AND quote_currency = $2
+			AND valid_from <= $3 AND (valid_to IS NULL OR valid_to > $3)
+		ORDER BY valid_from DESC, created_at DESC
+		LIMIT 1`
+
+	rate := &models.FXRate{}
+	err := tx.QueryRowContext(ctx, query, base, quote, at).
+		Scan(&rate.ID, &rate.BaseCurrency, &rate.QuoteCurrency, &rate.Rate, &rate.ValidFrom, &rate.ValidTo, &rate.CreatedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, errors.ErrFXRateNotFound
+		}
+		return nil, fmt.Errorf("failed to get effective fx rate: %w", err)
+	}
+	return rate, nil
+}
+
+// List returns rates newest first. Empty base or quote matches any currency.
+func (r *PostgresFXRateRepository) List(ctx context.Context, base, quote money.Currency) ([]*models.FXRate, error) {
+	query := `SELECT id, base_currency, quote_currency, rate, valid_from, valid_to, created_at
+		FROM fx_rates
+		WHERE ($1::text = '' OR base_currency = $1::text) AND ($2::text = '' OR quote_currency = $2::text)
+		ORDER BY base_currency, quote_currency, valid_from DESC`
+
+	rows, err := r.db.QueryContext(ctx, query, base, quote)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list fx rates: %w", err)
+	}
+	defer rows.Close()
+
+	var rates []*models.FXRate
+	for rows.Next() {
+		rate := &models.FXRate{}
+		err := rows.Scan(&rate.ID, &rate.BaseCurrency, &rate.QuoteCurrency, &rate.Rate, &rate.ValidFrom, &rate.ValidTo, &rate.CreatedAt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan fx rate: %w", err)
+		}
+		rates = append(rates, rate)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over fx rates: %w", err)
+	}
+	return rates, nil
+}
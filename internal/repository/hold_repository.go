@@ -0,0 +1,149 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/riteshkumar/internal-transfers/internal/errors"
+	"github.com/riteshkumar/internal-transfers/internal/models"
+)
+
+type HoldRepository interface {
+	Create(ctx context.Context, tx *sql.Tx, hold *models.Hold) error
+	GetByID(ctx context.Context, id string) (*models.Hold, error)
+	GetByIDForUpdate(ctx context.Context, tx *sql.Tx, id string) (*models.Hold, error)
+	Update(ctx context.Context, tx *sql.Tx, hold *models.Hold) error
+	ExpireDue(ctx context.Context, tx *sql.Tx, now time.Time, limit int) ([]*models.Hold, error)
+}
+
+// holdColumns lists the columns read by scanHold, in order.
+const holdColumns = `id, account_id, amount, currency, status, captured_amount, transaction_id,
+		expires_at, created_at, updated_at`
+
+func scanHold(row rowScanner) (*models.Hold, error) {
+	hold := &models.Hold{}
+	err := row.Scan(
+		&hold.ID,
+		&hold.AccountID,
+		&hold.Amount,
+		&hold.Currency,
+		&hold.Status,
+		&hold.CapturedAmount,
+		&hold.TransactionID,
+		&hold.ExpiresAt,
+		&hold.CreatedAt,
+		&hold.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return hold, nil
+}
+
+type PostgresHoldRepository struct {
+	db *sql.DB
+}
+
+func NewHoldRepository(db *sql.DB) *PostgresHoldRepository {
+	return &PostgresHoldRepository{db: db}
+}
+
+func (r *PostgresHoldRepository) Create(ctx context.Context, tx *sql.Tx, hold *models.Hold) error {
+	query := `INSERT INTO holds (account_id, amount, currency, status, expires_at)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, created_at, updated_at`
+
+	err := tx.QueryRowContext(ctx, query,
+		hold.AccountID,
+		hold.Amount,
+		hold.Currency,
+		hold.Status,
+		hold.ExpiresAt,
+	).Scan(&hold.ID, &hold.CreatedAt, &hold.UpdatedAt)
+
+	if err != nil {
+		return fmt.Errorf("failed to create hold: %w", err)
+	}
+	return nil
+}
+
+func (r *PostgresHoldRepository) GetByID(ctx context.Context, id string) (*models.Hold, error) {
+	query := `SELECT ` + holdColumns + ` FROM holds WHERE id = $1`
+
+	hold, err := scanHold(r.db.QueryRowContext(ctx, query, id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, errors.ErrHoldNotFound
+		}
+		return nil, fmt.Errorf("failed to get hold by ID: %w", err)
+	}
+	return hold, nil
+}
+
+func (r *PostgresHoldRepository) GetByIDForUpdate(ctx context.Context, tx *sql.Tx, id string) (*models.Hold, error) {
+	query := `SELECT ` + holdColumns + ` FROM holds WHERE id = $1 FOR UPDATE`
+
+	hold, err := scanHold(tx.QueryRowContext(ctx, query, id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, errors.ErrHoldNotFound
+		}
+		return nil, fmt.Errorf("failed to get hold by ID for update: %w", err)
+	}
+	return hold, nil
+}
+
+// Update persists the status and capture details of a hold.
+func (r *PostgresHoldRepository) Update(ctx context.Context, tx *sql.Tx, hold *models.Hold) error {
+	query := `UPDATE holds
+		SET status = $1, captured_amount = $2, transaction_id = $3, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $4
+		RETURNING updated_at`
+
+	err := tx.QueryRowContext(ctx, query, hold.Status, hold.CapturedAmount, hold.TransactionID, hold.ID).
+		Scan(&hold.UpdatedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return errors.ErrHoldNotFound
+		}
+		return fmt.Errorf("failed to update hold: %w", err)
+	}
+	return nil
+}
+
+// ExpireDue marks up to limit active holds whose expiry has passed as
+// EXPIRED and returns them. Rows locked by a concurrent capture or void are
+// skipped and picked up on a later run.
+func (r *PostgresHoldRepository) ExpireDue(ctx context.Context, tx *sql.Tx, now time.Time, limit int) ([]*models.Hold, error) {
+	query := `UPDATE holds
+		SET status = $1, updated_at = CURRENT_TIMESTAMP
+		WHERE id IN (
+			SELECT id FROM holds
+			WHERE status = $2 AND expires_at <= $3
+			ORDER BY expires_at
+			LIMIT $4
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING ` + holdColumns
+
+	rows, err := tx.QueryContext(ctx, query, models.HoldStatusExpired, models.HoldStatusActive, now, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to expire holds: %w", err)
+	}
+	defer rows.Close()
+
+	var holds []*models.Hold
+	for rows.Next() {
+		hold, err := scanHold(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan hold: %w", err)
+		}
+		holds = append(holds, hold)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over expired holds: %w", err)
+	}
+	return holds, nil
+}
@@ -0,0 +1,102 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/riteshkumar/internal-transfers/internal/errors"
+	"github.com/riteshkumar/internal-transfers/internal/models"
+)
+
+type IdempotencyRepository interface {
+	Get(ctx context.Context, principal, scope, key string, now time.Time) (*models.IdempotencyRecord, error)
+	Create(ctx context.Context, tx *sql.Tx, record *models.IdempotencyRecord) error
+	DeleteExpired(ctx context.Context, now time.Time) (int64, error)
+}
+
+type PostgresIdempotencyRepository struct {
+	db *sql.DB
+}
+
+func NewIdempotencyRepository(db *sql.DB) *PostgresIdempotencyRepository {
+	return &PostgresIdempotencyRepository{db: db}
+}
+
+// Get returns the record stored for principal's key in scope, or nil if
+// there is none or it expired before now.
+func (r *PostgresIdempotencyRepository) Get(ctx context.Context, principal, scope, key string, now time.Time) (*models.IdempotencyRecord, error) {
+	query := `SELECT principal, scope, key, fingerprint, response, failed, created_at, expires_at
+		FROM idempotency_keys
+		WHERE principal = $1 AND scope = $2 AND key = $3 AND expires_at > $4`
+
+	record := &models.IdempotencyRecord{}
+	err := r.db.QueryRowContext(ctx, query, principal, scope, key, now).Scan(
+		&record.Principal,
+		&record.Scope,
+		&record.Key,
+		&record.Fingerprint,
+		&record.Response,
+		&record.Failed,
+		&record.CreatedAt,
+		&record.ExpiresAt,
+	)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get idempotency key: %w", err)
+	}
+	return record, nil
+}
+
+// Create stores record, replacing an expired record for the same key. If an
+// unexpired record exists, for example one just committed by a concurrent
+// request with the same key, it returns ErrIdempotencyKeyInUse.
+func (r *PostgresIdempotencyRepository) Create(ctx context.Context, tx *sql.Tx, record *models.IdempotencyRecord) error {
+	query := `INSERT INTO idempotency_keys (principal, scope, key, fingerprint, response, failed, created_at, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6, CURRENT_TIMESTAMP, $7)
+		ON CONFLICT (principal, scope, key) DO UPDATE
+			SET fingerprint = EXCLUDED.fingerprint,
+				response = EXCLUDED.response,
+				failed = EXCLUDED.failed,
+				created_at = EXCLUDED.created_at,
+				expires_at = EXCLUDED.expires_at
+			WHERE idempotency_keys.expires_at <= CURRENT_TIMESTAMP
+		RETURNING created_at`
+
+	err := tx.QueryRowContext(ctx, query,
+		record.Principal,
+		record.Scope,
+		record.Key,
+		record.Fingerprint,
+		[]byte(record.Response),
+		record.Failed,
+		record.ExpiresAt,
+	).Scan(&record.CreatedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return errors.ErrIdempotencyKeyInUse
+		}
+		return fmt.Errorf("failed to create idempotency key: %w", err)
+	}
+	return nil
+}
+
+// DeleteExpired removes records that expired before now and returns how many
+// were removed.
+func (r *PostgresIdempotencyRepository) DeleteExpired(ctx context.Context, now time.Time) (int64, error) {
+	query := `DELETE FROM idempotency_keys WHERE expires_at <= $1`
+
+	result, err := r.db.ExecContext(ctx, query, now)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete expired idempotency keys: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get rows affected after deleting idempotency keys: %w", err)
+	}
+	return rowsAffected, nil
+}
@@ -0,0 +1,55 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/riteshkumar/internal-transfers/internal/models"
+)
+
+type JournalRepository interface {
+	CreateEntry(ctx context.Context, tx *sql.Tx, entry *models.JournalEntry) error
+}
+
+type PostgresJournalRepository struct {
+	db *sql.DB
+}
+
+func NewJournalRepository(db *sql.DB) *PostgresJournalRepository {
+	return &PostgresJournalRepository{db: db}
+}
+
+// CreateEntry inserts a journal entry together with all of its postings.
+// The database rejects the entry at commit if it does not balance.
+func (r *PostgresJournalRepository) CreateEntry(ctx context.Context, tx *sql.Tx, entry *models.JournalEntry) error {
+	entryQuery := `INSERT INTO journal_entries (kind, transaction_id)
+		VALUES ($1, $2)
+		RETURNING id, created_at`
+
+	err := tx.QueryRowContext(ctx, entryQuery, entry.Kind, entry.TransactionID).
+		Scan(&entry.ID, &entry.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create journal entry: %w", err)
+	}
+
+	postingQuery := `INSERT INTO postings (journal_entry_id, account_id, amount, currency)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id, created_at`
+
+	for i := range entry.Postings {
+		posting := &entry.Postings[i]
+		posting.JournalEntryID = entry.ID
+
+		err := tx.QueryRowContext(ctx, postingQuery,
+			posting.JournalEntryID,
+			posting.AccountID,
+			posting.Amount,
+			posting.Currency,
+		).Scan(&posting.ID, &posting.CreatedAt)
+		if err != nil {
+			return fmt.Errorf("failed to create posting: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,153 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+
+	"github.com/riteshkumar/internal-transfers/internal/models"
+)
+
+// outboxRelayLockKey is the advisory lock key held by the outbox relay, so
+// that only one server relays at a time. It is a session lock, held on one
+// connection while the relay publishes outside any transaction.
+const outboxRelayLockKey = 0x6f7574626f78
+
+type OutboxRepository interface {
+	Create(ctx context.Context, tx *sql.Tx, event *models.OutboxEvent) error
+	TryLockRelay(ctx context.Context, conn *sql.Conn) (bool, error)
+	UnlockRelay(ctx context.Context, conn *sql.Conn) error
+	ListUnpublished(ctx context.Context, limit int) ([]*models.OutboxEvent, error)
+	MarkPublished(ctx context.Context, sequence int64) error
+	RecordFailure(ctx context.Context, sequence int64, cause string) error
+}
+
+type PostgresOutboxRepository struct {
+	db *sql.DB
+}
+
+func NewOutboxRepository(db *sql.DB) *PostgresOutboxRepository {
+	return &PostgresOutboxRepository{db: db}
+}
+
+// Create adds event to the outbox within tx, setting its ID, sequence
+// number and creation time.
+func (r *PostgresOutboxRepository) Create(ctx context.Context, tx *sql.Tx, event *models.OutboxEvent) error {
+	if event.ID == "" {
+		event.ID = uuid.New().String()
+	}
+
+	query := `INSERT INTO outbox_events (id, event_type, account_ids, data)
+		VALUES ($1, $2, $3, $4)
+		RETURNING sequence, created_at`
+
+	err := tx.QueryRowContext(ctx, query,
+		event.ID,
+		event.Type,
+		pq.Array(event.AccountIDs),
+		[]byte(event.Data),
+	).Scan(&event.Sequence, &event.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create outbox event: %w", err)
+	}
+	return nil
+}
+
+// TryLockRelay takes the relay lock on conn until UnlockRelay releases it or
+// the connection closes, reporting false without waiting if another relay
+// holds it.
+func (r *PostgresOutboxRepository) TryLockRelay(ctx context.Context, conn *sql.Conn) (bool, error) {
+	var locked bool
+	if err := conn.QueryRowContext(ctx, `SELECT pg_try_advisory_lock($1)`, outboxRelayLockKey).Scan(&locked); err != nil {
+		return false, fmt.Errorf("failed to lock outbox relay: %w", err)
+	}
+	return locked, nil
+}
+
+// UnlockRelay releases the relay lock taken on conn by TryLockRelay.
+func (r *PostgresOutboxRepository) UnlockRelay(ctx context.Context, conn *sql.Conn) error {
+	if _, err := conn.ExecContext(ctx, `SELECT pg_advisory_unlock($1)`, outboxRelayLockKey); err != nil {
+		return fmt.Errorf("failed to unlock outbox relay: %w", err)
+	}
+	return nil
+}
+
+// ListUnpublished returns up to limit unpublished events in sequence order,
+// leaving out those held back behind an earlier event that failed. An
+// event is held back when it shares an account with an earlier unpublished
+// event that has failed or is itself held back, so a failing event can't
+// fill the batch with its accounts' later events and starve the others.
+func (r *PostgresOutboxRepository) ListUnpublished(ctx context.Context, limit int) ([]*models.OutboxEvent, error) {
+	query := `WITH RECURSIVE stuck AS (
+			SELECT sequence, account_ids
+			FROM outbox_events
+			WHERE published_at IS NULL AND attempts > 0
+			UNION
+			SELECT later.sequence, later.account_ids
+			FROM outbox_events later
+			JOIN stuck ON later.sequence > stuck.sequence AND later.account_ids && stuck.account_ids
+			WHERE later.published_at IS NULL
+		)
+		SELECT e.sequence, e.id, e.event_type, e.account_ids, e.data, e.created_at
+		FROM outbox_events e
+		WHERE e.published_at IS NULL
+			AND NOT EXISTS (
+				SELECT 1 FROM stuck
+				WHERE stuck.sequence < e.sequence AND stuck.account_ids && e.account_ids
+			)
+		ORDER BY e.sequence
+		LIMIT $1`
+
+	rows, err := r.db.QueryContext(ctx, query, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list unpublished outbox events: %w", err)
+	}
+	defer rows.Close()
+
+	var events []*models.OutboxEvent
+	for rows.Next() {
+		event := &models.OutboxEvent{}
+		var data []byte
+		if err := rows.Scan(
+			&event.Sequence,
+			&event.ID,
+			&event.Type,
+			pq.Array(&event.AccountIDs),
+			&data,
+			&event.CreatedAt,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan outbox event: %w", err)
+		}
+		event.Data = data
+		events = append(events, event)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over outbox events: %w", err)
+	}
+	return events, nil
+}
+
+func (r *PostgresOutboxRepository) MarkPublished(ctx context.Context, sequence int64) error {
+	query := `UPDATE outbox_events
+		SET published_at = CURRENT_TIMESTAMP, attempts = attempts + 1, last_error = NULL
+		WHERE sequence = $1`
+
+	if _, err := r.db.ExecContext(ctx, query, sequence); err != nil {
+		return fmt.Errorf("failed to mark outbox event published: %w", err)
+	}
+	return nil
+}
+
+// RecordFailure counts a failed attempt to publish an event and keeps its
+// cause.
+func (r *PostgresOutboxRepository) RecordFailure(ctx context.Context, sequence int64, cause string) error {
+	query := `UPDATE outbox_events SET attempts = attempts + 1, last_error = $1 WHERE sequence = $2`
+
+	if _, err := r.db.ExecContext(ctx, query, cause, sequence); err != nil {
+		return fmt.Errorf("failed to record outbox event failure: %w", err)
+	}
+	return nil
+}
@@ -4,16 +4,66 @@ import (
 	"context"
 	"database/sql"
 	"fmt"
+	"strings"
 
 	"github.com/google/uuid"
+	"github.com/lib/pq"
 
+	"github.com/riteshkumar/internal-transfers/internal/errors"
 	"github.com/riteshkumar/internal-transfers/internal/models"
+	"github.com/riteshkumar/internal-transfers/internal/money"
 )
 
 type TransactionRepository interface {
 	Create(ctx context.Context, tx *sql.Tx, transaction *models.Transaction) error
 	GetByID(ctx context.Context, id string) (*models.Transaction, error)
-	GetByAccountID(ctx context.Context, accountID string) ([]*models.Transaction, error)
+	GetByIDForUpdate(ctx context.Context, tx *sql.Tx, id string) (*models.Transaction, error)
+	UpdateReversedAmount(ctx context.Context, tx *sql.Tx, id string, reversedAmount money.Amount) error
+	UpdateStatus(ctx context.Context, tx *sql.Tx, id string, status string) error
+	SumReversals(ctx context.Context, tx *sql.Tx, id string) (money.Amount, error)
+	ListByAccountID(ctx context.Context, accountID string, filter models.TransactionHistoryFilter) ([]*models.AccountTransaction, error)
+}
+
+// transactionColumns lists the columns read by scanTransaction, in order.
+// FAILED transactions may lack currencies and a destination amount, which
+// read back as zero values, and keep account IDs that don't exist apart
+// from the account foreign keys.
+const transactionColumns = `id, COALESCE(source_account_id, requested_source_account_id),
+		COALESCE(destination_account_id, requested_destination_account_id), amount, COALESCE(currency, ''),
+		COALESCE(destination_amount, 0), COALESCE(destination_currency, ''), fx_rate_id, fx_rate, fx_rounding_adjustment,
+		reversal_of_id, reversed_amount, reference, description, metadata, status, failure_reason, created_at`
+
+// rowScanner is satisfied by both *sql.Row and *sql.Rows.
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanTransaction(row rowScanner) (*models.Transaction, error) {
+	transaction := &models.Transaction{}
+	err := row.Scan(
+		&transaction.ID,
+		&transaction.SourceAccountID,
+		&transaction.DestinationAccountID,
+		&transaction.Amount,
+		&transaction.Currency,
+		&transaction.DestinationAmount,
+		&transaction.DestinationCurrency,
+		&transaction.FXRateID,
+		&transaction.FXRate,
+		&transaction.FXRoundingAdjustment,
+		&transaction.ReversalOfID,
+		&transaction.ReversedAmount,
+		&transaction.Reference,
+		&transaction.Description,
+		&transaction.Metadata,
+		&transaction.Status,
+		&transaction.FailureReason,
+		&transaction.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return transaction, nil
 }
 
 type PostgresTransactionRepository struct {
@@ -30,60 +80,272 @@ func (r *PostgresTransactionRepository) Create(ctx context.Context, tx *sql.Tx,
 		transaction.ID = uuid.New().String()
 	}
 
-	query := `INSERT INTO transactions (id, source_account_id, destination_account_id, amount)
-		VALUES ($1, $2, $3, $4)
+	// A FAILED transaction may not know its currencies or destination
+	// amount, which are stored as NULL
+	var destinationAmount interface{} = transaction.DestinationAmount
+	if transaction.Status == models.TransactionStatusFailed {
+		destinationAmount = nil
+	}
+
+	// It may also name accounts that don't exist, which are stored in the
+	// requested_* columns, leaving the keyed columns NULL
+	var sourceAccountID, requestedSourceAccountID interface{} = transaction.SourceAccountID, nil
+	var destinationAccountID, requestedDestinationAccountID interface{} = transaction.DestinationAccountID, nil
+	if transaction.Status == models.TransactionStatusFailed {
+		known, err := knownAccountIDs(ctx, tx, transaction.SourceAccountID, transaction.DestinationAccountID)
+		if err != nil {
+			return err
+		}
+		if !known[transaction.SourceAccountID] {
+			sourceAccountID, requestedSourceAccountID = nil, transaction.SourceAccountID
+		}
+		if !known[transaction.DestinationAccountID] {
+			destinationAccountID, requestedDestinationAccountID = nil, transaction.DestinationAccountID
+		}
+	}
+
+	query := `INSERT INTO transactions (id, source_account_id, destination_account_id, amount, currency,
+			destination_amount, destination_currency, fx_rate_id, fx_rate, fx_rounding_adjustment, reversal_of_id,
+			reference, description, metadata, status, failure_reason, requested_source_account_id,
+			requested_destination_account_id)
+		VALUES ($1, $2, $3, $4, NULLIF($5, ''), $6, NULLIF($7, ''), $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18)
 		RETURNING created_at`
 
 	err := tx.QueryRowContext(ctx, query,
 		transaction.ID,
-		transaction.SourceAccountID,
-		transaction.DestinationAccountID,
+		sourceAccountID,
+		destinationAccountID,
 		transaction.Amount,
+		transaction.Currency,
+		destinationAmount,
+		transaction.DestinationCurrency,
+		transaction.FXRateID,
+		transaction.FXRate,
+		transaction.FXRoundingAdjustment,
+		transaction.ReversalOfID,
+		transaction.Reference,
+		transaction.Description,
+		transaction.Metadata,
+		transaction.Status,
+		transaction.FailureReason,
+		requestedSourceAccountID,
+		requestedDestinationAccountID,
 	).Scan(&transaction.CreatedAt)
 
 	if err != nil {
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" && pqErr.Constraint == "idx_transactions_source_reference" {
+			return errors.ErrDuplicateReference
+		}
 		return fmt.Errorf("failed to create transaction: %w", err)
 	}
 	return nil
 }
 
+// knownAccountIDs reports which of ids name existing accounts.
+func knownAccountIDs(ctx context.Context, tx *sql.Tx, ids ...string) (map[string]bool, error) {
+	rows, err := tx.QueryContext(ctx, `SELECT id FROM accounts WHERE id = ANY($1)`, pq.Array(ids))
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up transaction accounts: %w", err)
+	}
+	defer rows.Close()
+
+	known := map[string]bool{}
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("failed to scan account ID: %w", err)
+		}
+		known[id] = true
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over account IDs: %w", err)
+	}
+	return known, nil
+}
+
 func (r *PostgresTransactionRepository) GetByID(ctx context.Context, id string) (*models.Transaction, error) {
-	query := `SELECT id, source_account_id, destination_account_id, amount, created_at
+	query := `SELECT ` + transactionColumns + `
 		FROM transactions WHERE id = $1`
 
-	transaction := &models.Transaction{}
-	err := r.db.QueryRowContext(ctx, query, id).
-		Scan(&transaction.ID, &transaction.SourceAccountID, &transaction.DestinationAccountID, &transaction.Amount, &transaction.CreatedAt)
+	transaction, err := scanTransaction(r.db.QueryRowContext(ctx, query, id))
 	if err != nil {
 		if err == sql.ErrNoRows {
-			return nil, fmt.Errorf("transaction not found: %w", err)
+			return nil, errors.ErrTransactionNotFound
 		}
 		return nil, fmt.Errorf("failed to get transaction by ID: %w", err)
 	}
 	return transaction, nil
 }
 
-func (r *PostgresTransactionRepository) GetByAccountID(ctx context.Context, accountID string) ([]*models.Transaction, error) {
-	query := `SELECT id, source_account_id, destination_account_id, amount, created_at
-		FROM transactions
-		WHERE source_account_id = $1 OR destination_account_id = $1
-		ORDER BY created_at DESC`
-	rows, err := r.db.QueryContext(ctx, query, accountID)
+func (r *PostgresTransactionRepository) GetByIDForUpdate(ctx context.Context, tx *sql.Tx, id string) (*models.Transaction, error) {
+	query := `SELECT ` + transactionColumns + `
+		FROM transactions WHERE id = $1 FOR UPDATE`
+
+	transaction, err := scanTransaction(tx.QueryRowContext(ctx, query, id))
 	if err != nil {
-		return nil, fmt.Errorf("failed to get transactions by account ID: %w", err)
+		if err == sql.ErrNoRows {
+			return nil, errors.ErrTransactionNotFound
+		}
+		return nil, fmt.Errorf("failed to get transaction by ID for update: %w", err)
+	}
+	return transaction, nil
+}
+
+func (r *PostgresTransactionRepository) UpdateReversedAmount(ctx context.Context, tx *sql.Tx, id string, reversedAmount money.Amount) error {
+	query := `UPDATE transactions SET reversed_amount = $1 WHERE id = $2`
+
+	result, err := tx.ExecContext(ctx, query, reversedAmount, id)
+	if err != nil {
+		return fmt.Errorf("failed to update reversed amount: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected after updating reversed amount: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return errors.ErrTransactionNotFound
+	}
+	return nil
+}
+
+func (r *PostgresTransactionRepository) UpdateStatus(ctx context.Context, tx *sql.Tx, id string, status string) error {
+	query := `UPDATE transactions SET status = $1 WHERE id = $2`
+
+	result, err := tx.ExecContext(ctx, query, status, id)
+	if err != nil {
+		return fmt.Errorf("failed to update transaction status: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected after updating transaction status: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return errors.ErrTransactionNotFound
+	}
+	return nil
+}
+
+// SumReversals returns the total amount of the reversals of id. Reversals
+// debit the original destination, so the total is in the original
+// transaction's destination currency.
+func (r *PostgresTransactionRepository) SumReversals(ctx context.Context, tx *sql.Tx, id string) (money.Amount, error) {
+	query := `SELECT COALESCE(SUM(amount), 0) FROM transactions WHERE reversal_of_id = $1`
+
+	var total money.Amount
+	if err := tx.QueryRowContext(ctx, query, id).Scan(&total); err != nil {
+		return 0, fmt.Errorf("failed to sum reversals: %w", err)
+	}
+	return total, nil
+}
+
+// ListByAccountID returns the POSTED and REVERSED transactions on either
+// side of an account, newest first, up to filter.Limit. Each side is read
+// from its own (account, created_at, id) index and the two are merged, so a
+// page costs the same however long the history is.
+func (r *PostgresTransactionRepository) ListByAccountID(ctx context.Context, accountID string, filter models.TransactionHistoryFilter) ([]*models.AccountTransaction, error) {
+	args := []interface{}{accountID}
+	arg := func(v interface{}) string {
+		args = append(args, v)
+		return fmt.Sprintf("$%d", len(args))
+	}
+
+	var counterparty, minAmount, maxAmount, from, to, afterCreatedAt, afterID string
+	if filter.CounterpartyAccountID != "" {
+		counterparty = arg(filter.CounterpartyAccountID)
+	}
+	if filter.MinAmount != nil {
+		minAmount = arg(*filter.MinAmount)
+	}
+	if filter.MaxAmount != nil {
+		maxAmount = arg(*filter.MaxAmount)
+	}
+	if filter.From != nil {
+		from = arg(*filter.From)
+	}
+	if filter.To != nil {
+		to = arg(*filter.To)
+	}
+	if filter.After != nil {
+		afterCreatedAt = arg(filter.After.Value)
+		afterID = arg(filter.After.ID)
+	}
+	limit := arg(filter.Limit)
+
+	// side selects one direction; the column arguments say which columns
+	// hold the account, its counterparty and its side's amount and currency
+	side := func(direction, accountColumn, counterpartyColumn, amountColumn, currencyColumn, signedAmount string) string {
+		conditions := []string{accountColumn + " = $1", "status != 'FAILED'"}
+		if counterparty != "" {
+			conditions = append(conditions, counterpartyColumn+" = "+counterparty)
+		}
+		if minAmount != "" {
+			conditions = append(conditions, amountColumn+" >= "+minAmount)
+		}
+		if maxAmount != "" {
+			conditions = append(conditions, amountColumn+" <= "+maxAmount)
+		}
+		if from != "" {
+			conditions = append(conditions, "created_at >= "+from)
+		}
+		if to != "" {
+			conditions = append(conditions, "created_at < "+to)
+		}
+		if afterID != "" {
+			conditions = append(conditions, "(created_at, id) < ("+afterCreatedAt+"::timestamp, "+afterID+"::uuid)")
+		}
+		return `SELECT id, '` + direction + `' AS direction, ` + counterpartyColumn + ` AS counterparty_account_id,
+				` + signedAmount + ` AS amount, ` + currencyColumn + ` AS currency, status, reversal_of_id, reference,
+				description, created_at
+			FROM transactions
+			WHERE ` + strings.Join(conditions, " AND ") + `
+			ORDER BY created_at DESC, id DESC
+			LIMIT ` + limit
+	}
+
+	var sides []string
+	if filter.Direction != models.DirectionCredit {
+		sides = append(sides, side(models.DirectionDebit, "source_account_id", "destination_account_id", "amount", "currency", "-amount"))
+	}
+	if filter.Direction != models.DirectionDebit {
+		sides = append(sides, side(models.DirectionCredit, "destination_account_id", "source_account_id", "destination_amount", "destination_currency", "destination_amount"))
+	}
+	query := `SELECT id, direction, counterparty_account_id, amount, currency, status, reversal_of_id, reference,
+			description, created_at
+		FROM ((` + strings.Join(sides, ") UNION ALL (") + `)) history
+		ORDER BY created_at DESC, id DESC
+		LIMIT ` + limit
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list transactions by account ID: %w", err)
 	}
 	defer rows.Close()
-	var transactions []*models.Transaction
+
+	var transactions []*models.AccountTransaction
 	for rows.Next() {
-		transaction := &models.Transaction{}
-		err := rows.Scan(&transaction.ID, &transaction.SourceAccountID, &transaction.DestinationAccountID, &transaction.Amount, &transaction.CreatedAt)
-		if err != nil {
-			return nil, fmt.Errorf("failed to scan transaction: %w", err)
+		transaction := &models.AccountTransaction{}
+		if err := rows.Scan(
+			&transaction.TransactionID,
+			&transaction.Direction,
+			&transaction.CounterpartyAccountID,
+			&transaction.Amount,
+			&transaction.Currency,
+			&transaction.Status,
+			&transaction.ReversalOfID,
+			&transaction.Reference,
+			&transaction.Description,
+			&transaction.CreatedAt,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan account transaction: %w", err)
 		}
 		transactions = append(transactions, transaction)
 	}
 	if err = rows.Err(); err != nil {
-		return nil, fmt.Errorf("error iterating over transactions: %w", err)
+		return nil, fmt.Errorf("error iterating over account transactions: %w", err)
 	}
 	return transactions, nil
 }
@@ -0,0 +1,473 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+
+	"github.com/riteshkumar/internal-transfers/internal/errors"
+	"github.com/riteshkumar/internal-transfers/internal/models"
+)
+
+type WebhookRepository interface {
+	CreateSubscription(ctx context.Context, subscription *models.WebhookSubscription) error
+	GetSubscription(ctx context.Context, id string) (*models.WebhookSubscription, error)
+	ListSubscriptions(ctx context.Context) ([]*models.WebhookSubscription, error)
+	ListSubscriptionsForEvent(ctx context.Context, eventType models.DomainEventType) ([]*models.WebhookSubscription, error)
+	UpdateSubscription(ctx context.Context, subscription *models.WebhookSubscription) error
+	DeleteSubscription(ctx context.Context, id string) error
+
+	CreateDelivery(ctx context.Context, delivery *models.WebhookDelivery) (bool, error)
+	GetDelivery(ctx context.Context, id string) (*models.WebhookDelivery, error)
+	ListDeliveries(ctx context.Context, filter models.WebhookDeliveryFilter) ([]*models.WebhookDelivery, error)
+	ListAttempts(ctx context.Context, deliveryID string) ([]*models.WebhookDeliveryAttempt, error)
+	ClaimDueDeliveries(ctx context.Context, now, leaseUntil time.Time, limit int) ([]*models.WebhookDelivery, error)
+	RecordAttempt(ctx context.Context, delivery *models.WebhookDelivery, attempt *models.WebhookDeliveryAttempt) error
+	Redeliver(ctx context.Context, id string, now time.Time) (*models.WebhookDelivery, error)
+}
+
+// webhookSubscriptionColumns lists the columns read by
+// scanWebhookSubscription, in order.
+const webhookSubscriptionColumns = `id, url, event_types, secret, COALESCE(description, ''), active, created_at, updated_at`
+
+func scanWebhookSubscription(row rowScanner) (*models.WebhookSubscription, error) {
+	subscription := &models.WebhookSubscription{}
+	var eventTypes []string
+	err := row.Scan(
+		&subscription.ID,
+		&subscription.URL,
+		pq.Array(&eventTypes),
+		&subscription.Secret,
+		&subscription.Description,
+		&subscription.Active,
+		&subscription.CreatedAt,
+		&subscription.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	subscription.EventTypes = make([]models.DomainEventType, len(eventTypes))
+	for i, eventType := range eventTypes {
+		subscription.EventTypes[i] = models.DomainEventType(eventType)
+	}
+	return subscription, nil
+}
+
+// webhookDeliveryColumns lists the columns read by scanWebhookDelivery, in
+// order.
+const webhookDeliveryColumns = `id, subscription_id, event_id, event_type, payload, status, attempts, retry_budget_start,
+		next_attempt_at, leased_until, last_response_code, last_error, delivered_at, created_at, updated_at`
+
+func scanWebhookDelivery(row rowScanner) (*models.WebhookDelivery, error) {
+	delivery := &models.WebhookDelivery{}
+	var payload []byte
+	err := row.Scan(
+		&delivery.ID,
+		&delivery.SubscriptionID,
+		&delivery.EventID,
+		&delivery.EventType,
+		&payload,
+		&delivery.Status,
+		&delivery.Attempts,
+		&delivery.RetryBudgetStart,
+		&delivery.NextAttemptAt,
+		&delivery.LeasedUntil,
+		&delivery.LastResponseCode,
+		&delivery.LastError,
+		&delivery.DeliveredAt,
+		&delivery.CreatedAt,
+		&delivery.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	delivery.Payload = payload
+	return delivery, nil
+}
+
+type PostgresWebhookRepository struct {
+	db *sql.DB
+}
+
+func NewWebhookRepository(db *sql.DB) *PostgresWebhookRepository {
+	return &PostgresWebhookRepository{db: db}
+}
+
+func eventTypeStrings(eventTypes []models.DomainEventType) []string {
+	values := make([]string, len(eventTypes))
+	for i, eventType := range eventTypes {
+		values[i] = string(eventType)
+	}
+	return values
+}
+
+func (r *PostgresWebhookRepository) CreateSubscription(ctx context.Context, subscription *models.WebhookSubscription) error {
+	query := `INSERT INTO webhook_subscriptions (id, url, event_types, secret, description, active)
+		VALUES ($1, $2, $3, $4, NULLIF($5, ''), $6)
+		RETURNING created_at, updated_at`
+
+	err := r.db.QueryRowContext(ctx, query,
+		subscription.ID,
+		subscription.URL,
+		pq.Array(eventTypeStrings(subscription.EventTypes)),
+		subscription.Secret,
+		subscription.Description,
+		subscription.Active,
+	).Scan(&subscription.CreatedAt, &subscription.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create webhook subscription: %w", err)
+	}
+	return nil
+}
+
+func (r *PostgresWebhookRepository) GetSubscription(ctx context.Context, id string) (*models.WebhookSubscription, error) {
+	query := `SELECT ` + webhookSubscriptionColumns + ` FROM webhook_subscriptions WHERE id = $1`
+
+	subscription, err := scanWebhookSubscription(r.db.QueryRowContext(ctx, query, id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, errors.ErrWebhookNotFound
+		}
+		return nil, fmt.Errorf("failed to get webhook subscription by ID: %w", err)
+	}
+	return subscription, nil
+}
+
+func (r *PostgresWebhookRepository) ListSubscriptions(ctx context.Context) ([]*models.WebhookSubscription, error) {
+	query := `SELECT ` + webhookSubscriptionColumns + ` FROM webhook_subscriptions ORDER BY created_at, id`
+
+	rows, err := r.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list webhook subscriptions: %w", err)
+	}
+	return collectWebhookSubscriptions(rows)
+}
+
+// ListSubscriptionsForEvent returns the active subscriptions that want
+// events of eventType.
+func (r *PostgresWebhookRepository) ListSubscriptionsForEvent(ctx context.Context, eventType models.DomainEventType) ([]*models.WebhookSubscription, error) {
+	query := `SELECT ` + webhookSubscriptionColumns + `
+		FROM webhook_subscriptions
+		WHERE active AND (event_types = '{}' OR $1 = ANY(event_types))
+		ORDER BY created_at, id`
+
+	rows, err := r.db.QueryContext(ctx, query, eventType)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list webhook subscriptions for event: %w", err)
+	}
+	return collectWebhookSubscriptions(rows)
+}
+
+func collectWebhookSubscriptions(rows *sql.Rows) ([]*models.WebhookSubscription, error) {
+	defer rows.Close()
+
+	var subscriptions []*models.WebhookSubscription
+	for rows.Next() {
+		subscription, err := scanWebhookSubscription(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan webhook subscription: %w", err)
+		}
+		subscriptions = append(subscriptions, subscription)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over webhook subscriptions: %w", err)
+	}
+	return subscriptions, nil
+}
+
+// UpdateSubscription saves the URL, event types, description and active
+// flag of subscription; its secret never changes.
+func (r *PostgresWebhookRepository) UpdateSubscription(ctx context.Context, subscription *models.WebhookSubscription) error {
+	query := `UPDATE webhook_subscriptions
+		SET url = $1, event_types = $2, description = NULLIF($3, ''), active = $4, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $5
+		RETURNING updated_at`
+
+	err := r.db.QueryRowContext(ctx, query,
+		subscription.URL,
+		pq.Array(eventTypeStrings(subscription.EventTypes)),
+		subscription.Description,
+		subscription.Active,
+		subscription.ID,
+	).Scan(&subscription.UpdatedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return errors.ErrWebhookNotFound
+		}
+		return fmt.Errorf("failed to update webhook subscription: %w", err)
+	}
+	return nil
+}
+
+// DeleteSubscription deletes a subscription along with its deliveries.
+func (r *PostgresWebhookRepository) DeleteSubscription(ctx context.Context, id string) error {
+	result, err := r.db.ExecContext(ctx, `DELETE FROM webhook_subscriptions WHERE id = $1`, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete webhook subscription: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected after deleting webhook subscription: %w", err)
+	}
+	if rowsAffected == 0 {
+		return errors.ErrWebhookNotFound
+	}
+	return nil
+}
+
+// CreateDelivery stores a new delivery and reports whether it did. It does
+// not when the subscription already has a delivery of the same event, as
+// happens when the outbox relays an event again.
+func (r *PostgresWebhookRepository) CreateDelivery(ctx context.Context, delivery *models.WebhookDelivery) (bool, error) {
+	query := `INSERT INTO webhook_deliveries (id, subscription_id, event_id, event_type, payload, status,
+			next_attempt_at, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $8)
+		ON CONFLICT (subscription_id, event_id) DO NOTHING`
+
+	result, err := r.db.ExecContext(ctx, query,
+		delivery.ID,
+		delivery.SubscriptionID,
+		delivery.EventID,
+		delivery.EventType,
+		[]byte(delivery.Payload),
+		delivery.Status,
+		delivery.NextAttemptAt,
+		delivery.CreatedAt,
+	)
+	if err != nil {
+		return false, fmt.Errorf("failed to create webhook delivery: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to get rows affected after creating webhook delivery: %w", err)
+	}
+	return rowsAffected > 0, nil
+}
+
+func (r *PostgresWebhookRepository) GetDelivery(ctx context.Context, id string) (*models.WebhookDelivery, error) {
+	query := `SELECT ` + webhookDeliveryColumns + ` FROM webhook_deliveries WHERE id = $1`
+
+	delivery, err := scanWebhookDelivery(r.db.QueryRowContext(ctx, query, id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, errors.ErrWebhookDeliveryNotFound
+		}
+		return nil, fmt.Errorf("failed to get webhook delivery by ID: %w", err)
+	}
+	return delivery, nil
+}
+
+// ListDeliveries returns up to filter.Limit deliveries matching filter,
+// newest first, starting after filter.After.
+func (r *PostgresWebhookRepository) ListDeliveries(ctx context.Context, filter models.WebhookDeliveryFilter) ([]*models.WebhookDelivery, error) {
+	var args []interface{}
+	arg := func(v interface{}) string {
+		args = append(args, v)
+		return fmt.Sprintf("$%d", len(args))
+	}
+
+	conditions := []string{"TRUE"}
+	if filter.SubscriptionID != "" {
+		conditions = append(conditions, "subscription_id = "+arg(filter.SubscriptionID))
+	}
+	if filter.Status != "" {
+		conditions = append(conditions, "status = "+arg(filter.Status))
+	}
+	if filter.After != nil {
+		conditions = append(conditions, "(created_at, id) < ("+arg(filter.After.Value)+"::timestamp, "+arg(filter.After.ID)+"::uuid)")
+	}
+
+	query := `SELECT ` + webhookDeliveryColumns + `
+		FROM webhook_deliveries
+		WHERE ` + strings.Join(conditions, " AND ") + `
+		ORDER BY created_at DESC, id DESC
+		LIMIT ` + arg(filter.Limit)
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list webhook deliveries: %w", err)
+	}
+	return collectWebhookDeliveries(rows)
+}
+
+func collectWebhookDeliveries(rows *sql.Rows) ([]*models.WebhookDelivery, error) {
+	defer rows.Close()
+
+	var deliveries []*models.WebhookDelivery
+	for rows.Next() {
+		delivery, err := scanWebhookDelivery(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan webhook delivery: %w", err)
+		}
+		deliveries = append(deliveries, delivery)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over webhook deliveries: %w", err)
+	}
+	return deliveries, nil
+}
+
+// ListAttempts returns the attempts of a delivery, oldest first.
+func (r *PostgresWebhookRepository) ListAttempts(ctx context.Context, deliveryID string) ([]*models.WebhookDeliveryAttempt, error) {
+	query := `SELECT attempt, requested_at, duration_ms, response_code, error
+		FROM webhook_delivery_attempts
+		WHERE delivery_id = $1
+		ORDER BY attempt`
+
+	rows, err := r.db.QueryContext(ctx, query, deliveryID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list webhook delivery attempts: %w", err)
+	}
+	defer rows.Close()
+
+	var attempts []*models.WebhookDeliveryAttempt
+	for rows.Next() {
+		attempt := &models.WebhookDeliveryAttempt{}
+		if err := rows.Scan(
+			&attempt.Attempt,
+			&attempt.RequestedAt,
+			&attempt.DurationMs,
+			&attempt.ResponseCode,
+			&attempt.Error,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan webhook delivery attempt: %w", err)
+		}
+		attempts = append(attempts, attempt)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over webhook delivery attempts: %w", err)
+	}
+	return attempts, nil
+}
+
+// ClaimDueDeliveries returns up to limit PENDING deliveries of active
+// subscriptions due by now, the most overdue first, and leases them until
+// leaseUntil, pushing their next attempt back to then. A dispatcher that
+// stops before recording an attempt thus leaves the delivery to be retried
+// after the lease, and other dispatchers don't claim it while the lease
+// lasts.
+func (r *PostgresWebhookRepository) ClaimDueDeliveries(ctx context.Context, now, leaseUntil time.Time, limit int) ([]*models.WebhookDelivery, error) {
+	query := `UPDATE webhook_deliveries
+		SET next_attempt_at = $2, leased_until = $2
+		WHERE id IN (
+			SELECT id FROM webhook_deliveries
+			WHERE status = 'PENDING' AND next_attempt_at <= $1
+				AND subscription_id IN (SELECT id FROM webhook_subscriptions WHERE active)
+			ORDER BY next_attempt_at
+			LIMIT $3
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING ` + webhookDeliveryColumns
+
+	rows, err := r.db.QueryContext(ctx, query, now, leaseUntil, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim due webhook deliveries: %w", err)
+	}
+	return collectWebhookDeliveries(rows)
+}
+
+// RecordAttempt logs attempt and saves the outcome it left delivery in: its
+// status, next attempt and last response. The attempt is numbered after the
+// delivery's stored attempt count, which it increments, and delivery.Attempts
+// and attempt.Attempt are set to the new count. The delivery's lease ends.
+// If the delivery no longer holds the lease it was claimed with, delivery.
+// LeasedUntil, another dispatcher may have claimed it since, so nothing is
+// saved and ErrWebhookDeliveryLeaseLost is returned.
+func (r *PostgresWebhookRepository) RecordAttempt(ctx context.Context, delivery *models.WebhookDelivery, attempt *models.WebhookDeliveryAttempt) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+
+	// Ensure rollback on error
+	defer func() {
+		if tx != nil {
+			tx.Rollback()
+		}
+	}()
+
+	query := `UPDATE webhook_deliveries
+		SET status = $1, attempts = attempts + 1, next_attempt_at = $2, leased_until = NULL, last_response_code = $3,
+			last_error = $4, delivered_at = $5, updated_at = $6
+		WHERE id = $7 AND leased_until = $8
+		RETURNING attempts`
+
+	err = tx.QueryRowContext(ctx, query,
+		delivery.Status,
+		delivery.NextAttemptAt,
+		delivery.LastResponseCode,
+		delivery.LastError,
+		delivery.DeliveredAt,
+		delivery.UpdatedAt,
+		delivery.ID,
+		delivery.LeasedUntil,
+	).Scan(&delivery.Attempts)
+	if err == sql.ErrNoRows {
+		var exists bool
+		err = tx.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM webhook_deliveries WHERE id = $1)`, delivery.ID).Scan(&exists)
+		if err == nil && exists {
+			return errors.ErrWebhookDeliveryLeaseLost
+		}
+		if err == nil {
+			return errors.ErrWebhookDeliveryNotFound
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("failed to update webhook delivery: %w", err)
+	}
+	attempt.Attempt = delivery.Attempts
+	delivery.LeasedUntil = nil
+
+	_, err = tx.ExecContext(ctx,
+		`INSERT INTO webhook_delivery_attempts (delivery_id, attempt, requested_at, duration_ms, response_code, error)
+		VALUES ($1, $2, $3, $4, $5, $6)`,
+		delivery.ID,
+		attempt.Attempt,
+		attempt.RequestedAt,
+		attempt.DurationMs,
+		attempt.ResponseCode,
+		attempt.Error,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create webhook delivery attempt: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit webhook delivery attempt: %w", err)
+	}
+	tx = nil
+	return nil
+}
+
+// Redeliver makes a delivery PENDING again, due at now, with a fresh set of
+// retries, whatever its status. Its attempt log and count are kept. A delivery leased by a dispatcher at
+// now is left alone and ErrWebhookDeliveryInFlight returned, as it would
+// otherwise be claimed and POSTed again while still in flight.
+func (r *PostgresWebhookRepository) Redeliver(ctx context.Context, id string, now time.Time) (*models.WebhookDelivery, error) {
+	query := `UPDATE webhook_deliveries
+		SET status = 'PENDING', next_attempt_at = $1, retry_budget_start = attempts, updated_at = $1
+		WHERE id = $2 AND (leased_until IS NULL OR leased_until <= $1)
+		RETURNING ` + webhookDeliveryColumns
+
+	delivery, err := scanWebhookDelivery(r.db.QueryRowContext(ctx, query, now, id))
+	if err == sql.ErrNoRows {
+		var exists bool
+		err = r.db.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM webhook_deliveries WHERE id = $1)`, id).Scan(&exists)
+		if err == nil && exists {
+			return nil, errors.ErrWebhookDeliveryInFlight
+		}
+		if err == nil {
+			return nil, errors.ErrWebhookDeliveryNotFound
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to redeliver webhook delivery: %w", err)
+	}
+	return delivery, nil
+}
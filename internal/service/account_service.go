@@ -4,29 +4,60 @@ import (
 	"context"
 	"database/sql"
 	"encoding/json"
+	"fmt"
 	"log/slog"
+	"strings"
+	"time"
 
 	"github.com/riteshkumar/internal-transfers/internal/errors"
 	"github.com/riteshkumar/internal-transfers/internal/models"
+	"github.com/riteshkumar/internal-transfers/internal/money"
 	"github.com/riteshkumar/internal-transfers/internal/repository"
 )
 
+// Page sizes of account listings.
+const (
+	defaultAccountPageSize = 50
+	maxAccountPageSize     = 200
+)
+
+// DefaultAccountBatchSize is the default limit on the number of ids in one
+// batch account lookup.
+const DefaultAccountBatchSize = 500
+
 type AccountService interface {
 	CreateAccount(ctx context.Context, req *models.CreateAccountRequest) (*models.Account, error)
 	GetAccount(ctx context.Context, id string) (*models.Account, error)
+	ListAccounts(ctx context.Context, filter models.AccountListFilter) (*models.AccountListResponse, error)
+	BatchGetAccounts(ctx context.Context, req *models.BatchGetAccountsRequest) (*models.BatchGetAccountsResponse, error)
+	SetOverdraftLimit(ctx context.Context, id string, req *models.SetOverdraftLimitRequest) (*models.Account, error)
+	SetStatus(ctx context.Context, id string, req *models.SetAccountStatusRequest) (*models.Account, error)
 }
 
 type AccountServiceImpl struct {
+	db          *sql.DB
 	accountRepo repository.AccountRepository
 	auditRepo   repository.AuditRepository
-	logger      *slog.Logger
+	ledger      *Ledger
+	idempotency *IdempotencyServiceImpl
+	audit       *AuditWriter
+	outbox      *Outbox
+	// maxBatchSize bounds the number of ids in BatchGetAccounts.
+	maxBatchSize int
+	logger       *slog.Logger
 }
 
-func NewAccountService(accountRepo repository.AccountRepository, auditRepo repository.AuditRepository, logger *slog.Logger) *AccountServiceImpl {
+func NewAccountService(db *sql.DB, accountRepo repository.AccountRepository, auditRepo repository.AuditRepository, ledger *Ledger, idempotency *IdempotencyServiceImpl, audit *AuditWriter, outbox *Outbox, maxBatchSize int, logger *slog.Logger) *AccountServiceImpl {
 	return &AccountServiceImpl{
-		accountRepo: accountRepo,
-		auditRepo:   auditRepo,
-		logger:      logger,
+		db:           db,
+		accountRepo:  accountRepo,
+		auditRepo:    auditRepo,
+		ledger:       ledger,
+		idempotency:  idempotency,
+		audit:        audit,
+		outbox:       outbox,
+		maxBatchSize: maxBatchSize,
+		logger:       logger,
 	}
 }
 
@@ -40,11 +71,27 @@ func (s *AccountServiceImpl) CreateAccount(ctx context.Context, req *models.Crea
 	}
 
 	account := &models.Account{
-		ID:      req.ID,
-		Balance: req.InitialBalance,
+		ID:       req.ID,
+		Type:     models.AccountTypeCustomer,
+		Currency: money.Currency(req.Currency),
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		s.logger.Error("failed to begin transaction",
+			"error", err.Error(),
+		)
+		return nil, errors.NewTransactionError("begin", err)
 	}
 
-	if err := s.accountRepo.CreateAccount(ctx, account); err != nil {
+	// Ensure rollback on error
+	defer func() {
+		if tx != nil {
+			tx.Rollback()
+		}
+	}()
+
+	if err := s.accountRepo.CreateAccount(ctx, tx, account); err != nil {
 		if errors.IsAlreadyExists(err) {
 			s.logger.Warn("account already exists",
 				"account_id", req.ID,
@@ -59,13 +106,56 @@ func (s *AccountServiceImpl) CreateAccount(ctx context.Context, req *models.Crea
 		return nil, err
 	}
 
-	// Log audit entry for account creation
-	if err := s.createAccoutAuditLog(ctx, account); err != nil {
+	if req.InitialBalance.IsPositive() {
+		if err := s.postOpeningBalance(ctx, tx, account, req.InitialBalance); err != nil {
+			s.logger.Error("failed to post opening balance",
+				"account_id", req.ID,
+				"error", err.Error(),
+			)
+			return nil, errors.NewTransactionError("post opening balance", err)
+		}
+	}
+
+	// The account is only created together with its audit entry
+	err = s.audit.Write(ctx, tx, "create account", func() error {
+		return s.createAccoutAuditLog(ctx, tx, account)
+	})
+	if err != nil {
 		s.logger.Error("failed to create audit log for account creation",
 			"account_id", req.ID,
 			"error", err.Error(),
 		)
+		return nil, errors.NewTransactionError("create account audit log", err)
+	}
+
+	if err := s.outbox.Enqueue(ctx, tx, models.DomainEventAccountCreated, models.NewAccountResponse(account), account.ID); err != nil {
+		s.logger.Error("failed to enqueue account created event",
+			"account_id", req.ID,
+			"error", err.Error(),
+		)
+		return nil, errors.NewTransactionError("enqueue account created event", err)
+	}
+
+	if err := s.idempotency.save(ctx, tx, models.NewAccountResponse(account)); err != nil {
+		if err == errors.ErrIdempotencyKeyInUse {
+			return nil, err
+		}
+		s.logger.Error("failed to save idempotency key",
+			"account_id", req.ID,
+			"error", err.Error(),
+		)
+		return nil, errors.NewTransactionError("save idempotency key", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		s.logger.Error("failed to commit account creation",
+			"account_id", req.ID,
+			"error", err.Error(),
+		)
+		return nil, errors.NewTransactionError("commit", err)
 	}
+	tx = nil
+
 	s.logger.Info("account created successfully",
 		"account_id", req.ID,
 	)
@@ -95,20 +185,396 @@ func (s *AccountServiceImpl) GetAccount(ctx context.Context, id string) (*models
 	return account, nil
 }
 
+// BatchGetAccounts looks up many accounts with one query. Duplicate ids are
+// looked up once; missing ones are reported in NotFound rather than failing
+// the whole batch.
+func (s *AccountServiceImpl) BatchGetAccounts(ctx context.Context, req *models.BatchGetAccountsRequest) (*models.BatchGetAccountsResponse, error) {
+	if len(req.IDs) == 0 {
+		return nil, errors.NewValidationError("ids", "must contain at least one id")
+	}
+	if len(req.IDs) > s.maxBatchSize {
+		return nil, errors.NewValidationError("ids", fmt.Sprintf("must contain at most %d ids", s.maxBatchSize))
+	}
+
+	ids := make([]string, 0, len(req.IDs))
+	seen := make(map[string]bool, len(req.IDs))
+	for _, id := range req.IDs {
+		if id == "" {
+			return nil, errors.NewValidationError("ids", "must not contain empty ids")
+		}
+		if !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+
+	accounts, err := s.accountRepo.GetAccountsByIDs(ctx, ids)
+	if err != nil {
+		s.logger.Error("failed to batch get accounts",
+			"count", len(ids),
+			"error", err.Error(),
+		)
+		return nil, err
+	}
+
+	byID := make(map[string]*models.Account, len(accounts))
+	for _, account := range accounts {
+		byID[account.ID] = account
+	}
+	response := &models.BatchGetAccountsResponse{
+		Accounts: make([]models.AccountResponse, 0, len(accounts)),
+		NotFound: []string{},
+	}
+	for _, id := range ids {
+		if account, ok := byID[id]; ok {
+			response.Accounts = append(response.Accounts, models.NewAccountResponse(account))
+		} else {
+			response.NotFound = append(response.NotFound, id)
+		}
+	}
+	return response, nil
+}
+
+// ListAccounts returns a page of accounts. The response's NextCursor, when
+// set, fetches the following page with the same filter and sort.
+func (s *AccountServiceImpl) ListAccounts(ctx context.Context, filter models.AccountListFilter) (*models.AccountListResponse, error) {
+	if err := validateAccountListFilter(&filter); err != nil {
+		return nil, err
+	}
+
+	// Fetch one extra row to learn whether there is a next page
+	pageSize := filter.Limit
+	filter.Limit++
+	accounts, err := s.accountRepo.ListAccounts(ctx, filter)
+	if err != nil {
+		s.logger.Error("failed to list accounts", "error", err.Error())
+		return nil, err
+	}
+
+	response := &models.AccountListResponse{Accounts: make([]models.AccountResponse, 0, len(accounts))}
+	if len(accounts) > pageSize {
+		accounts = accounts[:pageSize]
+		response.NextCursor = accountCursor(accounts[pageSize-1], filter.SortBy).Encode()
+	}
+	for _, account := range accounts {
+		response.Accounts = append(response.Accounts, models.NewAccountResponse(account))
+	}
+	return response, nil
+}
+
+// accountCursor is the position of account in a listing sorted by sortBy.
+func accountCursor(account *models.Account, sortBy string) models.Cursor {
+	cursor := models.Cursor{ID: account.ID}
+	switch sortBy {
+	case models.AccountSortBalance:
+		cursor.Value = account.Balance.Format(0)
+	case models.AccountSortUpdatedAt:
+		cursor.Value = account.UpdatedAt.Format(time.RFC3339Nano)
+	default:
+		cursor.Value = account.CreatedAt.Format(time.RFC3339Nano)
+	}
+	return cursor
+}
+
+// validateAccountListFilter checks filter and applies the default sort and
+// page size.
+func validateAccountListFilter(filter *models.AccountListFilter) error {
+	switch filter.SortBy {
+	case "":
+		filter.SortBy = models.AccountSortCreatedAt
+	case models.AccountSortCreatedAt, models.AccountSortUpdatedAt, models.AccountSortBalance:
+	default:
+		return errors.NewValidationError("sort", "must be created_at, updated_at or balance")
+	}
+	if filter.MinBalance != nil && filter.MaxBalance != nil && filter.MinBalance.Cmp(*filter.MaxBalance) > 0 {
+		return errors.NewValidationError("min_balance", "must not exceed max_balance")
+	}
+	if filter.CreatedFrom != nil && filter.CreatedTo != nil && !filter.CreatedFrom.Before(*filter.CreatedTo) {
+		return errors.NewValidationError("created_from", "must be before created_to")
+	}
+	if filter.After != nil {
+		var err error
+		if filter.SortBy == models.AccountSortBalance {
+			_, err = money.Parse(filter.After.Value)
+		} else {
+			_, err = time.Parse(time.RFC3339Nano, filter.After.Value)
+		}
+		if err != nil {
+			return errors.NewValidationError("cursor", "does not match the sort")
+		}
+	}
+	if filter.Limit == 0 {
+		filter.Limit = defaultAccountPageSize
+	}
+	if filter.Limit < 0 || filter.Limit > maxAccountPageSize {
+		return errors.NewValidationError("limit", fmt.Sprintf("must be between 1 and %d", maxAccountPageSize))
+	}
+	return nil
+}
+
+// SetOverdraftLimit changes how far below zero an account may go. A limit
+// cannot be lowered past what the account already owes.
+func (s *AccountServiceImpl) SetOverdraftLimit(ctx context.Context, id string, req *models.SetOverdraftLimitRequest) (*models.Account, error) {
+	if id == "" {
+		return nil, errors.ErrInvalidAccountID
+	}
+	if models.IsSystemAccountID(id) {
+		return nil, errors.NewValidationError("id", "system accounts have no overdraft limit")
+	}
+	if req.OverdraftLimit.IsNegative() {
+		return nil, errors.NewValidationError("overdraft_limit", "must not be negative")
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		s.logger.Error("failed to begin transaction",
+			"error", err.Error(),
+		)
+		return nil, errors.NewTransactionError("begin", err)
+	}
+	defer func() {
+		if tx != nil {
+			tx.Rollback()
+		}
+	}()
+
+	account, err := s.lockAccount(ctx, tx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := checkETag(account, req.ExpectedETag); err != nil {
+		return nil, err
+	}
+	if account.Status == models.AccountStatusClosed {
+		return nil, errors.NewValidationError("id", "account is closed")
+	}
+	if !req.OverdraftLimit.FitsCurrency(account.Currency) {
+		return nil, errors.NewValidationError("overdraft_limit", fmt.Sprintf("must have at most %d decimal places for %s", account.Currency.Exponent(), account.Currency))
+	}
+	if account.Balance.Add(req.OverdraftLimit).IsNegative() {
+		return nil, errors.NewValidationError("overdraft_limit", fmt.Sprintf("must be at least %s, the amount the account is overdrawn by", account.Balance.Neg()))
+	}
+
+	oldLimit := account.OverdraftLimit
+	if err := s.accountRepo.UpdateOverdraftLimit(ctx, tx, id, req.OverdraftLimit); err != nil {
+		s.logger.Error("failed to update overdraft limit",
+			"account_id", id,
+			"error", err.Error(),
+		)
+		return nil, errors.NewTransactionError("update overdraft limit", err)
+	}
+	account.OverdraftLimit = req.OverdraftLimit
+	account.Version++
+
+	if err := s.createOverdraftAuditLog(ctx, tx, account, oldLimit); err != nil {
+		s.logger.Error("failed to create audit log for overdraft limit",
+			"account_id", id,
+			"error", err.Error(),
+		)
+		return nil, errors.NewTransactionError("create overdraft audit log", err)
+	}
+
+	if err := s.outbox.Enqueue(ctx, tx, models.DomainEventAccountOverdraftLimitChanged, models.NewAccountResponse(account), account.ID); err != nil {
+		s.logger.Error("failed to enqueue overdraft limit event",
+			"account_id", id,
+			"error", err.Error(),
+		)
+		return nil, errors.NewTransactionError("enqueue overdraft limit event", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		s.logger.Error("failed to commit overdraft limit",
+			"account_id", id,
+			"error", err.Error(),
+		)
+		return nil, errors.NewTransactionError("commit", err)
+	}
+	tx = nil
+
+	s.logger.Info("overdraft limit updated",
+		"account_id", id,
+		"old_limit", oldLimit,
+		"new_limit", account.OverdraftLimit,
+	)
+	return account, nil
+}
+
+// SetStatus moves an account through its lifecycle. Only the transitions in
+// models.CanTransitionAccountStatus are allowed, and an account can only be
+// closed once it holds no money and no active holds.
+func (s *AccountServiceImpl) SetStatus(ctx context.Context, id string, req *models.SetAccountStatusRequest) (*models.Account, error) {
+	if id == "" {
+		return nil, errors.ErrInvalidAccountID
+	}
+	if models.IsSystemAccountID(id) {
+		return nil, errors.NewValidationError("id", "system account status cannot be changed")
+	}
+	if !models.IsValidAccountStatus(req.Status) {
+		return nil, errors.NewValidationError("status", "must be one of ACTIVE, FROZEN, DEBIT_FROZEN, CREDIT_FROZEN, CLOSED")
+	}
+	if strings.TrimSpace(req.Reason) == "" {
+		return nil, errors.NewValidationError("reason", "must be non-empty")
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		s.logger.Error("failed to begin transaction",
+			"error", err.Error(),
+		)
+		return nil, errors.NewTransactionError("begin", err)
+	}
+	defer func() {
+		if tx != nil {
+			tx.Rollback()
+		}
+	}()
+
+	account, err := s.lockAccount(ctx, tx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := checkETag(account, req.ExpectedETag); err != nil {
+		return nil, err
+	}
+
+	oldStatus := account.Status
+	if !models.CanTransitionAccountStatus(oldStatus, req.Status) {
+		s.logger.Warn("account status transition not allowed",
+			"account_id", id,
+			"from", oldStatus,
+			"to", req.Status,
+		)
+		return nil, fmt.Errorf("%w: %s to %s", errors.ErrInvalidStatusChange, oldStatus, req.Status)
+	}
+	if req.Status == models.AccountStatusClosed && (!account.Balance.IsZero() || !account.HeldBalance.IsZero()) {
+		return nil, errors.ErrAccountNotEmpty
+	}
+
+	if err := s.accountRepo.UpdateAccountStatus(ctx, tx, id, req.Status); err != nil {
+		s.logger.Error("failed to update account status",
+			"account_id", id,
+			"error", err.Error(),
+		)
+		return nil, errors.NewTransactionError("update account status", err)
+	}
+	account.Status = req.Status
+	account.Version++
+
+	if err := s.createStatusAuditLog(ctx, tx, account, oldStatus, req.Reason); err != nil {
+		s.logger.Error("failed to create audit log for account status",
+			"account_id", id,
+			"error", err.Error(),
+		)
+		return nil, errors.NewTransactionError("create status audit log", err)
+	}
+
+	statusEvent := models.AccountStatusEventData{
+		Account:        models.NewAccountResponse(account),
+		PreviousStatus: oldStatus,
+		Reason:         req.Reason,
+	}
+	if err := s.outbox.Enqueue(ctx, tx, models.AccountStatusDomainEvent(account.Status), statusEvent, account.ID); err != nil {
+		s.logger.Error("failed to enqueue account status event",
+			"account_id", id,
+			"error", err.Error(),
+		)
+		return nil, errors.NewTransactionError("enqueue account status event", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		s.logger.Error("failed to commit account status",
+			"account_id", id,
+			"error", err.Error(),
+		)
+		return nil, errors.NewTransactionError("commit", err)
+	}
+	tx = nil
+
+	s.logger.Info("account status changed",
+		"account_id", id,
+		"from", oldStatus,
+		"to", account.Status,
+		"reason", req.Reason,
+	)
+	return account, nil
+}
+
+// lockAccount locks a customer account for update within tx.
+func (s *AccountServiceImpl) lockAccount(ctx context.Context, tx *sql.Tx, id string) (*models.Account, error) {
+	account, err := s.accountRepo.GetAccountByIDForUpdate(ctx, tx, id)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			s.logger.Warn("account not found",
+				"account_id", id,
+			)
+			return nil, err
+		}
+		s.logger.Error("failed to get account",
+			"account_id", id,
+			"error", err.Error(),
+		)
+		return nil, errors.NewTransactionError("get account", err)
+	}
+	return account, nil
+}
+
+// checkETag fails with ErrVersionMismatch if expected is set and the
+// locked account no longer has that ETag.
+func checkETag(account *models.Account, expected *string) error {
+	if expected != nil && *expected != account.ETag() {
+		return fmt.Errorf("%w: expected %q, current %q", errors.ErrVersionMismatch, *expected, account.ETag())
+	}
+	return nil
+}
+
 func (s *AccountServiceImpl) validateCreateRequest(req *models.CreateAccountRequest) error {
 	if req.ID == "" {
 		return errors.ErrInvalidAccountID
 	}
-	if req.InitialBalance < 0 {
+	if models.IsSystemAccountID(req.ID) {
+		return errors.NewValidationError("id", fmt.Sprintf("must not start with the reserved prefix %q", models.SystemAccountPrefix))
+	}
+	currency, err := money.ParseCurrency(req.Currency)
+	if err != nil {
+		return errors.NewValidationError("currency", "must be a supported ISO 4217 currency code")
+	}
+	// normalise so the stored code is always upper case
+	req.Currency = currency.String()
+
+	if req.InitialBalance.IsNegative() {
 		return errors.ErrNegativeBalance
 	}
+	if !req.InitialBalance.FitsCurrency(currency) {
+		return errors.NewValidationError("initial_balance", fmt.Sprintf("must have at most %d decimal places for %s", currency.Exponent(), currency))
+	}
 	return nil
 }
 
-func (s *AccountServiceImpl) createAccoutAuditLog(ctx context.Context, account *models.Account) error {
+// postOpeningBalance funds a new account from the opening-balance equity
+// account of its currency.
+func (s *AccountServiceImpl) postOpeningBalance(ctx context.Context, tx *sql.Tx, account *models.Account, amount money.Amount) error {
+	openingAccount, err := s.ledger.LockSystemAccount(ctx, tx, models.SystemAccountOpeningBalance, account.Currency)
+	if err != nil {
+		return err
+	}
+
+	entry := &models.JournalEntry{
+		Kind: models.JournalKindAccountOpening,
+		Postings: []models.Posting{
+			{AccountID: openingAccount.ID, Amount: amount.Neg(), Currency: account.Currency},
+			{AccountID: account.ID, Amount: amount, Currency: account.Currency},
+		},
+	}
+	return s.ledger.Post(ctx, tx, entry, openingAccount, account)
+}
+
+func (s *AccountServiceImpl) createAccoutAuditLog(ctx context.Context, tx *sql.Tx, account *models.Account) error {
 	snapshot := models.AccountBalanceSnapshot{
-		ID:      account.ID,
-		Balance: account.Balance,
+		ID:       account.ID,
+		Currency: account.Currency,
+		Balance:  account.Balance,
 	}
 
 	newValue, err := json.Marshal(snapshot)
@@ -117,13 +583,69 @@ func (s *AccountServiceImpl) createAccoutAuditLog(ctx context.Context, account *
 	}
 
 	auditLog := &models.AuditLog{
-		EntityType: models.EntityTypeAccount,
-		EntityID:   account.ID,
-		Action:     models.AuditActionCreate,
-		NewValue:   newValue,
+		Event:    models.AuditEventAccountCreated,
+		EntityID: account.ID,
+		NewValue: newValue,
+	}
+
+	return s.auditRepo.Create(ctx, tx, auditLog)
+}
+
+func (s *AccountServiceImpl) createOverdraftAuditLog(ctx context.Context, tx *sql.Tx, account *models.Account, oldLimit money.Amount) error {
+	oldValue, err := json.Marshal(models.AccountOverdraftSnapshot{
+		ID:             account.ID,
+		Currency:       account.Currency,
+		OverdraftLimit: oldLimit,
+	})
+	if err != nil {
+		return err
+	}
+
+	newValue, err := json.Marshal(models.AccountOverdraftSnapshot{
+		ID:             account.ID,
+		Currency:       account.Currency,
+		OverdraftLimit: account.OverdraftLimit,
+	})
+	if err != nil {
+		return err
+	}
+
+	auditLog := &models.AuditLog{
+		Event:    models.AuditEventAccountOverdraftLimitChanged,
+		EntityID: account.ID,
+		OldValue: oldValue,
+		NewValue: newValue,
+	}
+
+	return s.auditRepo.Create(ctx, tx, auditLog)
+}
+
+func (s *AccountServiceImpl) createStatusAuditLog(ctx context.Context, tx *sql.Tx, account *models.Account, oldStatus, reason string) error {
+	oldValue, err := json.Marshal(models.AccountStatusSnapshot{
+		ID:     account.ID,
+		Status: oldStatus,
+	})
+	if err != nil {
+		return err
+	}
+
+	newValue, err := json.Marshal(models.AccountStatusSnapshot{
+		ID:     account.ID,
+		Status: account.Status,
+		Reason: reason,
+	})
+	if err != nil {
+		return err
+	}
+
+	auditLog := &models.AuditLog{
+		Event:    models.AuditEventAccountStatusChanged,
+		EntityID: account.ID,
+		OldValue: oldValue,
+		NewValue: newValue,
 	}
 
-	return s.auditRepo.CreateWithDB(ctx, auditLog)
+	return s.auditRepo.Create(ctx, tx, auditLog)
 }
 
 // This function retrieves an account with a lock for updae within a trnasaction
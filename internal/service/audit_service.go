@@ -0,0 +1,297 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/riteshkumar/internal-transfers/internal/errors"
+	"github.com/riteshkumar/internal-transfers/internal/models"
+	"github.com/riteshkumar/internal-transfers/internal/repository"
+)
+
+// Page sizes of audit log queries.
+const (
+	defaultAuditPageSize = 100
+	maxAuditPageSize     = 500
+)
+
+// auditChainBatchSize is how many entries VerifyChain reads, and
+// ChainUnchained links, at a time.
+const auditChainBatchSize = 1000
+
+type AuditService interface {
+	ListAuditLogs(ctx context.Context, filter models.AuditLogFilter) (*models.AuditLogListResponse, error)
+	GetEntityState(ctx context.Context, auditLogID string) (*models.AuditEntityState, error)
+	VerifyChain(ctx context.Context) (*models.AuditChainReport, error)
+}
+
+type AuditServiceImpl struct {
+	auditRepo repository.AuditRepository
+	logger    *slog.Logger
+}
+
+func NewAuditService(auditRepo repository.AuditRepository, logger *slog.Logger) *AuditServiceImpl {
+	return &AuditServiceImpl{
+		auditRepo: auditRepo,
+		logger:    logger,
+	}
+}
+
+// ListAuditLogs returns a page of audit logs, newest first. The response's
+// NextCursor, when set, fetches the following page with the same filter.
+// Every log has its patch, computed for entries written without one.
+func (s *AuditServiceImpl) ListAuditLogs(ctx context.Context, filter models.AuditLogFilter) (*models.AuditLogListResponse, error) {
+	if err := validateAuditLogFilter(&filter); err != nil {
+		return nil, err
+	}
+
+	// Fetch one extra row to learn whether there is a next page
+	pageSize := filter.Limit
+	filter.Limit++
+	logs, err := s.auditRepo.List(ctx, filter)
+	if err != nil {
+		s.logger.Error("failed to list audit logs",
+			"entity_type", filter.EntityType,
+			"entity_id", filter.EntityID,
+			"error", err.Error(),
+		)
+		return nil, err
+	}
+
+	response := &models.AuditLogListResponse{AuditLogs: logs}
+	if len(logs) > pageSize {
+		response.AuditLogs = logs[:pageSize]
+		last := response.AuditLogs[pageSize-1]
+		response.NextCursor = models.Cursor{
+			Value: last.CreatedAt.Format(time.RFC3339Nano),
+			ID:    last.ID,
+		}.Encode()
+	}
+	if response.AuditLogs == nil {
+		response.AuditLogs = []*models.AuditLog{}
+	}
+
+	for _, log := range response.AuditLogs {
+		if err := ensurePatch(log); err != nil {
+			s.logger.Error("failed to diff audit log values",
+				"audit_log_id", log.ID,
+				"error", err.Error(),
+			)
+			return nil, err
+		}
+		if filter.ChangesOnly {
+			log.OldValue, log.NewValue = nil, nil
+		}
+	}
+	return response, nil
+}
+
+// GetEntityState rebuilds the state of an audit log's entity as of that
+// log by replaying the patches of the entity's logs, oldest first. The
+// entity's snapshots differ by event, e.g. balance or status, so the state
+// accumulates every field any of them recorded.
+func (s *AuditServiceImpl) GetEntityState(ctx context.Context, auditLogID string) (*models.AuditEntityState, error) {
+	if _, err := uuid.Parse(auditLogID); err != nil {
+		return nil, errors.ErrInvalidAuditLogID
+	}
+
+	target, err := s.auditRepo.GetByID(ctx, auditLogID)
+	if err != nil {
+		if err != errors.ErrAuditLogNotFound {
+			s.logger.Error("failed to get audit log", "audit_log_id", auditLogID, "error", err.Error())
+		}
+		return nil, err
+	}
+
+	logs, err := s.auditRepo.ListEntityHistory(ctx, target)
+	if err != nil {
+		s.logger.Error("failed to list audit log entity history",
+			"entity_type", target.EntityType,
+			"entity_id", target.EntityID,
+			"error", err.Error(),
+		)
+		return nil, err
+	}
+
+	var state json.RawMessage
+	for _, log := range logs {
+		if err := ensurePatch(log); err != nil {
+			return nil, fmt.Errorf("failed to diff audit log %s: %w", log.ID, err)
+		}
+		if state, err = log.Patch.Merge(state); err != nil {
+			s.logger.Error("failed to replay audit log patch",
+				"audit_log_id", log.ID,
+				"error", err.Error(),
+			)
+			return nil, fmt.Errorf("failed to replay audit log %s: %w", log.ID, err)
+		}
+	}
+
+	return &models.AuditEntityState{
+		AuditLogID:      target.ID,
+		EntityType:      target.EntityType,
+		EntityID:        target.EntityID,
+		State:           state,
+		EntriesReplayed: len(logs),
+		CreatedAt:       target.CreatedAt,
+	}, nil
+}
+
+// ensurePatch computes the patch of a log written before patches were
+// stored.
+func ensurePatch(log *models.AuditLog) error {
+	if log.Patch != nil {
+		return nil
+	}
+	return log.ComputePatch()
+}
+
+// validateAuditLogFilter checks filter and applies the default page size.
+func validateAuditLogFilter(filter *models.AuditLogFilter) error {
+	if filter.Event != "" {
+		if _, ok := models.LookupAuditEvent(filter.Event); !ok {
+			return errors.NewValidationError("event", fmt.Sprintf("unknown audit event %q", filter.Event))
+		}
+	}
+	if filter.From != nil && filter.To != nil && !filter.From.Before(*filter.To) {
+		return errors.NewValidationError("from", "must be before to")
+	}
+	if filter.After != nil {
+		if _, err := time.Parse(time.RFC3339Nano, filter.After.Value); err != nil {
+			return errors.NewValidationError("cursor", "is malformed")
+		}
+		if _, err := uuid.Parse(filter.After.ID); err != nil {
+			return errors.NewValidationError("cursor", "is malformed")
+		}
+	}
+	if filter.Limit == 0 {
+		filter.Limit = defaultAuditPageSize
+	}
+	if filter.Limit < 0 || filter.Limit > maxAuditPageSize {
+		return errors.NewValidationError("limit", fmt.Sprintf("must be between 1 and %d", maxAuditPageSize))
+	}
+	return nil
+}
+
+// ChainUnchained links entries left unchained by servers that chained
+// after commit, and returns how many it linked. Writers chain their own
+// entries, so it only needs to run once at startup.
+func (s *AuditServiceImpl) ChainUnchained(ctx context.Context) (int, error) {
+	var total int
+	for {
+		chained, err := s.auditRepo.ChainUnchained(ctx, auditChainBatchSize)
+		if err != nil {
+			s.logger.Error("failed to chain audit logs", "error", err.Error())
+			return total, err
+		}
+		total += chained
+		if chained < auditChainBatchSize {
+			break
+		}
+	}
+	if total > 0 {
+		s.logger.Info("unchained audit logs chained", "count", total)
+	}
+	return total, nil
+}
+
+// VerifyChain walks the audit hash chain from the first entry to the current
+// head. It recomputes every entry's hash and checks that entries are
+// numbered without gaps and each links to its predecessor, stopping at the
+// first entry that doesn't. Entries chained after the walk starts, and
+// those not chained yet, are not checked; the report counts the latter.
+func (s *AuditServiceImpl) VerifyChain(ctx context.Context) (*models.AuditChainReport, error) {
+	headSequence, headHash, err := s.auditRepo.GetChainHead(ctx)
+	if err != nil {
+		s.logger.Error("failed to get audit chain head", "error", err.Error())
+		return nil, err
+	}
+	unchained, err := s.auditRepo.CountUnchained(ctx)
+	if err != nil {
+		s.logger.Error("failed to count unchained audit logs", "error", err.Error())
+		return nil, err
+	}
+
+	report := &models.AuditChainReport{HeadSequence: headSequence, UnchainedEntries: unchained}
+	previousSequence, previousHash := int64(0), models.AuditChainGenesisHash
+	for previousSequence < headSequence {
+		logs, err := s.auditRepo.ListChain(ctx, previousSequence, headSequence, auditChainBatchSize)
+		if err != nil {
+			s.logger.Error("failed to read audit chain",
+				"after_sequence", previousSequence,
+				"error", err.Error(),
+			)
+			return nil, err
+		}
+		if len(logs) == 0 {
+			break
+		}
+
+		for _, log := range logs {
+			if broken := verifyChainLink(log, previousSequence, previousHash); broken != nil {
+				return s.brokenChain(report, broken), nil
+			}
+			previousSequence, previousHash = *log.Sequence, log.Hash
+			report.EntriesVerified++
+		}
+	}
+
+	// Entries missing from the end, or a head that was rewritten
+	if previousSequence != headSequence {
+		return s.brokenChain(report, &models.AuditChainBreak{
+			Sequence: previousSequence + 1,
+			Reason:   "entry is missing",
+		}), nil
+	}
+	if previousHash != headHash {
+		return s.brokenChain(report, &models.AuditChainBreak{
+			Sequence: headSequence,
+			Reason:   "chain head hash does not match the last entry",
+		}), nil
+	}
+
+	report.Valid = true
+	s.logger.Info("audit chain verified", "entries", report.EntriesVerified)
+	return report, nil
+}
+
+// verifyChainLink checks log as the successor of the entry with
+// previousSequence and previousHash.
+func verifyChainLink(log *models.AuditLog, previousSequence int64, previousHash string) *models.AuditChainBreak {
+	if *log.Sequence != previousSequence+1 {
+		return &models.AuditChainBreak{Sequence: previousSequence + 1, Reason: "entry is missing"}
+	}
+	if log.PrevHash != previousHash {
+		return &models.AuditChainBreak{Sequence: *log.Sequence, AuditLogID: log.ID, Reason: "previous hash does not match the previous entry"}
+	}
+	hash, err := log.ComputeHash()
+	if err != nil {
+		return &models.AuditChainBreak{Sequence: *log.Sequence, AuditLogID: log.ID, Reason: "content cannot be hashed: " + err.Error()}
+	}
+	if hash != log.Hash {
+		return &models.AuditChainBreak{Sequence: *log.Sequence, AuditLogID: log.ID, Reason: "hash does not match the entry's content"}
+	}
+	// The patch isn't hashed, as it follows from the values; check it does
+	if log.Patch != nil {
+		if matches, err := log.PatchMatches(); err != nil || !matches {
+			return &models.AuditChainBreak{Sequence: *log.Sequence, AuditLogID: log.ID, Reason: "patch does not match the entry's values"}
+		}
+	}
+	return nil
+}
+
+func (s *AuditServiceImpl) brokenChain(report *models.AuditChainReport, broken *models.AuditChainBreak) *models.AuditChainReport {
+	report.BrokenAt = broken
+	s.logger.Error("audit chain broken",
+		"sequence", broken.Sequence,
+		"audit_log_id", broken.AuditLogID,
+		"reason", broken.Reason,
+		"entries_verified", report.EntriesVerified,
+	)
+	return report
+}
@@ -0,0 +1,58 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"expvar"
+	"fmt"
+	"log/slog"
+)
+
+// Audit writes given up on outside strict mode, published at
+// /admin/debug/vars and keyed by operation.
+var auditWriteFailures = expvar.NewMap("audit_write_failures")
+
+// AuditWriter writes the audit entries of an operation inside the
+// operation's own db txn. In strict mode a failed write is returned, so the
+// whole operation rolls back with it. Otherwise the writes run under a
+// savepoint: a failure rolls back only the audit entries, is logged and
+// counted, and the operation goes ahead without them.
+type AuditWriter struct {
+	strict bool
+	logger *slog.Logger
+}
+
+func NewAuditWriter(strict bool, logger *slog.Logger) *AuditWriter {
+	return &AuditWriter{
+		strict: strict,
+		logger: logger,
+	}
+}
+
+// Write runs write, which writes the audit entries of operation within tx.
+func (a *AuditWriter) Write(ctx context.Context, tx *sql.Tx, operation string, write func() error) error {
+	if a.strict {
+		return write()
+	}
+
+	// A failed statement aborts the whole txn in Postgres unless it is
+	// rolled back to a savepoint
+	if _, err := tx.ExecContext(ctx, "SAVEPOINT audit"); err != nil {
+		return fmt.Errorf("failed to set audit savepoint: %w", err)
+	}
+	if err := write(); err != nil {
+		if _, rollbackErr := tx.ExecContext(ctx, "ROLLBACK TO SAVEPOINT audit"); rollbackErr != nil {
+			return fmt.Errorf("failed to roll back audit savepoint after %v: %w", err, rollbackErr)
+		}
+		auditWriteFailures.Add(operation, 1)
+		a.logger.Error("audit write failed, continuing without audit entries",
+			"operation", operation,
+			"error", err.Error(),
+		)
+		return nil
+	}
+	if _, err := tx.ExecContext(ctx, "RELEASE SAVEPOINT audit"); err != nil {
+		return fmt.Errorf("failed to release audit savepoint: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,174 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/riteshkumar/internal-transfers/internal/errors"
+	"github.com/riteshkumar/internal-transfers/internal/models"
+	"github.com/riteshkumar/internal-transfers/internal/money"
+	"github.com/riteshkumar/internal-transfers/internal/repository"
+)
+
+// maxFXRatesPerUpload bounds the size of a single rate upload.
+const maxFXRatesPerUpload = 1000
+
+type FXRateService interface {
+	UploadRates(ctx context.Context, req *models.UploadFXRatesRequest) ([]*models.FXRate, error)
+	ListRates(ctx context.Context, baseCurrency, quoteCurrency string) ([]*models.FXRate, error)
+}
+
+type FXRateServiceImpl struct {
+	db         *sql.DB
+	fxRateRepo repository.FXRateRepository
+	auditRepo  repository.AuditRepository
+	logger     *slog.Logger
+}
+
+func NewFXRateService(db *sql.DB, fxRateRepo repository.FXRateRepository, auditRepo repository.AuditRepository, logger *slog.Logger) *FXRateServiceImpl {
+	return &FXRateServiceImpl{
+		db:         db,
+		fxRateRepo: fxRateRepo,
+		auditRepo:  auditRepo,
+		logger:     logger,
+	}
+}
+
+// UploadRates stores a batch of rates atomically: either every rate in the
+// request is accepted or none is.
+func (s *FXRateServiceImpl) UploadRates(ctx context.Context, req *models.UploadFXRatesRequest) ([]*models.FXRate, error) {
+	if len(req.Rates) == 0 {
+		return nil, errors.NewValidationError("rates", "must contain at least one rate")
+	}
+	if len(req.Rates) > maxFXRatesPerUpload {
+		return nil, errors.NewValidationError("rates", fmt.Sprintf("must contain at most %d rates", maxFXRatesPerUpload))
+	}
+
+	now := time.Now()
+	rates := make([]*models.FXRate, 0, len(req.Rates))
+	for i := range req.Rates {
+		rate, err := s.validateRate(&req.Rates[i], i, now)
+		if err != nil {
+			s.logger.Warn("invalid fx rate upload", "error", err.Error())
+			return nil, err
+		}
+		rates = append(rates, rate)
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		s.logger.Error("failed to begin transaction", "error", err.Error())
+		return nil, errors.NewTransactionError("begin", err)
+	}
+	defer func() {
+		if tx != nil {
+			tx.Rollback()
+		}
+	}()
+
+	for _, rate := range rates {
+		if err := s.fxRateRepo.Create(ctx, tx, rate); err != nil {
+			s.logger.Error("failed to create fx rate",
+				"base_currency", rate.BaseCurrency,
+				"quote_currency", rate.QuoteCurrency,
+				"error", err.Error(),
+			)
+			return nil, errors.NewTransactionError("create fx rate", err)
+		}
+
+		if err := s.createFXRateAuditLog(ctx, tx, rate); err != nil {
+			s.logger.Error("failed to create audit log for fx rate",
+				"fx_rate_id", rate.ID,
+				"error", err.Error(),
+			)
+			return nil, errors.NewTransactionError("create fx rate audit log", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		s.logger.Error("failed to commit fx rate upload", "error", err.Error())
+		return nil, errors.NewTransactionError("commit", err)
+	}
+	tx = nil
+
+	s.logger.Info("fx rates uploaded", "count", len(rates))
+	return rates, nil
+}
+
+func (s *FXRateServiceImpl) ListRates(ctx context.Context, baseCurrency, quoteCurrency string) ([]*models.FXRate, error) {
+	var base, quote money.Currency
+	var err error
+	if baseCurrency != "" {
+		if base, err = money.ParseCurrency(baseCurrency); err != nil {
+			return nil, errors.NewValidationError("base_currency", "must be a supported ISO 4217 currency code")
+		}
+	}
+	if quoteCurrency != "" {
+		if quote, err = money.ParseCurrency(quoteCurrency); err != nil {
+			return nil, errors.NewValidationError("quote_currency", "must be a supported ISO 4217 currency code")
+		}
+	}
+
+	rates, err := s.fxRateRepo.List(ctx, base, quote)
+	if err != nil {
+		s.logger.Error("failed to list fx rates", "error", err.Error())
+		return nil, err
+	}
+	return rates, nil
+}
+
+func (s *FXRateServiceImpl) validateRate(req *models.CreateFXRateRequest, index int, now time.Time) (*models.FXRate, error) {
+	field := func(name string) string {
+		return fmt.Sprintf("rates[%d].%s", index, name)
+	}
+
+	base, err := money.ParseCurrency(req.BaseCurrency)
+	if err != nil {
+		return nil, errors.NewValidationError(field("base_currency"), "must be a supported ISO 4217 currency code")
+	}
+	quote, err := money.ParseCurrency(req.QuoteCurrency)
+	if err != nil {
+		return nil, errors.NewValidationError(field("quote_currency"), "must be a supported ISO 4217 currency code")
+	}
+	if base == quote {
+		return nil, errors.NewValidationError(field("quote_currency"), "must differ from base_currency")
+	}
+	if !req.Rate.IsPositive() {
+		return nil, errors.NewValidationError(field("rate"), "must be greater than zero")
+	}
+
+	validFrom := req.ValidFrom
+	if validFrom.IsZero() {
+		validFrom = now
+	}
+	if req.ValidTo != nil && !req.ValidTo.After(validFrom) {
+		return nil, errors.NewValidationError(field("valid_to"), "must be after valid_from")
+	}
+
+	return &models.FXRate{
+		BaseCurrency:  base,
+		QuoteCurrency: quote,
+		Rate:          req.Rate,
+		ValidFrom:     validFrom,
+		ValidTo:       req.ValidTo,
+	}, nil
+}
+
+func (s *FXRateServiceImpl) createFXRateAuditLog(ctx context.Context, tx *sql.Tx, rate *models.FXRate) error {
+	newValue, err := json.Marshal(rate)
+	if err != nil {
+		return err
+	}
+
+	auditLog := &models.AuditLog{
+		Event:    models.AuditEventFXRateCreated,
+		EntityID: rate.ID,
+		NewValue: newValue,
+	}
+
+	return s.auditRepo.Create(ctx, tx, auditLog)
+}
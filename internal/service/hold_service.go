@@ -0,0 +1,491 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"slices"
+	"time"
+
+	"github.com/riteshkumar/internal-transfers/internal/errors"
+	"github.com/riteshkumar/internal-transfers/internal/models"
+	"github.com/riteshkumar/internal-transfers/internal/repository"
+)
+
+const (
+	// DefaultHoldTTL applies when a hold request does not set an expiry.
+	DefaultHoldTTL = 7 * 24 * time.Hour
+	// MaxHoldTTL is the longest a hold may reserve funds for.
+	MaxHoldTTL = 30 * 24 * time.Hour
+
+	// expireHoldsBatchSize bounds how many holds one expiry run touches.
+	expireHoldsBatchSize = 500
+
+	// holdExpiryPrincipal is the audit actor of background hold expiries.
+	holdExpiryPrincipal = "system:hold-expiry"
+)
+
+type HoldService interface {
+	Authorize(ctx context.Context, req *models.CreateHoldRequest) (*models.Hold, error)
+	Capture(ctx context.Context, id string, req *models.CaptureHoldRequest) (*models.Transaction, error)
+	Void(ctx context.Context, id string, req *models.VoidHoldRequest) (*models.Hold, error)
+	GetHold(ctx context.Context, id string) (*models.Hold, error)
+	ExpireHolds(ctx context.Context) (int, error)
+}
+
+type HoldServiceImpl struct {
+	db           *sql.DB
+	accountRepo  repository.AccountRepository
+	holdRepo     repository.HoldRepository
+	auditRepo    repository.AuditRepository
+	transactions *TransactionServiceImpl
+	logger       *slog.Logger
+}
+
+func NewHoldService(db *sql.DB, accountRepo repository.AccountRepository, holdRepo repository.HoldRepository, auditRepo repository.AuditRepository, transactions *TransactionServiceImpl, logger *slog.Logger) *HoldServiceImpl {
+	return &HoldServiceImpl{
+		db:           db,
+		accountRepo:  accountRepo,
+		holdRepo:     holdRepo,
+		auditRepo:    auditRepo,
+		transactions: transactions,
+		logger:       logger,
+	}
+}
+
+// Authorize reserves funds on an account. The account row is locked while
+// the available balance is checked so that concurrent holds and transfers
+// cannot oversubscribe it.
+func (s *HoldServiceImpl) Authorize(ctx context.Context, req *models.CreateHoldRequest) (*models.Hold, error) {
+	ttl, err := s.validateAuthorizeRequest(req)
+	if err != nil {
+		s.logger.Warn("invalid hold request",
+			"account_id", req.AccountID,
+			"error", err.Error(),
+		)
+		return nil, err
+	}
+
+	var hold *models.Hold
+	err = withRetry(ctx, s.logger, "authorize_hold", func() error {
+		var err error
+		hold, err = s.authorizeOnce(ctx, req, ttl)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return hold, nil
+}
+
+// authorizeOnce makes one attempt at Authorize in its own db txn.
+func (s *HoldServiceImpl) authorizeOnce(ctx context.Context, req *models.CreateHoldRequest, ttl time.Duration) (*models.Hold, error) {
+	tx, err := s.db.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelSerializable})
+	if err != nil {
+		s.logger.Error("failed to begin transaction", "error", err.Error())
+		return nil, errors.NewTransactionError("begin", err)
+	}
+	defer func() {
+		if tx != nil {
+			tx.Rollback()
+		}
+	}()
+
+	account, err := s.accountRepo.GetAccountByIDForUpdate(ctx, tx, req.AccountID)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			s.logger.Warn("hold account not found", "account_id", req.AccountID)
+			return nil, err
+		}
+		s.logger.Error("failed to get hold account",
+			"account_id", req.AccountID,
+			"error", err.Error(),
+		)
+		return nil, errors.NewTransactionError("get hold account", err)
+	}
+
+	if err := checkETag(account, req.ExpectedETag); err != nil {
+		return nil, err
+	}
+	if !account.CanDebit() {
+		return nil, errors.NewAccountStatusError(account.ID, account.Status, "debit")
+	}
+	if !req.Amount.FitsCurrency(account.Currency) {
+		return nil, errors.NewValidationError("amount", fmt.Sprintf("must have at most %d decimal places for %s", account.Currency.Exponent(), account.Currency))
+	}
+
+	if account.AvailableBalance().Cmp(req.Amount) < 0 {
+		s.logger.Warn("insufficient available balance for hold",
+			"account_id", req.AccountID,
+			"available_balance", account.AvailableBalance(),
+			"requested_amount", req.Amount,
+		)
+		return nil, errors.ErrInsufficentBalance
+	}
+
+	hold := &models.Hold{
+		AccountID: account.ID,
+		Amount:    req.Amount,
+		Currency:  account.Currency,
+		Status:    models.HoldStatusActive,
+		ExpiresAt: time.Now().Add(ttl),
+	}
+	if err := s.holdRepo.Create(ctx, tx, hold); err != nil {
+		s.logger.Error("failed to create hold",
+			"account_id", req.AccountID,
+			"error", err.Error(),
+		)
+		return nil, errors.NewTransactionError("create hold", err)
+	}
+
+	// Holds change the available balance, so they change the account version
+	if err := s.accountRepo.BumpVersion(ctx, tx, account.ID); err != nil {
+		s.logger.Error("failed to bump account version",
+			"account_id", account.ID,
+			"error", err.Error(),
+		)
+		return nil, errors.NewTransactionError("bump account version", err)
+	}
+
+	if err := s.createHoldAuditLog(ctx, tx, models.AuditEventHoldCreated, nil, hold); err != nil {
+		s.logger.Error("failed to create audit log for hold",
+			"hold_id", hold.ID,
+			"error", err.Error(),
+		)
+		return nil, errors.NewTransactionError("create hold audit log", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		s.logger.Error("failed to commit hold", "hold_id", hold.ID, "error", err.Error())
+		return nil, errors.NewTransactionError("commit", err)
+	}
+	tx = nil
+
+	s.logger.Info("hold authorized",
+		"hold_id", hold.ID,
+		"account_id", hold.AccountID,
+		"amount", hold.Amount,
+	)
+	return hold, nil
+}
+
+// Capture turns all or part of an active hold into a transfer from the held
+// account. The whole hold is released; any uncaptured remainder becomes
+// available again.
+func (s *HoldServiceImpl) Capture(ctx context.Context, id string, req *models.CaptureHoldRequest) (*models.Transaction, error) {
+	if req.DestinationAccountID == "" {
+		return nil, errors.NewValidationError("destination_account_id", "must be non-empty")
+	}
+
+	var transaction *models.Transaction
+	err := withRetry(ctx, s.logger, "capture_hold", func() error {
+		var err error
+		transaction, err = s.captureOnce(ctx, id, req)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return transaction, nil
+}
+
+// captureOnce makes one attempt at Capture in its own db txn.
+func (s *HoldServiceImpl) captureOnce(ctx context.Context, id string, req *models.CaptureHoldRequest) (*models.Transaction, error) {
+	tx, err := s.db.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelSerializable})
+	if err != nil {
+		s.logger.Error("failed to begin transaction", "error", err.Error())
+		return nil, errors.NewTransactionError("begin", err)
+	}
+	defer func() {
+		if tx != nil {
+			tx.Rollback()
+		}
+	}()
+
+	hold, err := s.lockActiveHold(ctx, tx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	amount := hold.Amount
+	if req.Amount != nil {
+		amount = *req.Amount
+	}
+	if amount.Cmp(hold.Amount) > 0 {
+		return nil, errors.ErrHoldAmountExceeded
+	}
+
+	transferReq := &models.CreateTransactionRequest{
+		SourceAccountID:      hold.AccountID,
+		DestinationAccountID: req.DestinationAccountID,
+		Amount:               amount,
+		ExpectedETag:         req.ExpectedETag,
+	}
+	if err := s.transactions.validateTransferRequest(ctx, transferReq); err != nil {
+		return nil, err
+	}
+
+	transaction, err := s.transactions.transferInTx(ctx, tx, transferReq, hold.Amount)
+	if err != nil {
+		return nil, err
+	}
+
+	oldHold := *hold
+	hold.Status = models.HoldStatusCaptured
+	hold.CapturedAmount = &amount
+	hold.TransactionID = &transaction.ID
+	if err := s.updateHold(ctx, tx, models.AuditEventHoldCaptured, &oldHold, hold); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		s.logger.Error("failed to commit hold capture", "hold_id", id, "error", err.Error())
+		return nil, errors.NewTransactionError("commit", err)
+	}
+	tx = nil
+
+	s.logger.Info("hold captured",
+		"hold_id", hold.ID,
+		"transaction_id", transaction.ID,
+		"captured_amount", amount,
+	)
+	return transaction, nil
+}
+
+// Void releases an active hold without moving any money.
+func (s *HoldServiceImpl) Void(ctx context.Context, id string, req *models.VoidHoldRequest) (*models.Hold, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		s.logger.Error("failed to begin transaction", "error", err.Error())
+		return nil, errors.NewTransactionError("begin", err)
+	}
+	defer func() {
+		if tx != nil {
+			tx.Rollback()
+		}
+	}()
+
+	hold, err := s.lockActiveHold(ctx, tx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	// The account is only read, under lock, to check the precondition
+	if req.ExpectedETag != nil {
+		account, err := s.accountRepo.GetAccountByIDForUpdate(ctx, tx, hold.AccountID)
+		if err != nil {
+			s.logger.Error("failed to get hold account",
+				"account_id", hold.AccountID,
+				"error", err.Error(),
+			)
+			return nil, errors.NewTransactionError("get hold account", err)
+		}
+		if err := checkETag(account, req.ExpectedETag); err != nil {
+			return nil, err
+		}
+	}
+
+	oldHold := *hold
+	hold.Status = models.HoldStatusVoided
+	if err := s.updateHold(ctx, tx, models.AuditEventHoldVoided, &oldHold, hold); err != nil {
+		return nil, err
+	}
+	if err := s.accountRepo.BumpVersion(ctx, tx, hold.AccountID); err != nil {
+		s.logger.Error("failed to bump account version",
+			"account_id", hold.AccountID,
+			"error", err.Error(),
+		)
+		return nil, errors.NewTransactionError("bump account version", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		s.logger.Error("failed to commit hold void", "hold_id", id, "error", err.Error())
+		return nil, errors.NewTransactionError("commit", err)
+	}
+	tx = nil
+
+	s.logger.Info("hold voided", "hold_id", hold.ID)
+	return hold, nil
+}
+
+func (s *HoldServiceImpl) GetHold(ctx context.Context, id string) (*models.Hold, error) {
+	hold, err := s.holdRepo.GetByID(ctx, id)
+	if err != nil {
+		if !errors.IsHoldNotFound(err) {
+			s.logger.Error("failed to get hold", "hold_id", id, "error", err.Error())
+		}
+		return nil, err
+	}
+	return hold, nil
+}
+
+// ExpireHolds marks holds past their expiry as EXPIRED. Expired holds stop
+// counting against the available balance as soon as their expiry passes;
+// this only brings the stored status in line and records the audit trail.
+func (s *HoldServiceImpl) ExpireHolds(ctx context.Context) (int, error) {
+	var expired int
+	err := withRetry(ctx, s.logger, "expire_holds", func() error {
+		var err error
+		expired, err = s.expireHoldsOnce(ctx)
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	if expired > 0 {
+		s.logger.Info("holds expired", "count", expired)
+	}
+	return expired, nil
+}
+
+// expireHoldsOnce expires one batch of holds in a db transaction. Their
+// accounts are locked in ID order, as transfers lock them, before any
+// audit entry is written.
+func (s *HoldServiceImpl) expireHoldsOnce(ctx context.Context) (int, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, errors.NewTransactionError("begin", err)
+	}
+	defer func() {
+		if tx != nil {
+			tx.Rollback()
+		}
+	}()
+
+	holds, err := s.holdRepo.ExpireDue(ctx, tx, time.Now(), expireHoldsBatchSize)
+	if err != nil {
+		return 0, errors.NewTransactionError("expire holds", err)
+	}
+
+	accountIDs := make([]string, 0, len(holds))
+	for _, hold := range holds {
+		accountIDs = append(accountIDs, hold.AccountID)
+	}
+	slices.Sort(accountIDs)
+	for _, id := range slices.Compact(accountIDs) {
+		if err := s.accountRepo.BumpVersion(ctx, tx, id); err != nil {
+			return 0, errors.NewTransactionError("bump account version", err)
+		}
+	}
+
+	for _, hold := range holds {
+		oldHold := *hold
+		oldHold.Status = models.HoldStatusActive
+		if err := s.createHoldAuditLog(ctx, tx, models.AuditEventHoldExpired, &oldHold, hold); err != nil {
+			return 0, errors.NewTransactionError("create hold audit log", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, errors.NewTransactionError("commit", err)
+	}
+	tx = nil
+
+	return len(holds), nil
+}
+
+// RunExpiry calls ExpireHolds every interval until ctx is cancelled. The
+// expiries are audited as done by holdExpiryPrincipal.
+func (s *HoldServiceImpl) RunExpiry(ctx context.Context, interval time.Duration) {
+	ctx = models.WithAuditActor(ctx, &models.AuditActor{Principal: holdExpiryPrincipal})
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := s.ExpireHolds(ctx); err != nil {
+				s.logger.Error("failed to expire holds", "error", err.Error())
+			}
+		}
+	}
+}
+
+// lockActiveHold locks a hold and checks it can still be captured or voided.
+func (s *HoldServiceImpl) lockActiveHold(ctx context.Context, tx *sql.Tx, id string) (*models.Hold, error) {
+	hold, err := s.holdRepo.GetByIDForUpdate(ctx, tx, id)
+	if err != nil {
+		if errors.IsHoldNotFound(err) {
+			return nil, err
+		}
+		s.logger.Error("failed to get hold", "hold_id", id, "error", err.Error())
+		return nil, errors.NewTransactionError("get hold", err)
+	}
+
+	if hold.Status != models.HoldStatusActive {
+		return nil, fmt.Errorf("%w: hold is %s", errors.ErrHoldNotActive, hold.Status)
+	}
+	if !hold.ExpiresAt.After(time.Now()) {
+		return nil, fmt.Errorf("%w: hold expired at %s", errors.ErrHoldNotActive, hold.ExpiresAt.Format(time.RFC3339))
+	}
+	return hold, nil
+}
+
+func (s *HoldServiceImpl) updateHold(ctx context.Context, tx *sql.Tx, event models.AuditEvent, oldHold, hold *models.Hold) error {
+	if err := s.holdRepo.Update(ctx, tx, hold); err != nil {
+		s.logger.Error("failed to update hold", "hold_id", hold.ID, "error", err.Error())
+		return errors.NewTransactionError("update hold", err)
+	}
+
+	if err := s.createHoldAuditLog(ctx, tx, event, oldHold, hold); err != nil {
+		s.logger.Error("failed to create audit log for hold",
+			"hold_id", hold.ID,
+			"error", err.Error(),
+		)
+		return errors.NewTransactionError("create hold audit log", err)
+	}
+	return nil
+}
+
+func (s *HoldServiceImpl) validateAuthorizeRequest(req *models.CreateHoldRequest) (time.Duration, error) {
+	if req.AccountID == "" {
+		return 0, errors.NewValidationError("account_id", "must be non-empty")
+	}
+	if models.IsSystemAccountID(req.AccountID) {
+		return 0, errors.NewValidationError("account_id", "system accounts cannot be held")
+	}
+	if !req.Amount.IsPositive() {
+		return 0, errors.ErrInvalidAmount
+	}
+
+	if req.ExpiresInSeconds < 0 {
+		return 0, errors.NewValidationError("expires_in_seconds", "must not be negative")
+	}
+	ttl := DefaultHoldTTL
+	if req.ExpiresInSeconds > 0 {
+		ttl = time.Duration(req.ExpiresInSeconds) * time.Second
+	}
+	if ttl > MaxHoldTTL {
+		return 0, errors.NewValidationError("expires_in_seconds", fmt.Sprintf("must be at most %d", int64(MaxHoldTTL/time.Second)))
+	}
+	return ttl, nil
+}
+
+func (s *HoldServiceImpl) createHoldAuditLog(ctx context.Context, tx *sql.Tx, event models.AuditEvent, oldHold, newHold *models.Hold) error {
+	var oldValue json.RawMessage
+	if oldHold != nil {
+		var err error
+		if oldValue, err = json.Marshal(oldHold); err != nil {
+			return err
+		}
+	}
+
+	newValue, err := json.Marshal(newHold)
+	if err != nil {
+		return err
+	}
+
+	auditLog := &models.AuditLog{
+		Event:    event,
+		EntityID: newHold.ID,
+		OldValue: oldValue,
+		NewValue: newValue,
+	}
+
+	return s.auditRepo.Create(ctx, tx, auditLog)
+}
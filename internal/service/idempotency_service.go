@@ -0,0 +1,180 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/riteshkumar/internal-transfers/internal/errors"
+	"github.com/riteshkumar/internal-transfers/internal/models"
+	"github.com/riteshkumar/internal-transfers/internal/repository"
+)
+
+const (
+	// DefaultIdempotencyKeyTTL is how long a key replays its response.
+	DefaultIdempotencyKeyTTL = 24 * time.Hour
+
+	// maxIdempotencyKeyLength matches the idempotency_keys.key column.
+	maxIdempotencyKeyLength = 255
+)
+
+// IdempotencyKey identifies one idempotent request: the principal that made
+// it, the endpoint it was made to, the client-supplied key and a fingerprint
+// of the request body. Callers can't see or collide with each other's keys.
+type IdempotencyKey struct {
+	Principal   string
+	Scope       string
+	Key         string
+	Fingerprint string
+}
+
+// NewIdempotencyKey validates key and fingerprints req, which should be the
+// decoded request so that formatting differences in the body do not matter.
+func NewIdempotencyKey(principal, scope, key string, req interface{}) (*IdempotencyKey, error) {
+	if key == "" || len(key) > maxIdempotencyKeyLength {
+		return nil, errors.NewValidationError("Idempotency-Key", fmt.Sprintf("must be 1 to %d characters", maxIdempotencyKeyLength))
+	}
+
+	body, err := json.Marshal(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fingerprint request: %w", err)
+	}
+	sum := sha256.Sum256(body)
+
+	return &IdempotencyKey{
+		Principal:   principal,
+		Scope:       scope,
+		Key:         key,
+		Fingerprint: hex.EncodeToString(sum[:]),
+	}, nil
+}
+
+type idempotencyKeyContextKey struct{}
+
+// WithIdempotencyKey returns a context that makes the next mutating service
+// call record its response under key, in the same db txn as its changes.
+func WithIdempotencyKey(ctx context.Context, key *IdempotencyKey) context.Context {
+	return context.WithValue(ctx, idempotencyKeyContextKey{}, key)
+}
+
+// IdempotencyKeyFromContext returns the key set by WithIdempotencyKey, or
+// nil.
+func IdempotencyKeyFromContext(ctx context.Context) *IdempotencyKey {
+	key, _ := ctx.Value(idempotencyKeyContextKey{}).(*IdempotencyKey)
+	return key
+}
+
+type IdempotencyService interface {
+	Lookup(ctx context.Context, key *IdempotencyKey) (*models.IdempotencyRecord, error)
+	PurgeExpired(ctx context.Context) (int64, error)
+}
+
+type IdempotencyServiceImpl struct {
+	idempotencyRepo repository.IdempotencyRepository
+	ttl             time.Duration
+	logger          *slog.Logger
+}
+
+func NewIdempotencyService(idempotencyRepo repository.IdempotencyRepository, ttl time.Duration, logger *slog.Logger) *IdempotencyServiceImpl {
+	return &IdempotencyServiceImpl{
+		idempotencyRepo: idempotencyRepo,
+		ttl:             ttl,
+		logger:          logger,
+	}
+}
+
+// Lookup returns the stored record for key, or nil if the request has not
+// been completed before. Reusing a key with a different request fails with
+// ErrIdempotencyKeyReused.
+func (s *IdempotencyServiceImpl) Lookup(ctx context.Context, key *IdempotencyKey) (*models.IdempotencyRecord, error) {
+	record, err := s.idempotencyRepo.Get(ctx, key.Principal, key.Scope, key.Key, time.Now())
+	if err != nil {
+		s.logger.Error("failed to look up idempotency key",
+			"scope", key.Scope,
+			"error", err.Error(),
+		)
+		return nil, err
+	}
+	if record == nil {
+		return nil, nil
+	}
+
+	if record.Fingerprint != key.Fingerprint {
+		s.logger.Warn("idempotency key reused with a different request",
+			"principal", key.Principal,
+			"scope", key.Scope,
+			"idempotency_key", key.Key,
+		)
+		return nil, errors.ErrIdempotencyKeyReused
+	}
+	return record, nil
+}
+
+// PurgeExpired deletes keys whose window has passed.
+func (s *IdempotencyServiceImpl) PurgeExpired(ctx context.Context) (int64, error) {
+	deleted, err := s.idempotencyRepo.DeleteExpired(ctx, time.Now())
+	if err != nil {
+		return 0, err
+	}
+	if deleted > 0 {
+		s.logger.Info("expired idempotency keys purged", "count", deleted)
+	}
+	return deleted, nil
+}
+
+// RunPurge calls PurgeExpired every interval until ctx is cancelled.
+func (s *IdempotencyServiceImpl) RunPurge(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := s.PurgeExpired(ctx); err != nil {
+				s.logger.Error("failed to purge idempotency keys", "error", err.Error())
+			}
+		}
+	}
+}
+
+// save records response under the idempotency key carried by ctx, if any,
+// within tx. Services call it just before committing.
+func (s *IdempotencyServiceImpl) save(ctx context.Context, tx *sql.Tx, response interface{}) error {
+	return s.saveRecord(ctx, tx, response, false)
+}
+
+// saveFailure records a rejected transfer under the idempotency key carried
+// by ctx, if any, within the db txn that records it as FAILED.
+func (s *IdempotencyServiceImpl) saveFailure(ctx context.Context, tx *sql.Tx, failure *models.TransferFailure) error {
+	return s.saveRecord(ctx, tx, failure, true)
+}
+
+func (s *IdempotencyServiceImpl) saveRecord(ctx context.Context, tx *sql.Tx, response interface{}, failed bool) error {
+	key := IdempotencyKeyFromContext(ctx)
+	if key == nil {
+		return nil
+	}
+
+	body, err := json.Marshal(response)
+	if err != nil {
+		return fmt.Errorf("failed to marshal idempotent response: %w", err)
+	}
+
+	record := &models.IdempotencyRecord{
+		Principal:   key.Principal,
+		Scope:       key.Scope,
+		Key:         key.Key,
+		Fingerprint: key.Fingerprint,
+		Response:    body,
+		Failed:      failed,
+		ExpiresAt:   time.Now().Add(s.ttl),
+	}
+	return s.idempotencyRepo.Create(ctx, tx, record)
+}
@@ -0,0 +1,86 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/riteshkumar/internal-transfers/internal/errors"
+	"github.com/riteshkumar/internal-transfers/internal/models"
+	"github.com/riteshkumar/internal-transfers/internal/money"
+	"github.com/riteshkumar/internal-transfers/internal/repository"
+)
+
+// Ledger records double-entry journal entries and keeps accounts.balance,
+// which is a projection of the postings, in step with them. It is shared by
+// every service that moves money.
+type Ledger struct {
+	accountRepo repository.AccountRepository
+	journalRepo repository.JournalRepository
+}
+
+func NewLedger(accountRepo repository.AccountRepository, journalRepo repository.JournalRepository) *Ledger {
+	return &Ledger{
+		accountRepo: accountRepo,
+		journalRepo: journalRepo,
+	}
+}
+
+// LockSystemAccount returns the system account of the given kind for
+// currency, creating it on first use, locked for update within tx.
+func (l *Ledger) LockSystemAccount(ctx context.Context, tx *sql.Tx, kind string, currency money.Currency) (*models.Account, error) {
+	id := models.SystemAccountID(kind, currency)
+	if err := l.accountRepo.EnsureSystemAccount(ctx, tx, id, currency); err != nil {
+		return nil, err
+	}
+	return l.accountRepo.GetAccountByIDForUpdate(ctx, tx, id)
+}
+
+// Post checks that entry balances per currency, stores it and applies each
+// posting to its account. Every account touched by the entry must be passed
+// in accounts, already locked within tx; their Balance and Version fields
+// are updated in place.
+func (l *Ledger) Post(ctx context.Context, tx *sql.Tx, entry *models.JournalEntry, accounts ...*models.Account) error {
+	byID := make(map[string]*models.Account, len(accounts))
+	for _, account := range accounts {
+		byID[account.ID] = account
+	}
+
+	if len(entry.Postings) < 2 {
+		return fmt.Errorf("%w: needs at least two postings", errors.ErrUnbalancedJournalEntry)
+	}
+
+	totals := make(map[money.Currency]money.Amount)
+	for _, posting := range entry.Postings {
+		account, ok := byID[posting.AccountID]
+		if !ok {
+			return fmt.Errorf("posting to account %s which is not locked", posting.AccountID)
+		}
+		if posting.Currency != account.Currency {
+			return fmt.Errorf("posting in %s to account %s held in %s", posting.Currency, account.ID, account.Currency)
+		}
+		if posting.Amount.IsZero() {
+			return fmt.Errorf("%w: zero posting to account %s", errors.ErrUnbalancedJournalEntry, posting.AccountID)
+		}
+		totals[posting.Currency] = totals[posting.Currency].Add(posting.Amount)
+	}
+	for currency, total := range totals {
+		if !total.IsZero() {
+			return fmt.Errorf("%w: %s postings sum to %s", errors.ErrUnbalancedJournalEntry, currency, total)
+		}
+	}
+
+	if err := l.journalRepo.CreateEntry(ctx, tx, entry); err != nil {
+		return err
+	}
+
+	for _, posting := range entry.Postings {
+		account := byID[posting.AccountID]
+		account.Balance = account.Balance.Add(posting.Amount)
+		if err := l.accountRepo.UpdateAccountBalance(ctx, tx, account.ID, account.Balance); err != nil {
+			return err
+		}
+		account.Version++
+	}
+	return nil
+}
@@ -0,0 +1,43 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"slices"
+
+	"github.com/riteshkumar/internal-transfers/internal/models"
+	"github.com/riteshkumar/internal-transfers/internal/repository"
+)
+
+// Outbox records domain events within the db txn of the change they
+// announce. OutboxRelay publishes them once the txn has committed.
+type Outbox struct {
+	outboxRepo repository.OutboxRepository
+}
+
+func NewOutbox(outboxRepo repository.OutboxRepository) *Outbox {
+	return &Outbox{outboxRepo: outboxRepo}
+}
+
+// Enqueue records an event of eventType with data, concerning accountIDs,
+// within tx. Empty and repeated account IDs are dropped.
+func (o *Outbox) Enqueue(ctx context.Context, tx *sql.Tx, eventType models.DomainEventType, data interface{}, accountIDs ...string) error {
+	encoded, err := json.Marshal(data)
+	if err != nil {
+		return fmt.Errorf("failed to encode %s event: %w", eventType, err)
+	}
+
+	event := &models.OutboxEvent{
+		Type:       eventType,
+		AccountIDs: []string{},
+		Data:       encoded,
+	}
+	for _, id := range accountIDs {
+		if id != "" && !slices.Contains(event.AccountIDs, id) {
+			event.AccountIDs = append(event.AccountIDs, id)
+		}
+	}
+	return o.outboxRepo.Create(ctx, tx, event)
+}
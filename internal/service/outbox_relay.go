@@ -0,0 +1,162 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"expvar"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/riteshkumar/internal-transfers/internal/models"
+	"github.com/riteshkumar/internal-transfers/internal/repository"
+)
+
+// DefaultOutboxBatchSize is how many events one relay run reads at most.
+const DefaultOutboxBatchSize = 100
+
+// outboxPublishTimeout bounds each publish, so a stalled sink fails its
+// event instead of holding up the relay.
+const outboxPublishTimeout = 30 * time.Second
+
+// Outbox relay metrics, published at /admin/debug/vars.
+var (
+	outboxEventsPublished = expvar.NewInt("outbox_events_published")
+	outboxPublishFailures = expvar.NewInt("outbox_publish_failures")
+)
+
+// OutboxRelay publishes the events recorded by Outbox. Each run reads the
+// oldest unpublished events and publishes them in order, marking each one
+// published. When an event fails, the later events of its accounts wait
+// until it is published, so events are delivered in order per account;
+// waiting events are left out of the batch, so other accounts carry on. An
+// event published just before a crash is published again, so delivery is at
+// least once. Events are published outside any transaction; one server
+// relays at a time under a session advisory lock, and each publish has
+// outboxPublishTimeout to finish.
+type OutboxRelay struct {
+	db         *sql.DB
+	outboxRepo repository.OutboxRepository
+	publisher  Publisher
+	batchSize  int
+	logger     *slog.Logger
+}
+
+func NewOutboxRelay(db *sql.DB, outboxRepo repository.OutboxRepository, publisher Publisher, batchSize int, logger *slog.Logger) *OutboxRelay {
+	return &OutboxRelay{
+		db:         db,
+		outboxRepo: outboxRepo,
+		publisher:  publisher,
+		batchSize:  batchSize,
+		logger:     logger,
+	}
+}
+
+// RelayOnce publishes one batch of events and returns how many were
+// published. It does nothing while another server's relay is running.
+func (r *OutboxRelay) RelayOnce(ctx context.Context) (int, error) {
+	conn, err := r.db.Conn(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get relay connection: %w", err)
+	}
+	defer conn.Close()
+
+	locked, err := r.outboxRepo.TryLockRelay(ctx, conn)
+	if err != nil || !locked {
+		return 0, err
+	}
+	defer r.unlock(ctx, conn)
+
+	events, err := r.outboxRepo.ListUnpublished(ctx, r.batchSize)
+	if err != nil {
+		return 0, err
+	}
+
+	// blocked holds the accounts with an event that could not be published
+	// in this run, whose later events must wait
+	blocked := map[string]bool{}
+	published := 0
+	for _, event := range events {
+		held := false
+		for _, id := range event.AccountIDs {
+			held = held || blocked[id]
+		}
+
+		if !held {
+			publishErr := r.publish(ctx, event)
+			if publishErr == nil {
+				if err := r.outboxRepo.MarkPublished(ctx, event.Sequence); err != nil {
+					return 0, err
+				}
+				published++
+				continue
+			}
+
+			outboxPublishFailures.Add(1)
+			r.logger.Warn("failed to publish outbox event",
+				"sequence", event.Sequence,
+				"event_id", event.ID,
+				"event_type", event.Type,
+				"error", publishErr.Error(),
+			)
+			if err := r.outboxRepo.RecordFailure(ctx, event.Sequence, publishErr.Error()); err != nil {
+				return 0, err
+			}
+		}
+
+		for _, id := range event.AccountIDs {
+			blocked[id] = true
+		}
+	}
+
+	outboxEventsPublished.Add(int64(published))
+	if published > 0 {
+		r.logger.Info("outbox events published", "count", published)
+	}
+	return published, nil
+}
+
+// publish publishes event, giving up after outboxPublishTimeout.
+func (r *OutboxRelay) publish(ctx context.Context, event *models.OutboxEvent) error {
+	ctx, cancel := context.WithTimeout(ctx, outboxPublishTimeout)
+	defer cancel()
+	return r.publisher.Publish(ctx, event)
+}
+
+// unlock releases the relay lock held on conn. The lock is released even
+// when ctx is done; if that fails, conn is discarded rather than returned to
+// the pool, which ends its session and the lock with it.
+func (r *OutboxRelay) unlock(ctx context.Context, conn *sql.Conn) {
+	if err := r.outboxRepo.UnlockRelay(context.WithoutCancel(ctx), conn); err != nil {
+		r.logger.Warn("failed to unlock outbox relay, discarding connection", "error", err.Error())
+		conn.Raw(func(any) error { return driver.ErrBadConn })
+	}
+}
+
+// Run calls RelayOnce every interval until ctx is cancelled. A full batch is
+// followed straight away by the next one.
+func (r *OutboxRelay) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			for {
+				published, err := r.RelayOnce(ctx)
+				if err != nil {
+					if ctx.Err() == nil {
+						r.logger.Error("failed to relay outbox events", "error", err.Error())
+					}
+					break
+				}
+				if published < r.batchSize {
+					break
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package service
+
+import (
+	"context"
+	stderrors "errors"
+	"expvar"
+	"fmt"
+	"log/slog"
+	"math/rand/v2"
+	"time"
+
+	"github.com/lib/pq"
+
+	"github.com/riteshkumar/internal-transfers/internal/errors"
+)
+
+const (
+	// maxTxAttempts bounds how many times a db txn is tried in total.
+	maxTxAttempts = 5
+	// retryBaseDelay and retryMaxDelay bound the jittered backoff between
+	// attempts, which doubles after each one.
+	retryBaseDelay = 10 * time.Millisecond
+	retryMaxDelay  = 500 * time.Millisecond
+)
+
+// Retry metrics, published at /admin/debug/vars and keyed by operation.
+var (
+	txRetries          = expvar.NewMap("db_tx_retries")
+	txRetriesExhausted = expvar.NewMap("db_tx_retries_exhausted")
+)
+
+// isRetryable reports whether err is a Postgres serialization failure or
+// deadlock, after which the whole txn can safely be run again.
+func isRetryable(err error) bool {
+	var pqErr *pq.Error
+	if !stderrors.As(err, &pqErr) {
+		return false
+	}
+	return pqErr.Code == "40001" || pqErr.Code == "40P01"
+}
+
+// withRetry runs fn, which must begin and finish its own db txn, until it
+// succeeds, fails with a non-retryable error or runs out of attempts.
+// Attempts are spaced by full-jitter exponential backoff. When attempts run
+// out the last error is wrapped in ErrConcurrentUpdate.
+func withRetry(ctx context.Context, logger *slog.Logger, operation string, fn func() error) error {
+	delay := retryBaseDelay
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil || !isRetryable(err) {
+			return err
+		}
+
+		if attempt == maxTxAttempts {
+			txRetriesExhausted.Add(operation, 1)
+			logger.Error("giving up on db transaction after retries",
+				"operation", operation,
+				"attempts", attempt,
+				"error", err.Error(),
+			)
+			return fmt.Errorf("%w: %s after %d attempts: %v", errors.ErrConcurrentUpdate, operation, attempt, err)
+		}
+
+		txRetries.Add(operation, 1)
+		wait := time.Duration(rand.Int64N(int64(delay)) + 1)
+		logger.Warn("retrying db transaction",
+			"operation", operation,
+			"attempt", attempt,
+			"backoff_ms", wait.Milliseconds(),
+			"error", err.Error(),
+		)
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(wait):
+		}
+		delay = min(delay*2, retryMaxDelay)
+	}
+}
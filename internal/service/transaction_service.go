@@ -6,29 +6,59 @@ import (
 	"encoding/json"
 	"fmt"
 	"log/slog"
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
 
 	"github.com/riteshkumar/internal-transfers/internal/errors"
 	"github.com/riteshkumar/internal-transfers/internal/models"
+	"github.com/riteshkumar/internal-transfers/internal/money"
 	"github.com/riteshkumar/internal-transfers/internal/repository"
 )
 
+// Limits on the descriptive fields of a transfer, matching their columns.
+const (
+	maxReferenceLength   = 100
+	maxDescriptionLength = 500
+)
+
+// Page sizes of an account's transaction history.
+const (
+	defaultHistoryPageSize = 50
+	maxHistoryPageSize     = 200
+)
+
 type TransactionService interface {
 	Transfer(ctx context.Context, req *models.CreateTransactionRequest) (*models.Transaction, error)
+	Reverse(ctx context.Context, id string, req *models.ReverseTransactionRequest) (*models.Transaction, error)
+	GetTransaction(ctx context.Context, id string) (*models.Transaction, error)
+	ListAccountTransactions(ctx context.Context, accountID string, filter models.TransactionHistoryFilter) (*models.AccountTransactionsResponse, error)
 }
 
 type TransactionServiceImpl struct {
 	db              *sql.DB
 	accountRepo     repository.AccountRepository
 	transactionRepo repository.TransactionRepository
+	fxRateRepo      repository.FXRateRepository
 	auditRepo       repository.AuditRepository
+	ledger          *Ledger
+	idempotency     *IdempotencyServiceImpl
+	audit           *AuditWriter
+	outbox          *Outbox
 	logger          *slog.Logger
 }
 
-func NewTransactionService(db *sql.DB, accountRepo repository.AccountRepository, transactionRepo repository.TransactionRepository, auditRepo repository.AuditRepository, logger *slog.Logger) *TransactionServiceImpl {
+func NewTransactionService(db *sql.DB, accountRepo repository.AccountRepository, transactionRepo repository.TransactionRepository, fxRateRepo repository.FXRateRepository, auditRepo repository.AuditRepository, ledger *Ledger, idempotency *IdempotencyServiceImpl, audit *AuditWriter, outbox *Outbox, logger *slog.Logger) *TransactionServiceImpl {
 	return &TransactionServiceImpl{
 		db:              db,
 		accountRepo:     accountRepo,
 		transactionRepo: transactionRepo,
+		fxRateRepo:      fxRateRepo,
+		ledger:          ledger,
+		idempotency:     idempotency,
+		audit:           audit,
+		outbox:          outbox,
 		auditRepo:       auditRepo,
 		logger:          logger,
 	}
@@ -47,6 +77,161 @@ func (s *TransactionServiceImpl) Transfer(ctx context.Context, req *models.Creat
 		return nil, err
 	}
 
+	var transaction *models.Transaction
+	err := withRetry(ctx, s.logger, "transfer", func() error {
+		var err error
+		transaction, err = s.transferOnce(ctx, req)
+		return err
+	})
+	if err != nil {
+		if reason := transferFailureReason(err); reason != "" {
+			return nil, s.recordFailedTransfer(ctx, req, reason, err)
+		}
+		return nil, err
+	}
+	return transaction, nil
+}
+
+// transferFailureReason returns the reason code under which a transfer
+// rejected with err is recorded, or "" if err is not a business rejection
+// (e.g. a db failure) and nothing should be recorded. Validation errors
+// only have a reason code when they are about the amount.
+func transferFailureReason(err error) string {
+	switch {
+	case errors.IsNotFound(err):
+		return models.FailureReasonAccountNotFound
+	case errors.IsAccountStatusError(err):
+		return models.FailureReasonAccountNotActive
+	case errors.IsInsufficientBalance(err):
+		return models.FailureReasonInsufficientFunds
+	case errors.IsCurrencyMismatch(err):
+		return models.FailureReasonCurrencyMismatch
+	case errors.ValidationErrorField(err) == "amount":
+		return models.FailureReasonInvalidAmount
+	case errors.IsDuplicateReference(err):
+		return models.FailureReasonDuplicateReference
+	default:
+		return ""
+	}
+}
+
+// recordFailedTransfer stores a rejected transfer as a FAILED transaction
+// in its own db txn, since the attempt's txn has been rolled back. Currencies
+// are filled in for whichever accounts exist. It returns cause wrapped with
+// the id of the record, or cause alone if the record could not be written.
+// The failure is kept under the request's Idempotency-Key, if any.
+func (s *TransactionServiceImpl) recordFailedTransfer(ctx context.Context, req *models.CreateTransactionRequest, reason string, cause error) error {
+	transaction := &models.Transaction{
+		SourceAccountID:      req.SourceAccountID,
+		DestinationAccountID: req.DestinationAccountID,
+		Amount:               req.Amount,
+		Reference:            req.Reference,
+		Description:          req.Description,
+		Metadata:             req.Metadata,
+		Status:               models.TransactionStatusFailed,
+		FailureReason:        &reason,
+	}
+	if sourceAccount, err := s.accountRepo.GetAccountByID(ctx, req.SourceAccountID); err == nil {
+		transaction.Currency = sourceAccount.Currency
+	}
+	if destinationAccount, err := s.accountRepo.GetAccountByID(ctx, req.DestinationAccountID); err == nil {
+		transaction.DestinationCurrency = destinationAccount.Currency
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		s.logger.Error("failed to begin transaction to record failed transfer",
+			"error", err.Error(),
+		)
+		return cause
+	}
+
+	// Ensure rollback on error
+	defer func() {
+		if tx != nil {
+			tx.Rollback()
+		}
+	}()
+
+	if err := s.transactionRepo.Create(ctx, tx, transaction); err != nil {
+		s.logger.Error("failed to record failed transfer",
+			"source_account_id", req.SourceAccountID,
+			"destination_account_id", req.DestinationAccountID,
+			"failure_reason", reason,
+			"error", err.Error(),
+		)
+		return cause
+	}
+
+	txValue, err := json.Marshal(models.NewTransactionSnapshot(transaction))
+	if err != nil {
+		s.logger.Error("failed to marshal failed transfer for audit log",
+			"transaction_id", transaction.ID,
+			"error", err.Error(),
+		)
+		return cause
+	}
+	auditLog := &models.AuditLog{
+		Event:    models.AuditEventTransactionFailed,
+		EntityID: transaction.ID,
+		NewValue: txValue,
+	}
+	if err := s.auditRepo.Create(ctx, tx, auditLog); err != nil {
+		s.logger.Error("failed to create audit log for failed transfer",
+			"transaction_id", transaction.ID,
+			"error", err.Error(),
+		)
+		return cause
+	}
+
+	if err := s.outbox.Enqueue(ctx, tx, models.DomainEventTransferFailed, models.NewTransactionResponse(transaction), transaction.SourceAccountID, transaction.DestinationAccountID); err != nil {
+		s.logger.Error("failed to enqueue failed transfer event",
+			"transaction_id", transaction.ID,
+			"error", err.Error(),
+		)
+		return cause
+	}
+
+	// A retry with the same Idempotency-Key gets this failure back instead
+	// of recording another one
+	failedErr := errors.NewTransferFailedError(transaction.ID, reason, cause)
+	failure := &models.TransferFailure{
+		TransactionID: transaction.ID,
+		FailureReason: reason,
+		Message:       failedErr.Error(),
+	}
+	if err := s.idempotency.saveFailure(ctx, tx, failure); err != nil {
+		if err == errors.ErrIdempotencyKeyInUse {
+			return err
+		}
+		s.logger.Error("failed to save idempotency key for failed transfer",
+			"transaction_id", transaction.ID,
+			"error", err.Error(),
+		)
+		return cause
+	}
+
+	if err := tx.Commit(); err != nil {
+		s.logger.Error("failed to commit failed transfer",
+			"transaction_id", transaction.ID,
+			"error", err.Error(),
+		)
+		return cause
+	}
+	tx = nil
+
+	s.logger.Info("transfer failed",
+		"transaction_id", transaction.ID,
+		"source_account_id", req.SourceAccountID,
+		"destination_account_id", req.DestinationAccountID,
+		"amount", req.Amount,
+		"failure_reason", reason,
+	)
+	return failedErr
+}
+
+// transferOnce makes one attempt at Transfer in its own db txn.
+func (s *TransactionServiceImpl) transferOnce(ctx context.Context, req *models.CreateTransactionRequest) (*models.Transaction, error) {
 	// Begin txn with SERIALIZABLE isolation level for strict consistency
 	tx, err := s.db.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelSerializable})
 	if err != nil {
@@ -63,82 +248,399 @@ func (s *TransactionServiceImpl) Transfer(ctx context.Context, req *models.Creat
 		}
 	}()
 
-	// Lock and get source account
-	sourceAccount, err := s.accountRepo.GetAccountByIDForUpdate(ctx, tx, req.SourceAccountID)
+	transaction, err := s.transferInTx(ctx, tx, req, 0)
 	if err != nil {
-		if errors.IsNotFound(err) {
-			s.logger.Error("source account not found",
-				"source_account_id", req.SourceAccountID,
-			)
-			return nil, fmt.Errorf("source account: %w", err)
+		return nil, err
+	}
+
+	if err := s.idempotency.save(ctx, tx, models.NewTransactionResponse(transaction)); err != nil {
+		if err == errors.ErrIdempotencyKeyInUse {
+			return nil, err
 		}
-		s.logger.Error("failed to get source account",
-			"source_account_id", req.SourceAccountID,
+		s.logger.Error("failed to save idempotency key",
+			"transaction_id", transaction.ID,
+			"error", err.Error(),
+		)
+		return nil, errors.NewTransactionError("save idempotency key", err)
+	}
+
+	// Commit txn
+	if err := tx.Commit(); err != nil {
+		s.logger.Error("failed to commit transaction",
+			"transaction_id", transaction.ID,
 			"error", err.Error(),
 		)
-		return nil, errors.NewTransactionError("get source account", err)
+		return nil, errors.NewTransactionError("commit", err)
+	}
+
+	// Nullify tx to avoid rollback in defer
+	tx = nil
+
+	return transaction, nil
+}
+
+// Reverse creates a compensating transaction that moves all or part of a
+// transfer back from its destination to its source, and records on the
+// original how much of it has been reversed. Cross-currency transfers are
+// reversed at the original rate rather than today's; the last reversal takes
+// whatever remains on the destination side so that a transfer reversed in
+// several parts comes back to exactly what was credited.
+func (s *TransactionServiceImpl) Reverse(ctx context.Context, id string, req *models.ReverseTransactionRequest) (*models.Transaction, error) {
+	if err := validateTransactionID(id); err != nil {
+		return nil, err
+	}
+	if req.Amount != nil && !req.Amount.IsPositive() {
+		return nil, errors.ErrInvalidAmount
 	}
 
-	// Lock and get destination account
-	destinationAccount, err := s.accountRepo.GetAccountByIDForUpdate(ctx, tx, req.DestinationAccountID)
+	var reversal *models.Transaction
+	err := withRetry(ctx, s.logger, "reverse", func() error {
+		var err error
+		reversal, err = s.reverseOnce(ctx, id, req)
+		return err
+	})
 	if err != nil {
-		if errors.IsNotFound(err) {
-			s.logger.Error("destination account not found",
-				"destination_account_id", req.DestinationAccountID,
+		return nil, err
+	}
+	return reversal, nil
+}
+
+// GetTransaction returns a transaction in any status, including FAILED
+// attempts.
+func (s *TransactionServiceImpl) GetTransaction(ctx context.Context, id string) (*models.Transaction, error) {
+	if err := validateTransactionID(id); err != nil {
+		return nil, err
+	}
+
+	transaction, err := s.transactionRepo.GetByID(ctx, id)
+	if err != nil {
+		if !errors.IsTransactionNotFound(err) {
+			s.logger.Error("failed to get transaction", "transaction_id", id, "error", err.Error())
+		}
+		return nil, err
+	}
+	return transaction, nil
+}
+
+// ListAccountTransactions returns a page of an account's transaction
+// history, newest first. The response's NextCursor, when set, fetches the
+// following page with the same filter.
+func (s *TransactionServiceImpl) ListAccountTransactions(ctx context.Context, accountID string, filter models.TransactionHistoryFilter) (*models.AccountTransactionsResponse, error) {
+	if err := validateHistoryFilter(&filter); err != nil {
+		return nil, err
+	}
+
+	exists, err := s.accountRepo.AccountExists(ctx, accountID)
+	if err != nil {
+		s.logger.Error("failed to check account exists", "account_id", accountID, "error", err.Error())
+		return nil, err
+	}
+	if !exists {
+		return nil, errors.ErrAccountNotFound
+	}
+
+	// Fetch one extra row to learn whether there is a next page
+	pageSize := filter.Limit
+	filter.Limit++
+	transactions, err := s.transactionRepo.ListByAccountID(ctx, accountID, filter)
+	if err != nil {
+		s.logger.Error("failed to list account transactions", "account_id", accountID, "error", err.Error())
+		return nil, err
+	}
+
+	response := &models.AccountTransactionsResponse{Transactions: transactions}
+	if len(transactions) > pageSize {
+		response.Transactions = transactions[:pageSize]
+		last := response.Transactions[pageSize-1]
+		response.NextCursor = models.Cursor{
+			Value: last.CreatedAt.Format(time.RFC3339Nano),
+			ID:    last.TransactionID,
+		}.Encode()
+	}
+	if response.Transactions == nil {
+		response.Transactions = []*models.AccountTransaction{}
+	}
+	return response, nil
+}
+
+// validateHistoryFilter checks filter and applies the default page size.
+func validateHistoryFilter(filter *models.TransactionHistoryFilter) error {
+	switch filter.Direction {
+	case "", models.DirectionDebit, models.DirectionCredit:
+	default:
+		return errors.NewValidationError("direction", "must be debit or credit")
+	}
+	if filter.MinAmount != nil && filter.MaxAmount != nil && filter.MinAmount.Cmp(*filter.MaxAmount) > 0 {
+		return errors.NewValidationError("min_amount", "must not exceed max_amount")
+	}
+	if filter.From != nil && filter.To != nil && !filter.From.Before(*filter.To) {
+		return errors.NewValidationError("from", "must be before to")
+	}
+	if filter.After != nil {
+		if _, err := time.Parse(time.RFC3339Nano, filter.After.Value); err != nil {
+			return errors.NewValidationError("cursor", "is malformed")
+		}
+		if _, err := uuid.Parse(filter.After.ID); err != nil {
+			return errors.NewValidationError("cursor", "is malformed")
+		}
+	}
+	if filter.Limit == 0 {
+		filter.Limit = defaultHistoryPageSize
+	}
+	if filter.Limit < 0 || filter.Limit > maxHistoryPageSize {
+		return errors.NewValidationError("limit", fmt.Sprintf("must be between 1 and %d", maxHistoryPageSize))
+	}
+	return nil
+}
+
+// validateTransactionID rejects ids that cannot be a transaction's UUID
+// before they reach the db.
+func validateTransactionID(id string) error {
+	if _, err := uuid.Parse(id); err != nil {
+		return errors.ErrInvalidTransactionID
+	}
+	return nil
+}
+
+// reverseOnce makes one attempt at Reverse in its own db txn.
+func (s *TransactionServiceImpl) reverseOnce(ctx context.Context, id string, req *models.ReverseTransactionRequest) (*models.Transaction, error) {
+	tx, err := s.db.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelSerializable})
+	if err != nil {
+		s.logger.Error("failed to begin transaction",
+			"error", err.Error(),
+		)
+		return nil, errors.NewTransactionError("begin", err)
+	}
+
+	// Ensure rollback on error
+	defer func() {
+		if tx != nil {
+			tx.Rollback()
+		}
+	}()
+
+	original, err := s.transactionRepo.GetByIDForUpdate(ctx, tx, id)
+	if err != nil {
+		if errors.IsTransactionNotFound(err) {
+			s.logger.Warn("transaction to reverse not found",
+				"transaction_id", id,
 			)
-			return nil, fmt.Errorf("destination account: %w", err)
+			return nil, err
 		}
-		s.logger.Error("failed to get destination account",
-			"destination_account_id", req.DestinationAccountID,
+		s.logger.Error("failed to get transaction to reverse",
+			"transaction_id", id,
 			"error", err.Error(),
 		)
-		return nil, errors.NewTransactionError("get destination account", err)
+		return nil, errors.NewTransactionError("get transaction", err)
 	}
 
-	// Check for sufficient balance
-	if sourceAccount.Balance < req.Amount {
-		s.logger.Warn("insufficient balance in source account",
-			"source_account_id", req.SourceAccountID,
-			"available_balance", sourceAccount.Balance,
-			"requested_amount", req.Amount,
+	if original.ReversalOfID != nil {
+		return nil, errors.NewValidationError("id", "a reversal cannot itself be reversed")
+	}
+	if original.Status == models.TransactionStatusReversed {
+		return nil, errors.ErrAlreadyReversed
+	}
+	if original.Status != models.TransactionStatusPosted {
+		s.logger.Warn("transaction to reverse is not posted",
+			"transaction_id", id,
+			"status", original.Status,
+		)
+		return nil, errors.ErrTransactionNotPosted
+	}
+
+	remaining := original.RemainingReversible()
+	if remaining.IsZero() {
+		return nil, errors.ErrAlreadyReversed
+	}
+	amount := remaining
+	if req.Amount != nil {
+		amount = *req.Amount
+	}
+	if amount.Cmp(remaining) > 0 {
+		s.logger.Warn("reversal exceeds unreversed amount",
+			"transaction_id", id,
+			"remaining", remaining,
+			"requested_amount", amount,
+		)
+		return nil, errors.ErrReversalExceeded
+	}
+	if !amount.FitsCurrency(original.Currency) {
+		return nil, errors.NewValidationError("amount", fmt.Sprintf("must have at most %d decimal places for %s", original.Currency.Exponent(), original.Currency))
+	}
+
+	// The reversal runs the original backwards
+	sourceAccount, destinationAccount, err := s.lockTransferAccounts(ctx, tx, original.DestinationAccountID, original.SourceAccountID)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkETag(sourceAccount, req.ExpectedETag); err != nil {
+		return nil, err
+	}
+
+	reversal := &models.Transaction{
+		SourceAccountID:      original.DestinationAccountID,
+		DestinationAccountID: original.SourceAccountID,
+		Amount:               amount,
+		Currency:             original.DestinationCurrency,
+		DestinationAmount:    amount,
+		DestinationCurrency:  original.Currency,
+		ReversalOfID:         &original.ID,
+		Status:               models.TransactionStatusPending,
+	}
+	if original.FXRate != nil {
+		if err := s.quoteReversalAmount(ctx, tx, original, reversal, amount.Cmp(remaining) == 0); err != nil {
+			return nil, err
+		}
+	}
+
+	availableBalance := sourceAccount.AvailableBalance()
+	if availableBalance.Cmp(reversal.Amount) < 0 {
+		s.logger.Warn("insufficient balance to reverse transaction",
+			"transaction_id", id,
+			"source_account_id", sourceAccount.ID,
+			"available_balance", availableBalance,
+			"requested_amount", reversal.Amount,
 		)
 		return nil, errors.ErrInsufficentBalance
 	}
 
-	// store old balance for audit
 	oldSourceBalance := sourceAccount.Balance
 	oldDestinationBalance := destinationAccount.Balance
 
-	// calculate new balances
-	newSourceBalance := sourceAccount.Balance - req.Amount
-	newDestinationBalance := destinationAccount.Balance + req.Amount
+	if err := s.transactionRepo.Create(ctx, tx, reversal); err != nil {
+		s.logger.Error("failed to create reversal record",
+			"transaction_id", id,
+			"error", err.Error(),
+		)
+		return nil, errors.NewTransactionError("create reversal record", err)
+	}
 
-	// Update source account balance
-	if err := s.accountRepo.UpdateAccountBalance(ctx, tx, req.SourceAccountID, newSourceBalance); err != nil {
-		s.logger.Error("failed to update source account balance",
-			"source_account_id", req.SourceAccountID,
+	if err := s.postTransferJournalEntry(ctx, tx, reversal, sourceAccount, destinationAccount); err != nil {
+		s.logger.Error("failed to post journal entry for reversal",
+			"transaction_id", reversal.ID,
 			"error", err.Error(),
 		)
-		return nil, errors.NewTransactionError("update source account balance", err)
+		return nil, errors.NewTransactionError("post journal entry", err)
+	}
+	if err := s.transitionStatus(ctx, tx, reversal, models.TransactionStatusPosted); err != nil {
+		return nil, err
 	}
 
-	// Update destination account balance
-	if err := s.accountRepo.UpdateAccountBalance(ctx, tx, req.DestinationAccountID, newDestinationBalance); err != nil {
-		s.logger.Error("failed to update destination account balance",
-			"destination_account_id", req.DestinationAccountID,
+	oldReversedAmount := original.ReversedAmount
+	original.ReversedAmount = original.ReversedAmount.Add(amount)
+	if err := s.transactionRepo.UpdateReversedAmount(ctx, tx, original.ID, original.ReversedAmount); err != nil {
+		s.logger.Error("failed to mark transaction reversed",
+			"transaction_id", id,
 			"error", err.Error(),
 		)
-		return nil, errors.NewTransactionError("update destination account balance", err)
+		return nil, errors.NewTransactionError("update reversed amount", err)
+	}
+	if original.RemainingReversible().IsZero() {
+		if err := s.transitionStatus(ctx, tx, original, models.TransactionStatusReversed); err != nil {
+			return nil, err
+		}
 	}
 
-	// Create transaction record
+	// Create audit logs for the reversal and the reversed transaction
+	err = s.audit.Write(ctx, tx, "reversal", func() error {
+		if err := s.createTransferAuditLog(ctx, tx, models.AuditEventTransactionReversalPosted, reversal, oldSourceBalance, sourceAccount.Balance, oldDestinationBalance, destinationAccount.Balance); err != nil {
+			return err
+		}
+		return s.createReversedAuditLog(ctx, tx, original, oldReversedAmount)
+	})
+	if err != nil {
+		s.logger.Error("failed to create audit logs for reversal",
+			"transaction_id", reversal.ID,
+			"reversal_of_id", id,
+			"error", err.Error(),
+		)
+		return nil, errors.NewTransactionError("create reversal audit log", err)
+	}
+
+	if err := s.outbox.Enqueue(ctx, tx, models.DomainEventTransferReversed, models.NewTransactionResponse(reversal), reversal.SourceAccountID, reversal.DestinationAccountID); err != nil {
+		s.logger.Error("failed to enqueue reversal event",
+			"transaction_id", reversal.ID,
+			"error", err.Error(),
+		)
+		return nil, errors.NewTransactionError("enqueue reversal event", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		s.logger.Error("failed to commit reversal",
+			"transaction_id", id,
+			"error", err.Error(),
+		)
+		return nil, errors.NewTransactionError("commit", err)
+	}
+	tx = nil
+
+	s.logger.Info("transaction reversed",
+		"transaction_id", id,
+		"reversal_id", reversal.ID,
+		"amount", amount,
+		"reversed_amount", original.ReversedAmount,
+	)
+	return reversal, nil
+}
+
+// transferInTx moves money within an open db txn: it locks both accounts,
+// checks funds, records the transaction, posts the journal entry and writes
+// the audit trail and its event. releasedHold is the amount of an active hold on the source
+// account that this transfer consumes, so it counts as available.
+func (s *TransactionServiceImpl) transferInTx(ctx context.Context, tx *sql.Tx, req *models.CreateTransactionRequest, releasedHold money.Amount) (*models.Transaction, error) {
+	sourceAccount, destinationAccount, err := s.lockTransferAccounts(ctx, tx, req.SourceAccountID, req.DestinationAccountID)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkETag(sourceAccount, req.ExpectedETag); err != nil {
+		return nil, err
+	}
+
+	if !req.Amount.FitsCurrency(sourceAccount.Currency) {
+		return nil, errors.NewValidationError("amount", fmt.Sprintf("must have at most %d decimal places for %s", sourceAccount.Currency.Exponent(), sourceAccount.Currency))
+	}
+
+	// Check for sufficient balance, including any overdraft limit and net of
+	// funds reserved by other holds
+	availableBalance := sourceAccount.AvailableBalance().Add(releasedHold)
+	if availableBalance.Cmp(req.Amount) < 0 {
+		s.logger.Warn("insufficient balance in source account",
+			"source_account_id", req.SourceAccountID,
+			"available_balance", availableBalance,
+			"requested_amount", req.Amount,
+		)
+		return nil, errors.ErrInsufficentBalance
+	}
+
+	// store old balance for audit
+	oldSourceBalance := sourceAccount.Balance
+	oldDestinationBalance := destinationAccount.Balance
+
 	transaction := &models.Transaction{
 		SourceAccountID:      req.SourceAccountID,
 		DestinationAccountID: req.DestinationAccountID,
 		Amount:               req.Amount,
+		Currency:             sourceAccount.Currency,
+		Reference:            req.Reference,
+		Description:          req.Description,
+		Metadata:             req.Metadata,
+		Status:               models.TransactionStatusPending,
 	}
 
+	// Work out what the destination receives, converting if needed
+	if err := s.quoteDestinationAmount(ctx, tx, transaction, destinationAccount.Currency); err != nil {
+		return nil, err
+	}
+
+	// Create transaction record
 	if err := s.transactionRepo.Create(ctx, tx, transaction); err != nil {
+		if errors.IsDuplicateReference(err) {
+			s.logger.Warn("duplicate transfer reference",
+				"source_account_id", req.SourceAccountID,
+				"reference", *req.Reference,
+			)
+			return nil, err
+		}
 		s.logger.Error("failed to create transaction record",
 			"source_account_id", req.SourceAccountID,
 			"destination_account_id", req.DestinationAccountID,
@@ -148,30 +650,127 @@ func (s *TransactionServiceImpl) Transfer(ctx context.Context, req *models.Creat
 		return nil, errors.NewTransactionError("create transaction record", err)
 	}
 
-	// Create audit logs for both accounts
-	if err := s.createTransferAuditLog(ctx, tx, transaction, oldSourceBalance, newSourceBalance, oldDestinationBalance, newDestinationBalance); err != nil {
-		s.logger.Error("failed to create audit logs for transfer",
+	// Post the journal entry, which also moves the account balances
+	if err := s.postTransferJournalEntry(ctx, tx, transaction, sourceAccount, destinationAccount); err != nil {
+		s.logger.Error("failed to post journal entry for transfer",
 			"transaction_id", transaction.ID,
 			"error", err.Error(),
 		)
-		// continue with the tx even if audit loggin fails
+		return nil, errors.NewTransactionError("post journal entry", err)
+	}
+	if err := s.transitionStatus(ctx, tx, transaction, models.TransactionStatusPosted); err != nil {
+		return nil, err
 	}
 
-	// Commit txn
-	if err := tx.Commit(); err != nil {
-		s.logger.Error("failed to commit transaction",
+	newSourceBalance := sourceAccount.Balance
+	newDestinationBalance := destinationAccount.Balance
+
+	// Create audit logs for both accounts and the transaction
+	err = s.audit.Write(ctx, tx, "transfer", func() error {
+		return s.createTransferAuditLog(ctx, tx, models.AuditEventTransactionPosted, transaction, oldSourceBalance, newSourceBalance, oldDestinationBalance, newDestinationBalance)
+	})
+	if err != nil {
+		s.logger.Error("failed to create audit logs for transfer",
 			"transaction_id", transaction.ID,
 			"error", err.Error(),
 		)
-		return nil, errors.NewTransactionError("commit", err)
+		return nil, errors.NewTransactionError("create transfer audit log", err)
 	}
 
-	// Nullify tx to avoid rollback in defer
-	tx = nil
+	if err := s.outbox.Enqueue(ctx, tx, models.DomainEventTransferPosted, models.NewTransactionResponse(transaction), transaction.SourceAccountID, transaction.DestinationAccountID); err != nil {
+		s.logger.Error("failed to enqueue transfer event",
+			"transaction_id", transaction.ID,
+			"error", err.Error(),
+		)
+		return nil, errors.NewTransactionError("enqueue transfer event", err)
+	}
 
 	return transaction, nil
 }
 
+// transitionStatus moves transaction to status, rejecting transitions the
+// state machine does not allow.
+func (s *TransactionServiceImpl) transitionStatus(ctx context.Context, tx *sql.Tx, transaction *models.Transaction, status string) error {
+	if !models.CanTransitionTransactionStatus(transaction.Status, status) {
+		s.logger.Error("transaction status transition not allowed",
+			"transaction_id", transaction.ID,
+			"from", transaction.Status,
+			"to", status,
+		)
+		return errors.ErrInvalidTransactionStatusChange
+	}
+	if err := s.transactionRepo.UpdateStatus(ctx, tx, transaction.ID, status); err != nil {
+		s.logger.Error("failed to update transaction status",
+			"transaction_id", transaction.ID,
+			"status", status,
+			"error", err.Error(),
+		)
+		return errors.NewTransactionError("update transaction status", err)
+	}
+	transaction.Status = status
+	return nil
+}
+
+// lockTransferAccounts locks both sides of a transfer and checks that their
+// statuses let money leave the source and enter the destination.
+func (s *TransactionServiceImpl) lockTransferAccounts(ctx context.Context, tx *sql.Tx, sourceID, destinationID string) (sourceAccount, destinationAccount *models.Account, err error) {
+	// Lock in ascending id order whatever the direction, so that opposite
+	// transfers between the same accounts cannot deadlock
+	if sourceID < destinationID {
+		if sourceAccount, err = s.lockTransferAccount(ctx, tx, "source", sourceID); err != nil {
+			return nil, nil, err
+		}
+		if destinationAccount, err = s.lockTransferAccount(ctx, tx, "destination", destinationID); err != nil {
+			return nil, nil, err
+		}
+	} else {
+		if destinationAccount, err = s.lockTransferAccount(ctx, tx, "destination", destinationID); err != nil {
+			return nil, nil, err
+		}
+		if sourceAccount, err = s.lockTransferAccount(ctx, tx, "source", sourceID); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	// Frozen and closed accounts block money moving in or out
+	if !sourceAccount.CanDebit() {
+		s.logger.Warn("source account cannot be debited",
+			"source_account_id", sourceID,
+			"status", sourceAccount.Status,
+		)
+		return nil, nil, errors.NewAccountStatusError(sourceAccount.ID, sourceAccount.Status, "debit")
+	}
+	if !destinationAccount.CanCredit() {
+		s.logger.Warn("destination account cannot be credited",
+			"destination_account_id", destinationID,
+			"status", destinationAccount.Status,
+		)
+		return nil, nil, errors.NewAccountStatusError(destinationAccount.ID, destinationAccount.Status, "credit")
+	}
+
+	return sourceAccount, destinationAccount, nil
+}
+
+// lockTransferAccount locks one side of a transfer; side is "source" or
+// "destination" and only shapes errors and logs.
+func (s *TransactionServiceImpl) lockTransferAccount(ctx context.Context, tx *sql.Tx, side, id string) (*models.Account, error) {
+	account, err := s.accountRepo.GetAccountByIDForUpdate(ctx, tx, id)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			s.logger.Error(side+" account not found",
+				side+"_account_id", id,
+			)
+			return nil, fmt.Errorf("%s account: %w", side, err)
+		}
+		s.logger.Error("failed to get "+side+" account",
+			side+"_account_id", id,
+			"error", err.Error(),
+		)
+		return nil, errors.NewTransactionError("get "+side+" account", err)
+	}
+	return account, nil
+}
+
 func (s *TransactionServiceImpl) validateTransferRequest(ctx context.Context, req *models.CreateTransactionRequest) error {
 	if req.SourceAccountID == "" {
 		return errors.NewValidationError("source_account_id", "must be non-empty")
@@ -182,57 +781,245 @@ func (s *TransactionServiceImpl) validateTransferRequest(ctx context.Context, re
 	if req.SourceAccountID == req.DestinationAccountID {
 		return errors.ErrSameAccount
 	}
-	if req.Amount <= 0 {
+	if models.IsSystemAccountID(req.SourceAccountID) {
+		return errors.NewValidationError("source_account_id", "system accounts cannot be used in transfers")
+	}
+	if models.IsSystemAccountID(req.DestinationAccountID) {
+		return errors.NewValidationError("destination_account_id", "system accounts cannot be used in transfers")
+	}
+	if !req.Amount.IsPositive() {
 		return errors.ErrInvalidAmount
 	}
+	return validateTransferMetadata(req)
+}
+
+// validateTransferMetadata bounds the optional descriptive fields of a
+// transfer.
+func validateTransferMetadata(req *models.CreateTransactionRequest) error {
+	if req.Reference != nil {
+		if *req.Reference == "" || utf8.RuneCountInString(*req.Reference) > maxReferenceLength {
+			return errors.NewValidationError("reference", fmt.Sprintf("must be 1 to %d characters", maxReferenceLength))
+		}
+	}
+	if utf8.RuneCountInString(req.Description) > maxDescriptionLength {
+		return errors.NewValidationError("description", fmt.Sprintf("must be at most %d characters", maxDescriptionLength))
+	}
+	if len(req.Metadata) > models.MaxMetadataEntries {
+		return errors.NewValidationError("metadata", fmt.Sprintf("must have at most %d entries", models.MaxMetadataEntries))
+	}
+	for key, value := range req.Metadata {
+		if key == "" || utf8.RuneCountInString(key) > models.MaxMetadataKeyLength {
+			return errors.NewValidationError("metadata", fmt.Sprintf("keys must be 1 to %d characters", models.MaxMetadataKeyLength))
+		}
+		if utf8.RuneCountInString(value) > models.MaxMetadataValueLength {
+			return errors.NewValidationError("metadata", fmt.Sprintf("value of %q must be at most %d characters", key, models.MaxMetadataValueLength))
+		}
+	}
+	return nil
+}
+
+// postTransferJournalEntry records transaction in the ledger. Same-currency
+// transfers are a plain debit/credit pair; cross-currency transfers go
+// through the FX position account of each currency so that every currency
+// balances on its own.
+func (s *TransactionServiceImpl) postTransferJournalEntry(ctx context.Context, tx *sql.Tx, transaction *models.Transaction, sourceAccount, destinationAccount *models.Account) error {
+	entry := &models.JournalEntry{
+		Kind:          models.JournalKindTransfer,
+		TransactionID: &transaction.ID,
+		Postings: []models.Posting{
+			{AccountID: sourceAccount.ID, Amount: transaction.Amount.Neg(), Currency: transaction.Currency},
+			{AccountID: destinationAccount.ID, Amount: transaction.DestinationAmount, Currency: transaction.DestinationCurrency},
+		},
+	}
+	accounts := []*models.Account{sourceAccount, destinationAccount}
+
+	if transaction.Currency != transaction.DestinationCurrency {
+		// System accounts are locked after customer accounts, and in
+		// currency order among themselves, to keep lock order global
+		first, second := transaction.Currency, transaction.DestinationCurrency
+		if second < first {
+			first, second = second, first
+		}
+		firstFXAccount, err := s.ledger.LockSystemAccount(ctx, tx, models.SystemAccountFX, first)
+		if err != nil {
+			return err
+		}
+		secondFXAccount, err := s.ledger.LockSystemAccount(ctx, tx, models.SystemAccountFX, second)
+		if err != nil {
+			return err
+		}
+		sourceFXAccount, destinationFXAccount := firstFXAccount, secondFXAccount
+		if first != transaction.Currency {
+			sourceFXAccount, destinationFXAccount = secondFXAccount, firstFXAccount
+		}
+
+		entry.Postings = append(entry.Postings,
+			models.Posting{AccountID: sourceFXAccount.ID, Amount: transaction.Amount, Currency: transaction.Currency},
+			models.Posting{AccountID: destinationFXAccount.ID, Amount: transaction.DestinationAmount.Neg(), Currency: transaction.DestinationCurrency},
+		)
+		accounts = append(accounts, sourceFXAccount, destinationFXAccount)
+	}
+
+	if transaction.ReversalOfID != nil {
+		entry.Kind = models.JournalKindReversal
+	}
+
+	return s.ledger.Post(ctx, tx, entry, accounts...)
+}
+
+// quoteDestinationAmount fills in the destination side of transaction. Same
+// currency transfers credit the source amount unchanged; otherwise the amount
+// is converted at the FX rate in effect now and rounded to the destination
+// currency's minor unit.
+func (s *TransactionServiceImpl) quoteDestinationAmount(ctx context.Context, tx *sql.Tx, transaction *models.Transaction, destinationCurrency money.Currency) error {
+	transaction.DestinationCurrency = destinationCurrency
+
+	if transaction.Currency == destinationCurrency {
+		transaction.DestinationAmount = transaction.Amount
+		return nil
+	}
+
+	rate, err := s.fxRateRepo.GetEffectiveRate(ctx, tx, transaction.Currency, destinationCurrency, time.Now())
+	if err != nil {
+		if errors.IsFXRateNotFound(err) {
+			s.logger.Warn("no fx rate for cross-currency transfer",
+				"source_currency", transaction.Currency,
+				"destination_currency", destinationCurrency,
+			)
+			return errors.NewCurrencyMismatchError(transaction.Currency.String(), destinationCurrency.String(), err)
+		}
+		s.logger.Error("failed to get fx rate",
+			"source_currency", transaction.Currency,
+			"destination_currency", destinationCurrency,
+			"error", err.Error(),
+		)
+		return errors.NewTransactionError("get fx rate", err)
+	}
+
+	conversion, err := money.Convert(transaction.Amount, rate.Rate, destinationCurrency)
+	if err != nil {
+		return errors.NewValidationError("amount", "converted amount is out of range")
+	}
+	if !conversion.Amount.IsPositive() {
+		return errors.NewValidationError("amount", fmt.Sprintf("too small to convert to %s", destinationCurrency))
+	}
+
+	transaction.DestinationAmount = conversion.Amount
+	transaction.FXRateID = &rate.ID
+	transaction.FXRate = &conversion.Rate
+	transaction.FXRoundingAdjustment = &conversion.RoundingAdjustment
 	return nil
 }
 
-func (s *TransactionServiceImpl) createTransferAuditLog(ctx context.Context, tx *sql.Tx, transaction *models.Transaction, oldSourceBalance, newSourceBalance, oldDestinationBalance, newDestinationBalance float64) error {
-	sourceOldSnapshot := models.AccountBalanceSnapshot{
-		ID:      transaction.SourceAccountID,
-		Balance: oldSourceBalance,
+// quoteReversalAmount fills in what a reversal of a cross-currency transfer
+// takes from the original destination: amount converted at the original
+// rate or, when final is set, everything not yet returned.
+func (s *TransactionServiceImpl) quoteReversalAmount(ctx context.Context, tx *sql.Tx, original, reversal *models.Transaction, final bool) error {
+	conversion, err := money.Convert(reversal.DestinationAmount, *original.FXRate, original.DestinationCurrency)
+	if err != nil {
+		return errors.NewValidationError("amount", "converted amount is out of range")
 	}
 
-	sourceNewSnapshot := models.AccountBalanceSnapshot{
-		ID:      transaction.SourceAccountID,
-		Balance: newSourceBalance,
+	if final {
+		returned, err := s.transactionRepo.SumReversals(ctx, tx, original.ID)
+		if err != nil {
+			return errors.NewTransactionError("sum reversals", err)
+		}
+		conversion = conversion.WithAmount(original.DestinationAmount.Sub(returned))
+	}
+	if !conversion.Amount.IsPositive() {
+		return errors.NewValidationError("amount", fmt.Sprintf("too small to convert to %s", original.DestinationCurrency))
 	}
 
-	sourceOldValue, _ := json.Marshal(sourceOldSnapshot)
-	sourceNewValue, _ := json.Marshal(sourceNewSnapshot)
+	reversal.Amount = conversion.Amount
+	reversal.FXRateID = original.FXRateID
+	reversal.FXRate = original.FXRate
+	reversal.FXRoundingAdjustment = &conversion.RoundingAdjustment
+	return nil
+}
+
+func (s *TransactionServiceImpl) createReversedAuditLog(ctx context.Context, tx *sql.Tx, original *models.Transaction, oldReversedAmount money.Amount) error {
+	oldValue, err := json.Marshal(models.TransactionReversalSnapshot{
+		ID:             original.ID,
+		Amount:         original.Amount,
+		Currency:       original.Currency,
+		ReversedAmount: oldReversedAmount,
+	})
+	if err != nil {
+		return err
+	}
+
+	newValue, err := json.Marshal(models.TransactionReversalSnapshot{
+		ID:             original.ID,
+		Amount:         original.Amount,
+		Currency:       original.Currency,
+		ReversedAmount: original.ReversedAmount,
+	})
+	if err != nil {
+		return err
+	}
+
+	auditLog := &models.AuditLog{
+		Event:    models.AuditEventTransactionReversed,
+		EntityID: original.ID,
+		OldValue: oldValue,
+		NewValue: newValue,
+	}
+
+	return s.auditRepo.Create(ctx, tx, auditLog)
+}
+
+func (s *TransactionServiceImpl) createTransferAuditLog(ctx context.Context, tx *sql.Tx, event models.AuditEvent, transaction *models.Transaction, oldSourceBalance, newSourceBalance, oldDestinationBalance, newDestinationBalance money.Amount) error {
+	sourceOldValue, err := json.Marshal(models.AccountBalanceSnapshot{
+		ID:       transaction.SourceAccountID,
+		Currency: transaction.Currency,
+		Balance:  oldSourceBalance,
+	})
+	if err != nil {
+		return err
+	}
+	sourceNewValue, err := json.Marshal(models.AccountBalanceSnapshot{
+		ID:       transaction.SourceAccountID,
+		Currency: transaction.Currency,
+		Balance:  newSourceBalance,
+	})
+	if err != nil {
+		return err
+	}
 
 	sourceAuditLog := &models.AuditLog{
-		EntityType: "account",
-		EntityID:   transaction.SourceAccountID,
-		Action:     "debit",
-		OldValue:   sourceOldValue,
-		NewValue:   sourceNewValue,
+		Event:    models.AuditEventAccountDebited,
+		EntityID: transaction.SourceAccountID,
+		OldValue: sourceOldValue,
+		NewValue: sourceNewValue,
 	}
 
 	if err := s.auditRepo.Create(ctx, tx, sourceAuditLog); err != nil {
 		return fmt.Errorf("failed to create source account audit log: %w", err)
 	}
 
-	destinationOldSnapshot := models.AccountBalanceSnapshot{
-		ID:      transaction.DestinationAccountID,
-		Balance: oldDestinationBalance,
+	destinationOldValue, err := json.Marshal(models.AccountBalanceSnapshot{
+		ID:       transaction.DestinationAccountID,
+		Currency: transaction.DestinationCurrency,
+		Balance:  oldDestinationBalance,
+	})
+	if err != nil {
+		return err
 	}
-
-	destinationNewSnapshot := models.AccountBalanceSnapshot{
-		ID:      transaction.DestinationAccountID,
-		Balance: newDestinationBalance,
+	destinationNewValue, err := json.Marshal(models.AccountBalanceSnapshot{
+		ID:       transaction.DestinationAccountID,
+		Currency: transaction.DestinationCurrency,
+		Balance:  newDestinationBalance,
+	})
+	if err != nil {
+		return err
 	}
 
-	destinationOldValue, _ := json.Marshal(destinationOldSnapshot)
-	destinationNewValue, _ := json.Marshal(destinationNewSnapshot)
-
 	destinationAuditLog := &models.AuditLog{
-		EntityType: "account",
-		EntityID:   transaction.DestinationAccountID,
-		Action:     "credit",
-		OldValue:   destinationOldValue,
-		NewValue:   destinationNewValue,
+		Event:    models.AuditEventAccountCredited,
+		EntityID: transaction.DestinationAccountID,
+		OldValue: destinationOldValue,
+		NewValue: destinationNewValue,
 	}
 
 	if err := s.auditRepo.Create(ctx, tx, destinationAuditLog); err != nil {
@@ -240,25 +1027,15 @@ func (s *TransactionServiceImpl) createTransferAuditLog(ctx context.Context, tx
 	}
 
 	// audit log for the tx itself
-	txSnapshot := struct {
-		ID                   string  `json:"id"`
-		SourceAccountID      string  `json:"source_account_id"`
-		DestinationAccountID string  `json:"destination_account_id"`
-		Amount               float64 `json:"amount"`
-	}{
-		ID:                   transaction.ID,
-		SourceAccountID:      transaction.SourceAccountID,
-		DestinationAccountID: transaction.DestinationAccountID,
-		Amount:               transaction.Amount,
+	txValue, err := json.Marshal(models.NewTransactionSnapshot(transaction))
+	if err != nil {
+		return err
 	}
 
-	txValue, _ := json.Marshal(txSnapshot)
-
 	txAuditLog := &models.AuditLog{
-		EntityType: "transaction",
-		EntityID:   transaction.ID,
-		Action:     "transfer",
-		NewValue:   txValue,
+		Event:    event,
+		EntityID: transaction.ID,
+		NewValue: txValue,
 	}
 
 	if err := s.auditRepo.Create(ctx, tx, txAuditLog); err != nil {
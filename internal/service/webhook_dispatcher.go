@@ -0,0 +1,435 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"expvar"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+
+	"github.com/riteshkumar/internal-transfers/internal/errors"
+	"github.com/riteshkumar/internal-transfers/internal/models"
+	"github.com/riteshkumar/internal-transfers/internal/repository"
+)
+
+// Headers of webhook requests. The signature is "v1=" followed by the hex
+// HMAC-SHA256, keyed by the subscription's secret, of the timestamp, a dot
+// and the body.
+const (
+	WebhookIDHeader        = "Webhook-Id"
+	WebhookEventHeader     = "Webhook-Event"
+	WebhookTimestampHeader = "Webhook-Timestamp"
+	WebhookSignatureHeader = "Webhook-Signature"
+
+	webhookSignatureVersion = "v1"
+)
+
+const (
+	// DefaultWebhookTimeout bounds one delivery attempt.
+	DefaultWebhookTimeout = 10 * time.Second
+	// DefaultWebhookBatchSize is how many due deliveries one dispatcher run
+	// attempts at most.
+	DefaultWebhookBatchSize = 50
+
+	// webhookDeliveryLease is how long a claimed delivery is kept from other
+	// dispatchers. Deliveries are claimed one at a time, so it only has to
+	// outlast one attempt; it is stretched for clients with long timeouts.
+	webhookDeliveryLease = time.Minute
+	// maxWebhookResponseBody is how much of a response is read before the
+	// connection is dropped.
+	maxWebhookResponseBody = 64 << 10
+)
+
+// Webhook delivery metrics, published at /admin/debug/vars.
+var (
+	webhookDeliveriesSucceeded = expvar.NewInt("webhook_deliveries_succeeded")
+	webhookAttemptsFailed      = expvar.NewInt("webhook_attempts_failed")
+	webhookDeliveriesFailed    = expvar.NewInt("webhook_deliveries_failed")
+)
+
+// NewWebhookClient returns the HTTP client deliveries are sent with. It
+// does not follow redirects, which would turn the signed POST into a
+// bodiless GET, so a 3xx fails the attempt. Unless allowLocalHosts is set,
+// it refuses to connect to loopback, link-local, multicast and unspecified
+// addresses, whatever the subscription's host resolves to, so webhooks
+// can't reach the service's own host or cloud metadata endpoints.
+func NewWebhookClient(timeout time.Duration, allowLocalHosts bool) *http.Client {
+	dialer := &net.Dialer{Timeout: timeout}
+	if !allowLocalHosts {
+		dialer.Control = func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			addr, err := netip.ParseAddr(host)
+			if err != nil {
+				return err
+			}
+			if isLocalWebhookAddr(addr) {
+				return fmt.Errorf("webhook address %s is not allowed", addr)
+			}
+			return nil
+		}
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = dialer.DialContext
+	return &http.Client{
+		Transport: transport,
+		Timeout:   timeout,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// isLocalWebhookAddr reports whether webhooks may not be sent to addr.
+// Private networks are allowed, as receivers are often internal services.
+func isLocalWebhookAddr(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	return addr.IsLoopback() || addr.IsLinkLocalUnicast() || addr.IsLinkLocalMulticast() ||
+		addr.IsInterfaceLocalMulticast() || addr.IsMulticast() || addr.IsUnspecified()
+}
+
+// WebhookRetryPolicy spaces out the attempts of a delivery: after failed
+// attempt n the next one waits BaseDelay doubled n-1 times, up to MaxDelay.
+// A delivery FAILS once it has made MaxAttempts attempts. Attempts are
+// counted afresh after a manual redelivery.
+type WebhookRetryPolicy struct {
+	MaxAttempts int
+	BaseDelay   time.Duration
+	MaxDelay    time.Duration
+}
+
+// DefaultWebhookRetryPolicy retries for about an hour: 30s, 1m, 2m, ... 32m.
+var DefaultWebhookRetryPolicy = WebhookRetryPolicy{
+	MaxAttempts: 8,
+	BaseDelay:   30 * time.Second,
+	MaxDelay:    time.Hour,
+}
+
+// Delay returns how long to wait after failed attempt n, counting from 1.
+func (p WebhookRetryPolicy) Delay(n int) time.Duration {
+	delay := p.BaseDelay
+	for i := 1; i < n && delay < p.MaxDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, p.MaxDelay)
+}
+
+// SignWebhookPayload returns the Webhook-Signature header value for body
+// sent at timestamp.
+func SignWebhookPayload(secret string, timestamp time.Time, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp.Unix(), 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return webhookSignatureVersion + "=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// VerifyWebhookSignature checks a webhook request's signature and timestamp
+// headers against its body, rejecting timestamps more than tolerance away
+// from now so that captured requests can't be replayed later. It is what a
+// receiver runs, and is used in tests.
+func VerifyWebhookSignature(secret, signature, timestamp string, body []byte, now time.Time, tolerance time.Duration) error {
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return fmt.Errorf("malformed timestamp")
+	}
+	sentAt := time.Unix(seconds, 0)
+	if sentAt.Before(now.Add(-tolerance)) || sentAt.After(now.Add(tolerance)) {
+		return fmt.Errorf("timestamp outside tolerance")
+	}
+	expected := SignWebhookPayload(secret, sentAt, body)
+	if !hmac.Equal([]byte(signature), []byte(expected)) {
+		return fmt.Errorf("signature mismatch")
+	}
+	return nil
+}
+
+// WebhookPublisher turns relayed outbox events into webhook deliveries, one
+// per matching active subscription. An event relayed twice gets one
+// delivery per subscription.
+type WebhookPublisher struct {
+	webhookRepo repository.WebhookRepository
+	logger      *slog.Logger
+	now         func() time.Time
+}
+
+func NewWebhookPublisher(webhookRepo repository.WebhookRepository, logger *slog.Logger) *WebhookPublisher {
+	return &WebhookPublisher{
+		webhookRepo: webhookRepo,
+		logger:      logger,
+		now:         func() time.Time { return time.Now().UTC() },
+	}
+}
+
+func (p *WebhookPublisher) Publish(ctx context.Context, event *models.OutboxEvent) error {
+	subscriptions, err := p.webhookRepo.ListSubscriptionsForEvent(ctx, event.Type)
+	if err != nil {
+		return err
+	}
+	if len(subscriptions) == 0 {
+		return nil
+	}
+
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to encode event: %w", err)
+	}
+
+	now := p.now()
+	for _, subscription := range subscriptions {
+		delivery := &models.WebhookDelivery{
+			ID:             uuid.New().String(),
+			SubscriptionID: subscription.ID,
+			EventID:        event.ID,
+			EventType:      event.Type,
+			Payload:        payload,
+			Status:         models.WebhookDeliveryStatusPending,
+			NextAttemptAt:  &now,
+			CreatedAt:      now,
+			UpdatedAt:      now,
+		}
+		created, err := p.webhookRepo.CreateDelivery(ctx, delivery)
+		if err != nil {
+			return err
+		}
+		if created {
+			p.logger.Info("webhook delivery scheduled",
+				"delivery_id", delivery.ID,
+				"webhook_id", subscription.ID,
+				"event_id", event.ID,
+				"event_type", event.Type,
+			)
+		}
+	}
+	return nil
+}
+
+// WebhookDispatcher POSTs due webhook deliveries to their subscriptions,
+// signed with the subscription's secret, and logs every attempt. A 2xx
+// response delivers the event; anything else, or no response, is retried
+// according to the retry policy. Deliveries of paused subscriptions wait.
+type WebhookDispatcher struct {
+	webhookRepo repository.WebhookRepository
+	client      *http.Client
+	policy      WebhookRetryPolicy
+	batchSize   int
+	lease       time.Duration
+	logger      *slog.Logger
+	now         func() time.Time
+}
+
+func NewWebhookDispatcher(webhookRepo repository.WebhookRepository, client *http.Client, policy WebhookRetryPolicy, logger *slog.Logger) *WebhookDispatcher {
+	return &WebhookDispatcher{
+		webhookRepo: webhookRepo,
+		client:      client,
+		policy:      policy,
+		batchSize:   DefaultWebhookBatchSize,
+		lease:       max(webhookDeliveryLease, 2*client.Timeout),
+		logger:      logger,
+		now:         func() time.Time { return time.Now().UTC() },
+	}
+}
+
+// DeliverOnce attempts up to a batch of due deliveries and returns how many
+// it attempted. Each delivery is claimed just before it is attempted, so
+// its lease only has to cover that one attempt.
+func (d *WebhookDispatcher) DeliverOnce(ctx context.Context) (int, error) {
+	subscriptions := map[string]*models.WebhookSubscription{}
+	attempted := 0
+	for attempted < d.batchSize {
+		now := d.now()
+		deliveries, err := d.webhookRepo.ClaimDueDeliveries(ctx, now, now.Add(d.lease), 1)
+		if err != nil {
+			return attempted, err
+		}
+		if len(deliveries) == 0 {
+			break
+		}
+		delivery := deliveries[0]
+		attempted++
+
+		subscription, ok := subscriptions[delivery.SubscriptionID]
+		if !ok {
+			if subscription, err = d.webhookRepo.GetSubscription(ctx, delivery.SubscriptionID); err != nil {
+				// The delivery is due again when its lease runs out
+				d.logger.Error("failed to get webhook subscription for delivery",
+					"delivery_id", delivery.ID,
+					"webhook_id", delivery.SubscriptionID,
+					"error", err.Error(),
+				)
+				continue
+			}
+			subscriptions[delivery.SubscriptionID] = subscription
+		}
+
+		if err := d.deliver(ctx, subscription, delivery); err != nil {
+			return attempted, err
+		}
+	}
+	return attempted, nil
+}
+
+// deliver makes one attempt at delivery and records its outcome.
+func (d *WebhookDispatcher) deliver(ctx context.Context, subscription *models.WebhookSubscription, delivery *models.WebhookDelivery) error {
+	attempt := d.send(ctx, subscription, delivery)
+
+	now := d.now()
+	delivery.UpdatedAt = now
+	delivery.LastResponseCode = attempt.ResponseCode
+	delivery.LastError = attempt.Error
+	// Attempts made with the delivery's current set of retries
+	attempts := delivery.Attempts + 1 - delivery.RetryBudgetStart
+	delivery.DeliveredAt = nil
+	switch {
+	case attempt.Succeeded():
+		delivery.Status = models.WebhookDeliveryStatusSucceeded
+		delivery.NextAttemptAt = nil
+		delivery.DeliveredAt = &now
+	case attempts >= d.policy.MaxAttempts:
+		delivery.Status = models.WebhookDeliveryStatusFailed
+		delivery.NextAttemptAt = nil
+	default:
+		next := now.Add(d.policy.Delay(attempts))
+		delivery.Status = models.WebhookDeliveryStatusPending
+		delivery.NextAttemptAt = &next
+	}
+
+	if err := d.webhookRepo.RecordAttempt(ctx, delivery, attempt); err != nil {
+		if err == errors.ErrWebhookDeliveryLeaseLost {
+			// The attempt outlived its lease and the delivery is another
+			// dispatcher's now, which records its own attempts
+			d.logger.Warn("webhook delivery lease lost before recording attempt",
+				"delivery_id", delivery.ID,
+			)
+			return nil
+		}
+		d.logger.Error("failed to record webhook delivery attempt",
+			"delivery_id", delivery.ID,
+			"error", err.Error(),
+		)
+		return err
+	}
+
+	switch delivery.Status {
+	case models.WebhookDeliveryStatusSucceeded:
+		webhookDeliveriesSucceeded.Add(1)
+	case models.WebhookDeliveryStatusFailed:
+		webhookAttemptsFailed.Add(1)
+		webhookDeliveriesFailed.Add(1)
+	default:
+		webhookAttemptsFailed.Add(1)
+	}
+
+	logArgs := []any{
+		"delivery_id", delivery.ID,
+		"webhook_id", subscription.ID,
+		"event_id", delivery.EventID,
+		"attempt", attempt.Attempt,
+		"status", delivery.Status,
+	}
+	if attempt.ResponseCode != nil {
+		logArgs = append(logArgs, "response_code", *attempt.ResponseCode)
+	}
+	if attempt.Error != nil {
+		logArgs = append(logArgs, "error", *attempt.Error)
+	}
+	if attempt.Succeeded() {
+		d.logger.Info("webhook delivered", logArgs...)
+	} else {
+		d.logger.Warn("webhook delivery attempt failed", logArgs...)
+	}
+	return nil
+}
+
+// send POSTs delivery's payload to the subscription's URL.
+func (d *WebhookDispatcher) send(ctx context.Context, subscription *models.WebhookSubscription, delivery *models.WebhookDelivery) *models.WebhookDeliveryAttempt {
+	requestedAt := d.now()
+	attempt := &models.WebhookDeliveryAttempt{RequestedAt: requestedAt}
+	fail := func(message string) *models.WebhookDeliveryAttempt {
+		attempt.Error = &message
+		return attempt
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, subscription.URL, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return fail("invalid request: " + err.Error())
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "internal-transfers-webhooks/1")
+	req.Header.Set(WebhookIDHeader, delivery.ID)
+	req.Header.Set(WebhookEventHeader, string(delivery.EventType))
+	req.Header.Set(WebhookTimestampHeader, strconv.FormatInt(requestedAt.Unix(), 10))
+	req.Header.Set(WebhookSignatureHeader, SignWebhookPayload(subscription.Secret, requestedAt, delivery.Payload))
+
+	start := time.Now()
+	resp, err := d.client.Do(req)
+	attempt.DurationMs = time.Since(start).Milliseconds()
+	if err != nil {
+		return fail(err.Error())
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, maxWebhookResponseBody))
+	attempt.ResponseCode = &resp.StatusCode
+	if !attempt.Succeeded() {
+		message := fmt.Sprintf("receiver responded %d", resp.StatusCode)
+		if excerpt := strings.TrimSpace(string(body)); excerpt != "" {
+			message += ": " + truncate(excerpt, 200)
+		}
+		return fail(message)
+	}
+	return attempt
+}
+
+// Run calls DeliverOnce every interval until ctx is cancelled. A full batch
+// is followed straight away by the next one.
+func (d *WebhookDispatcher) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			for {
+				attempted, err := d.DeliverOnce(ctx)
+				if err != nil {
+					if ctx.Err() == nil {
+						d.logger.Error("failed to dispatch webhooks", "error", err.Error())
+					}
+					break
+				}
+				if attempted < d.batchSize {
+					break
+				}
+			}
+		}
+	}
+}
+
+// truncate cuts s to n characters, never inside a UTF-8 sequence.
+func truncate(s string, n int) string {
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	return string([]rune(s)[:n]) + "..."
+}
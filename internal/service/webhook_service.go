@@ -0,0 +1,340 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"net/netip"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/riteshkumar/internal-transfers/internal/errors"
+	"github.com/riteshkumar/internal-transfers/internal/models"
+	"github.com/riteshkumar/internal-transfers/internal/repository"
+)
+
+// Limits of webhook subscription fields.
+const (
+	maxWebhookURLLength         = 2048
+	maxWebhookDescriptionLength = 255
+	minWebhookSecretLength      = 16
+	maxWebhookSecretLength      = 255
+)
+
+// Page sizes of webhook delivery log queries.
+const (
+	defaultWebhookDeliveryPageSize = 50
+	maxWebhookDeliveryPageSize     = 200
+)
+
+type WebhookService interface {
+	CreateSubscription(ctx context.Context, req *models.CreateWebhookSubscriptionRequest) (*models.WebhookSubscription, error)
+	GetSubscription(ctx context.Context, id string) (*models.WebhookSubscription, error)
+	ListSubscriptions(ctx context.Context) (*models.WebhookSubscriptionListResponse, error)
+	UpdateSubscription(ctx context.Context, id string, req *models.UpdateWebhookSubscriptionRequest) (*models.WebhookSubscription, error)
+	DeleteSubscription(ctx context.Context, id string) error
+	ListDeliveries(ctx context.Context, filter models.WebhookDeliveryFilter) (*models.WebhookDeliveryListResponse, error)
+	GetDelivery(ctx context.Context, id string) (*models.WebhookDelivery, error)
+	Redeliver(ctx context.Context, id string) (*models.WebhookDelivery, error)
+}
+
+type WebhookServiceImpl struct {
+	webhookRepo repository.WebhookRepository
+	// allowLocalHosts lets subscriptions name loopback and link-local hosts,
+	// which NewWebhookClient refuses to connect to otherwise.
+	allowLocalHosts bool
+	logger          *slog.Logger
+}
+
+func NewWebhookService(webhookRepo repository.WebhookRepository, allowLocalHosts bool, logger *slog.Logger) *WebhookServiceImpl {
+	return &WebhookServiceImpl{
+		webhookRepo:     webhookRepo,
+		allowLocalHosts: allowLocalHosts,
+		logger:          logger,
+	}
+}
+
+// CreateSubscription subscribes a URL to events. The response is the only
+// one that includes the secret, which is generated when none is given.
+func (s *WebhookServiceImpl) CreateSubscription(ctx context.Context, req *models.CreateWebhookSubscriptionRequest) (*models.WebhookSubscription, error) {
+	eventTypes, err := s.validateWebhookSubscription(req.URL, req.EventTypes, req.Description)
+	if err != nil {
+		return nil, err
+	}
+
+	secret := req.Secret
+	if secret == "" {
+		if secret, err = generateWebhookSecret(); err != nil {
+			return nil, err
+		}
+	} else if len(secret) < minWebhookSecretLength || len(secret) > maxWebhookSecretLength {
+		return nil, errors.NewValidationError("secret", fmt.Sprintf("must be %d to %d characters", minWebhookSecretLength, maxWebhookSecretLength))
+	}
+
+	subscription := &models.WebhookSubscription{
+		ID:          uuid.New().String(),
+		URL:         req.URL,
+		EventTypes:  eventTypes,
+		Secret:      secret,
+		Description: req.Description,
+		Active:      true,
+	}
+	if err := s.webhookRepo.CreateSubscription(ctx, subscription); err != nil {
+		s.logger.Error("failed to create webhook subscription",
+			"url", req.URL,
+			"error", err.Error(),
+		)
+		return nil, err
+	}
+
+	s.logger.Info("webhook subscription created",
+		"webhook_id", subscription.ID,
+		"url", subscription.URL,
+		"event_types", subscription.EventTypes,
+	)
+	return subscription, nil
+}
+
+func (s *WebhookServiceImpl) GetSubscription(ctx context.Context, id string) (*models.WebhookSubscription, error) {
+	if _, err := uuid.Parse(id); err != nil {
+		return nil, errors.ErrInvalidWebhookID
+	}
+
+	subscription, err := s.webhookRepo.GetSubscription(ctx, id)
+	if err != nil {
+		if err != errors.ErrWebhookNotFound {
+			s.logger.Error("failed to get webhook subscription", "webhook_id", id, "error", err.Error())
+		}
+		return nil, err
+	}
+	subscription.Secret = ""
+	return subscription, nil
+}
+
+func (s *WebhookServiceImpl) ListSubscriptions(ctx context.Context) (*models.WebhookSubscriptionListResponse, error) {
+	subscriptions, err := s.webhookRepo.ListSubscriptions(ctx)
+	if err != nil {
+		s.logger.Error("failed to list webhook subscriptions", "error", err.Error())
+		return nil, err
+	}
+
+	response := &models.WebhookSubscriptionListResponse{Webhooks: subscriptions}
+	if response.Webhooks == nil {
+		response.Webhooks = []*models.WebhookSubscription{}
+	}
+	for _, subscription := range response.Webhooks {
+		subscription.Secret = ""
+	}
+	return response, nil
+}
+
+// UpdateSubscription replaces a subscription's URL, event filter and
+// description, and pauses or resumes it when req.Active is set. Deliveries
+// of a paused subscription wait until it is resumed.
+func (s *WebhookServiceImpl) UpdateSubscription(ctx context.Context, id string, req *models.UpdateWebhookSubscriptionRequest) (*models.WebhookSubscription, error) {
+	subscription, err := s.GetSubscription(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	eventTypes, err := s.validateWebhookSubscription(req.URL, req.EventTypes, req.Description)
+	if err != nil {
+		return nil, err
+	}
+	subscription.URL = req.URL
+	subscription.EventTypes = eventTypes
+	subscription.Description = req.Description
+	if req.Active != nil {
+		subscription.Active = *req.Active
+	}
+
+	if err := s.webhookRepo.UpdateSubscription(ctx, subscription); err != nil {
+		if err != errors.ErrWebhookNotFound {
+			s.logger.Error("failed to update webhook subscription", "webhook_id", id, "error", err.Error())
+		}
+		return nil, err
+	}
+
+	s.logger.Info("webhook subscription updated",
+		"webhook_id", id,
+		"url", subscription.URL,
+		"event_types", subscription.EventTypes,
+		"active", subscription.Active,
+	)
+	return subscription, nil
+}
+
+// DeleteSubscription deletes a subscription and its delivery log.
+func (s *WebhookServiceImpl) DeleteSubscription(ctx context.Context, id string) error {
+	if _, err := uuid.Parse(id); err != nil {
+		return errors.ErrInvalidWebhookID
+	}
+
+	if err := s.webhookRepo.DeleteSubscription(ctx, id); err != nil {
+		if err != errors.ErrWebhookNotFound {
+			s.logger.Error("failed to delete webhook subscription", "webhook_id", id, "error", err.Error())
+		}
+		return err
+	}
+
+	s.logger.Info("webhook subscription deleted", "webhook_id", id)
+	return nil
+}
+
+// ListDeliveries returns a page of a subscription's deliveries, newest
+// first.
+func (s *WebhookServiceImpl) ListDeliveries(ctx context.Context, filter models.WebhookDeliveryFilter) (*models.WebhookDeliveryListResponse, error) {
+	if _, err := s.GetSubscription(ctx, filter.SubscriptionID); err != nil {
+		return nil, err
+	}
+	if err := validateWebhookDeliveryFilter(&filter); err != nil {
+		return nil, err
+	}
+
+	// Fetch one extra row to learn whether there is a next page
+	pageSize := filter.Limit
+	filter.Limit++
+	deliveries, err := s.webhookRepo.ListDeliveries(ctx, filter)
+	if err != nil {
+		s.logger.Error("failed to list webhook deliveries",
+			"webhook_id", filter.SubscriptionID,
+			"error", err.Error(),
+		)
+		return nil, err
+	}
+
+	response := &models.WebhookDeliveryListResponse{Deliveries: deliveries}
+	if len(deliveries) > pageSize {
+		response.Deliveries = deliveries[:pageSize]
+		last := response.Deliveries[pageSize-1]
+		response.NextCursor = models.Cursor{
+			Value: last.CreatedAt.Format(time.RFC3339Nano),
+			ID:    last.ID,
+		}.Encode()
+	}
+	if response.Deliveries == nil {
+		response.Deliveries = []*models.WebhookDelivery{}
+	}
+	return response, nil
+}
+
+// GetDelivery returns a delivery with its attempt log.
+func (s *WebhookServiceImpl) GetDelivery(ctx context.Context, id string) (*models.WebhookDelivery, error) {
+	if _, err := uuid.Parse(id); err != nil {
+		return nil, errors.ErrInvalidWebhookDeliveryID
+	}
+
+	delivery, err := s.webhookRepo.GetDelivery(ctx, id)
+	if err != nil {
+		if err != errors.ErrWebhookDeliveryNotFound {
+			s.logger.Error("failed to get webhook delivery", "delivery_id", id, "error", err.Error())
+		}
+		return nil, err
+	}
+
+	if delivery.AttemptLog, err = s.webhookRepo.ListAttempts(ctx, id); err != nil {
+		s.logger.Error("failed to list webhook delivery attempts", "delivery_id", id, "error", err.Error())
+		return nil, err
+	}
+	if delivery.AttemptLog == nil {
+		delivery.AttemptLog = []*models.WebhookDeliveryAttempt{}
+	}
+	return delivery, nil
+}
+
+// Redeliver schedules a delivery to be attempted again straight away,
+// whatever its status, unless a dispatcher is attempting it right now.
+func (s *WebhookServiceImpl) Redeliver(ctx context.Context, id string) (*models.WebhookDelivery, error) {
+	if _, err := uuid.Parse(id); err != nil {
+		return nil, errors.ErrInvalidWebhookDeliveryID
+	}
+
+	delivery, err := s.webhookRepo.Redeliver(ctx, id, time.Now().UTC())
+	if err != nil {
+		if err != errors.ErrWebhookDeliveryNotFound && err != errors.ErrWebhookDeliveryInFlight {
+			s.logger.Error("failed to redeliver webhook delivery", "delivery_id", id, "error", err.Error())
+		}
+		return nil, err
+	}
+
+	s.logger.Info("webhook delivery scheduled for redelivery",
+		"delivery_id", id,
+		"webhook_id", delivery.SubscriptionID,
+		"event_id", delivery.EventID,
+	)
+	return delivery, nil
+}
+
+// validateWebhookSubscription checks the fields shared by creating and
+// updating a subscription and returns the event types without duplicates.
+func (s *WebhookServiceImpl) validateWebhookSubscription(rawURL string, eventTypes []models.DomainEventType, description string) ([]models.DomainEventType, error) {
+	if rawURL == "" || len(rawURL) > maxWebhookURLLength {
+		return nil, errors.NewValidationError("url", fmt.Sprintf("must be 1 to %d characters", maxWebhookURLLength))
+	}
+	parsed, err := url.Parse(rawURL)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return nil, errors.NewValidationError("url", "must be an absolute http or https URL")
+	}
+	// Hosts resolving to such addresses are refused when delivering
+	if !s.allowLocalHosts {
+		host := strings.ToLower(strings.TrimSuffix(parsed.Hostname(), "."))
+		addr, err := netip.ParseAddr(host)
+		if host == "localhost" || strings.HasSuffix(host, ".localhost") || (err == nil && isLocalWebhookAddr(addr)) {
+			return nil, errors.NewValidationError("url", "must not point at a loopback, link-local, multicast or unspecified address")
+		}
+	}
+	if len(description) > maxWebhookDescriptionLength {
+		return nil, errors.NewValidationError("description", fmt.Sprintf("must be at most %d characters", maxWebhookDescriptionLength))
+	}
+
+	unique := []models.DomainEventType{}
+	for _, eventType := range eventTypes {
+		if !slices.Contains(models.DomainEventTypes, eventType) {
+			return nil, errors.NewValidationError("event_types", fmt.Sprintf("unknown event type %q", eventType))
+		}
+		if !slices.Contains(unique, eventType) {
+			unique = append(unique, eventType)
+		}
+	}
+	return unique, nil
+}
+
+// validateWebhookDeliveryFilter checks filter and applies the default page
+// size.
+func validateWebhookDeliveryFilter(filter *models.WebhookDeliveryFilter) error {
+	switch filter.Status {
+	case "", models.WebhookDeliveryStatusPending, models.WebhookDeliveryStatusSucceeded, models.WebhookDeliveryStatusFailed:
+	default:
+		return errors.NewValidationError("status", "must be PENDING, SUCCEEDED or FAILED")
+	}
+	if filter.After != nil {
+		if _, err := time.Parse(time.RFC3339Nano, filter.After.Value); err != nil {
+			return errors.NewValidationError("cursor", "is malformed")
+		}
+		if _, err := uuid.Parse(filter.After.ID); err != nil {
+			return errors.NewValidationError("cursor", "is malformed")
+		}
+	}
+	if filter.Limit == 0 {
+		filter.Limit = defaultWebhookDeliveryPageSize
+	}
+	if filter.Limit < 0 || filter.Limit > maxWebhookDeliveryPageSize {
+		return errors.NewValidationError("limit", fmt.Sprintf("must be between 1 and %d", maxWebhookDeliveryPageSize))
+	}
+	return nil
+}
+
+// generateWebhookSecret returns a random secret for signing payloads.
+func generateWebhookSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate webhook secret: %w", err)
+	}
+	return "whsec_" + hex.EncodeToString(b), nil
+}
@@ -0,0 +1,813 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/riteshkumar/internal-transfers/internal/errors"
+	"github.com/riteshkumar/internal-transfers/internal/models"
+)
+
+const testWebhookSecret = "test-secret-0123456789"
+
+// fakeWebhookRepository keeps subscriptions and deliveries in memory,
+// handing out copies as the database would.
+type fakeWebhookRepository struct {
+	mu            sync.Mutex
+	subscriptions map[string]*models.WebhookSubscription
+	deliveries    map[string]*models.WebhookDelivery
+	attempts      map[string][]*models.WebhookDeliveryAttempt
+	// lookupErr fails GetSubscription for the subscriptions it names
+	lookupErr map[string]error
+}
+
+func newFakeWebhookRepository() *fakeWebhookRepository {
+	return &fakeWebhookRepository{
+		subscriptions: map[string]*models.WebhookSubscription{},
+		deliveries:    map[string]*models.WebhookDelivery{},
+		attempts:      map[string][]*models.WebhookDeliveryAttempt{},
+	}
+}
+
+func copySubscription(s *models.WebhookSubscription) *models.WebhookSubscription {
+	c := *s
+	c.EventTypes = slices.Clone(s.EventTypes)
+	return &c
+}
+
+func copyDelivery(d *models.WebhookDelivery) *models.WebhookDelivery {
+	c := *d
+	return &c
+}
+
+func (r *fakeWebhookRepository) CreateSubscription(ctx context.Context, subscription *models.WebhookSubscription) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	subscription.CreatedAt = time.Now().UTC()
+	subscription.UpdatedAt = subscription.CreatedAt
+	r.subscriptions[subscription.ID] = copySubscription(subscription)
+	return nil
+}
+
+func (r *fakeWebhookRepository) GetSubscription(ctx context.Context, id string) (*models.WebhookSubscription, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err := r.lookupErr[id]; err != nil {
+		return nil, err
+	}
+	subscription, ok := r.subscriptions[id]
+	if !ok {
+		return nil, errors.ErrWebhookNotFound
+	}
+	return copySubscription(subscription), nil
+}
+
+func (r *fakeWebhookRepository) ListSubscriptions(ctx context.Context) ([]*models.WebhookSubscription, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var subscriptions []*models.WebhookSubscription
+	for _, subscription := range r.subscriptions {
+		subscriptions = append(subscriptions, copySubscription(subscription))
+	}
+	return subscriptions, nil
+}
+
+func (r *fakeWebhookRepository) ListSubscriptionsForEvent(ctx context.Context, eventType models.DomainEventType) ([]*models.WebhookSubscription, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var subscriptions []*models.WebhookSubscription
+	for _, subscription := range r.subscriptions {
+		if subscription.Matches(eventType) {
+			subscriptions = append(subscriptions, copySubscription(subscription))
+		}
+	}
+	return subscriptions, nil
+}
+
+func (r *fakeWebhookRepository) UpdateSubscription(ctx context.Context, subscription *models.WebhookSubscription) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	stored, ok := r.subscriptions[subscription.ID]
+	if !ok {
+		return errors.ErrWebhookNotFound
+	}
+	updated := copySubscription(subscription)
+	updated.Secret = stored.Secret
+	r.subscriptions[subscription.ID] = updated
+	return nil
+}
+
+func (r *fakeWebhookRepository) DeleteSubscription(ctx context.Context, id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.subscriptions[id]; !ok {
+		return errors.ErrWebhookNotFound
+	}
+	delete(r.subscriptions, id)
+	return nil
+}
+
+func (r *fakeWebhookRepository) CreateDelivery(ctx context.Context, delivery *models.WebhookDelivery) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, existing := range r.deliveries {
+		if existing.SubscriptionID == delivery.SubscriptionID && existing.EventID == delivery.EventID {
+			return false, nil
+		}
+	}
+	r.deliveries[delivery.ID] = copyDelivery(delivery)
+	return true, nil
+}
+
+func (r *fakeWebhookRepository) GetDelivery(ctx context.Context, id string) (*models.WebhookDelivery, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delivery, ok := r.deliveries[id]
+	if !ok {
+		return nil, errors.ErrWebhookDeliveryNotFound
+	}
+	return copyDelivery(delivery), nil
+}
+
+func (r *fakeWebhookRepository) ListDeliveries(ctx context.Context, filter models.WebhookDeliveryFilter) ([]*models.WebhookDelivery, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var deliveries []*models.WebhookDelivery
+	for _, delivery := range r.deliveries {
+		if filter.SubscriptionID != "" && delivery.SubscriptionID != filter.SubscriptionID {
+			continue
+		}
+		if filter.Status != "" && delivery.Status != filter.Status {
+			continue
+		}
+		deliveries = append(deliveries, copyDelivery(delivery))
+	}
+	sort.Slice(deliveries, func(i, j int) bool { return deliveries[i].CreatedAt.After(deliveries[j].CreatedAt) })
+	if len(deliveries) > filter.Limit {
+		deliveries = deliveries[:filter.Limit]
+	}
+	return deliveries, nil
+}
+
+func (r *fakeWebhookRepository) ListAttempts(ctx context.Context, deliveryID string) ([]*models.WebhookDeliveryAttempt, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return slices.Clone(r.attempts[deliveryID]), nil
+}
+
+func (r *fakeWebhookRepository) ClaimDueDeliveries(ctx context.Context, now, leaseUntil time.Time, limit int) ([]*models.WebhookDelivery, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var claimed []*models.WebhookDelivery
+	for _, delivery := range r.deliveries {
+		if len(claimed) == limit {
+			break
+		}
+		if delivery.Status != models.WebhookDeliveryStatusPending || delivery.NextAttemptAt.After(now) {
+			continue
+		}
+		if subscription, ok := r.subscriptions[delivery.SubscriptionID]; !ok || !subscription.Active {
+			continue
+		}
+		delivery.NextAttemptAt = &leaseUntil
+		delivery.LeasedUntil = &leaseUntil
+		claimed = append(claimed, copyDelivery(delivery))
+	}
+	return claimed, nil
+}
+
+func (r *fakeWebhookRepository) RecordAttempt(ctx context.Context, delivery *models.WebhookDelivery, attempt *models.WebhookDeliveryAttempt) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	stored, ok := r.deliveries[delivery.ID]
+	if !ok {
+		return errors.ErrWebhookDeliveryNotFound
+	}
+	if stored.LeasedUntil == nil || delivery.LeasedUntil == nil || !stored.LeasedUntil.Equal(*delivery.LeasedUntil) {
+		return errors.ErrWebhookDeliveryLeaseLost
+	}
+	delivery.Attempts = stored.Attempts + 1
+	attempt.Attempt = delivery.Attempts
+	delivery.LeasedUntil = nil
+	r.deliveries[delivery.ID] = copyDelivery(delivery)
+	r.attempts[delivery.ID] = append(r.attempts[delivery.ID], attempt)
+	return nil
+}
+
+func (r *fakeWebhookRepository) Redeliver(ctx context.Context, id string, now time.Time) (*models.WebhookDelivery, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delivery, ok := r.deliveries[id]
+	if !ok {
+		return nil, errors.ErrWebhookDeliveryNotFound
+	}
+	if delivery.LeasedUntil != nil && delivery.LeasedUntil.After(now) {
+		return nil, errors.ErrWebhookDeliveryInFlight
+	}
+	delivery.Status = models.WebhookDeliveryStatusPending
+	delivery.NextAttemptAt = &now
+	delivery.RetryBudgetStart = delivery.Attempts
+	delivery.UpdatedAt = now
+	return copyDelivery(delivery), nil
+}
+
+// onlyDelivery returns the single delivery in the repository.
+func (r *fakeWebhookRepository) onlyDelivery(t *testing.T) *models.WebhookDelivery {
+	t.Helper()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.deliveries) != 1 {
+		t.Fatalf("got %d deliveries, want 1", len(r.deliveries))
+	}
+	for _, delivery := range r.deliveries {
+		return copyDelivery(delivery)
+	}
+	return nil
+}
+
+// receivedWebhook is a request seen by a test receiver.
+type receivedWebhook struct {
+	header http.Header
+	body   []byte
+}
+
+// newWebhookReceiver starts a receiver answering with the given status
+// codes in turn, repeating the last one, and records what it receives.
+func newWebhookReceiver(t *testing.T, codes ...int) (*httptest.Server, func() []receivedWebhook) {
+	t.Helper()
+	var mu sync.Mutex
+	var received []receivedWebhook
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		received = append(received, receivedWebhook{header: r.Header.Clone(), body: body})
+		code := codes[min(len(received), len(codes))-1]
+		mu.Unlock()
+		w.WriteHeader(code)
+		io.WriteString(w, http.StatusText(code))
+	}))
+	t.Cleanup(server.Close)
+	return server, func() []receivedWebhook {
+		mu.Lock()
+		defer mu.Unlock()
+		return slices.Clone(received)
+	}
+}
+
+// webhookFixture wires a service, publisher and dispatcher to one fake
+// repository and a fake clock.
+type webhookFixture struct {
+	repo       *fakeWebhookRepository
+	service    *WebhookServiceImpl
+	publisher  *WebhookPublisher
+	dispatcher *WebhookDispatcher
+	clock      time.Time
+}
+
+func newWebhookFixture(t *testing.T, policy WebhookRetryPolicy) *webhookFixture {
+	t.Helper()
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	f := &webhookFixture{
+		repo:  newFakeWebhookRepository(),
+		clock: time.Now().UTC().Truncate(time.Second),
+	}
+	f.service = NewWebhookService(f.repo, true, logger)
+	f.publisher = NewWebhookPublisher(f.repo, logger)
+	f.publisher.now = func() time.Time { return f.clock }
+	f.dispatcher = NewWebhookDispatcher(f.repo, NewWebhookClient(5*time.Second, true), policy, logger)
+	f.dispatcher.now = func() time.Time { return f.clock }
+	return f
+}
+
+func (f *webhookFixture) subscribe(t *testing.T, url string, eventTypes ...models.DomainEventType) *models.WebhookSubscription {
+	t.Helper()
+	subscription, err := f.service.CreateSubscription(context.Background(), &models.CreateWebhookSubscriptionRequest{
+		URL:        url,
+		EventTypes: eventTypes,
+		Secret:     testWebhookSecret,
+	})
+	if err != nil {
+		t.Fatalf("CreateSubscription: %v", err)
+	}
+	return subscription
+}
+
+func (f *webhookFixture) publish(t *testing.T, eventType models.DomainEventType) *models.OutboxEvent {
+	t.Helper()
+	event := &models.OutboxEvent{
+		Sequence:   1,
+		ID:         uuid.New().String(),
+		Type:       eventType,
+		AccountIDs: []string{"1"},
+		Data:       json.RawMessage(`{"amount":"10.0000"}`),
+		CreatedAt:  f.clock,
+	}
+	if err := f.publisher.Publish(context.Background(), event); err != nil {
+		t.Fatalf("Publish: %v", err)
+	}
+	return event
+}
+
+func (f *webhookFixture) deliverOnce(t *testing.T, want int) {
+	t.Helper()
+	attempted, err := f.dispatcher.DeliverOnce(context.Background())
+	if err != nil {
+		t.Fatalf("DeliverOnce: %v", err)
+	}
+	if attempted != want {
+		t.Fatalf("DeliverOnce attempted %d deliveries, want %d", attempted, want)
+	}
+}
+
+func TestWebhookDispatcherDeliversSignedEvent(t *testing.T) {
+	f := newWebhookFixture(t, DefaultWebhookRetryPolicy)
+	server, received := newWebhookReceiver(t, http.StatusOK)
+	f.subscribe(t, server.URL)
+	event := f.publish(t, models.DomainEventTransferPosted)
+
+	f.deliverOnce(t, 1)
+
+	requests := received()
+	if len(requests) != 1 {
+		t.Fatalf("receiver got %d requests, want 1", len(requests))
+	}
+	request := requests[0]
+	err := VerifyWebhookSignature(testWebhookSecret,
+		request.header.Get(WebhookSignatureHeader),
+		request.header.Get(WebhookTimestampHeader),
+		request.body, f.clock, 5*time.Minute)
+	if err != nil {
+		t.Fatalf("signature does not verify: %v", err)
+	}
+	if got := request.header.Get(WebhookEventHeader); got != string(models.DomainEventTransferPosted) {
+		t.Errorf("%s = %q, want %q", WebhookEventHeader, got, models.DomainEventTransferPosted)
+	}
+	var sent models.OutboxEvent
+	if err := json.Unmarshal(request.body, &sent); err != nil {
+		t.Fatalf("body is not an event: %v", err)
+	}
+	if sent.ID != event.ID {
+		t.Errorf("sent event %s, want %s", sent.ID, event.ID)
+	}
+
+	delivery := f.repo.onlyDelivery(t)
+	if got := request.header.Get(WebhookIDHeader); got != delivery.ID {
+		t.Errorf("%s = %q, want %q", WebhookIDHeader, got, delivery.ID)
+	}
+	logged, err := f.service.GetDelivery(context.Background(), delivery.ID)
+	if err != nil {
+		t.Fatalf("GetDelivery: %v", err)
+	}
+	if logged.Status != models.WebhookDeliveryStatusSucceeded || logged.DeliveredAt == nil || logged.NextAttemptAt != nil {
+		t.Errorf("delivery is %s, delivered at %v, next attempt %v; want SUCCEEDED, delivered, not scheduled",
+			logged.Status, logged.DeliveredAt, logged.NextAttemptAt)
+	}
+	if len(logged.AttemptLog) != 1 || *logged.AttemptLog[0].ResponseCode != http.StatusOK {
+		t.Errorf("attempt log = %+v, want one attempt answered 200", logged.AttemptLog)
+	}
+
+	f.deliverOnce(t, 0)
+}
+
+func TestWebhookDispatcherRetriesWithBackoff(t *testing.T) {
+	f := newWebhookFixture(t, DefaultWebhookRetryPolicy)
+	server, received := newWebhookReceiver(t, http.StatusInternalServerError, http.StatusInternalServerError, http.StatusOK)
+	f.subscribe(t, server.URL)
+	f.publish(t, models.DomainEventAccountCreated)
+
+	start := f.clock
+	f.deliverOnce(t, 1)
+	delivery := f.repo.onlyDelivery(t)
+	if delivery.Status != models.WebhookDeliveryStatusPending || !delivery.NextAttemptAt.Equal(start.Add(30*time.Second)) {
+		t.Fatalf("after attempt 1 delivery is %s due %v, want PENDING due in 30s", delivery.Status, delivery.NextAttemptAt)
+	}
+
+	// Not due yet
+	f.clock = start.Add(29 * time.Second)
+	f.deliverOnce(t, 0)
+
+	f.clock = start.Add(30 * time.Second)
+	f.deliverOnce(t, 1)
+	delivery = f.repo.onlyDelivery(t)
+	if want := f.clock.Add(time.Minute); !delivery.NextAttemptAt.Equal(want) {
+		t.Fatalf("after attempt 2 delivery is due %v, want %v", delivery.NextAttemptAt, want)
+	}
+
+	f.clock = f.clock.Add(time.Minute)
+	f.deliverOnce(t, 1)
+
+	logged, err := f.service.GetDelivery(context.Background(), delivery.ID)
+	if err != nil {
+		t.Fatalf("GetDelivery: %v", err)
+	}
+	if logged.Status != models.WebhookDeliveryStatusSucceeded || logged.Attempts != 3 {
+		t.Fatalf("delivery is %s after %d attempts, want SUCCEEDED after 3", logged.Status, logged.Attempts)
+	}
+	codes := []int{}
+	for i, attempt := range logged.AttemptLog {
+		if attempt.Attempt != i+1 {
+			t.Errorf("attempt %d is numbered %d", i+1, attempt.Attempt)
+		}
+		codes = append(codes, *attempt.ResponseCode)
+	}
+	if want := []int{500, 500, 200}; !slices.Equal(codes, want) {
+		t.Errorf("logged response codes %v, want %v", codes, want)
+	}
+	if logged.AttemptLog[0].Error == nil || !strings.Contains(*logged.AttemptLog[0].Error, "500") {
+		t.Errorf("failed attempt error = %v, want it to name the response code", logged.AttemptLog[0].Error)
+	}
+	if len(received()) != 3 {
+		t.Errorf("receiver got %d requests, want 3", len(received()))
+	}
+}
+
+func TestWebhookDispatcherGivesUpAndRedelivers(t *testing.T) {
+	f := newWebhookFixture(t, WebhookRetryPolicy{MaxAttempts: 2, BaseDelay: time.Second, MaxDelay: time.Minute})
+	server, _ := newWebhookReceiver(t, http.StatusServiceUnavailable, http.StatusServiceUnavailable, http.StatusServiceUnavailable, http.StatusNoContent)
+	f.subscribe(t, server.URL)
+	f.publish(t, models.DomainEventTransferFailed)
+
+	f.deliverOnce(t, 1)
+	f.clock = f.clock.Add(time.Second)
+	f.deliverOnce(t, 1)
+
+	delivery := f.repo.onlyDelivery(t)
+	if delivery.Status != models.WebhookDeliveryStatusFailed || delivery.NextAttemptAt != nil {
+		t.Fatalf("after max attempts delivery is %s due %v, want FAILED and not scheduled", delivery.Status, delivery.NextAttemptAt)
+	}
+	if delivery.LastResponseCode == nil || *delivery.LastResponseCode != http.StatusServiceUnavailable {
+		t.Errorf("last response code = %v, want 503", delivery.LastResponseCode)
+	}
+	f.clock = f.clock.Add(time.Hour)
+	f.deliverOnce(t, 0)
+
+	// A redelivery gets a fresh set of retries
+	if _, err := f.service.Redeliver(context.Background(), delivery.ID); err != nil {
+		t.Fatalf("Redeliver: %v", err)
+	}
+	f.deliverOnce(t, 1)
+	delivery = f.repo.onlyDelivery(t)
+	if delivery.Status != models.WebhookDeliveryStatusPending || !delivery.NextAttemptAt.Equal(f.clock.Add(time.Second)) {
+		t.Fatalf("after a failed redelivery delivery is %s due %v, want PENDING due in 1s", delivery.Status, delivery.NextAttemptAt)
+	}
+	f.clock = f.clock.Add(time.Second)
+	f.deliverOnce(t, 1)
+
+	delivery = f.repo.onlyDelivery(t)
+	if delivery.Status != models.WebhookDeliveryStatusSucceeded || delivery.Attempts != 4 {
+		t.Fatalf("after redelivery delivery is %s after %d attempts, want SUCCEEDED after 4", delivery.Status, delivery.Attempts)
+	}
+
+	if _, err := f.service.Redeliver(context.Background(), uuid.New().String()); err != errors.ErrWebhookDeliveryNotFound {
+		t.Errorf("Redeliver of unknown delivery = %v, want %v", err, errors.ErrWebhookDeliveryNotFound)
+	}
+}
+
+func TestWebhookDispatcherSkipsDeliveryWhoseSubscriptionCannotBeRead(t *testing.T) {
+	f := newWebhookFixture(t, DefaultWebhookRetryPolicy)
+	server, received := newWebhookReceiver(t, http.StatusOK)
+	broken := f.subscribe(t, server.URL)
+	healthy := f.subscribe(t, server.URL)
+	f.repo.lookupErr = map[string]error{broken.ID: fmt.Errorf("connection reset")}
+	f.publish(t, models.DomainEventAccountCreated)
+
+	f.deliverOnce(t, 2)
+
+	if got := f.repo.onlyDeliveryOf(t, healthy.ID).Status; got != models.WebhookDeliveryStatusSucceeded {
+		t.Errorf("delivery of the readable subscription is %s, want SUCCEEDED", got)
+	}
+	skipped := f.repo.onlyDeliveryOf(t, broken.ID)
+	if skipped.Status != models.WebhookDeliveryStatusPending || skipped.Attempts != 0 {
+		t.Errorf("skipped delivery is %s after %d attempts, want PENDING and not attempted", skipped.Status, skipped.Attempts)
+	}
+	if len(received()) != 1 {
+		t.Errorf("receiver got %d requests, want 1", len(received()))
+	}
+
+	// It is attempted once its lease runs out
+	f.repo.lookupErr = nil
+	f.clock = f.clock.Add(f.dispatcher.lease)
+	f.deliverOnce(t, 1)
+	if got := f.repo.onlyDeliveryOf(t, broken.ID).Status; got != models.WebhookDeliveryStatusSucceeded {
+		t.Errorf("skipped delivery is %s after its lease, want SUCCEEDED", got)
+	}
+}
+
+func TestWebhookRedeliverRefusesDeliveryInFlight(t *testing.T) {
+	f := newWebhookFixture(t, DefaultWebhookRetryPolicy)
+	arrived, release := make(chan struct{}), make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(arrived)
+		<-release
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(server.Close)
+	f.subscribe(t, server.URL)
+	f.publish(t, models.DomainEventTransferPosted)
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := f.dispatcher.DeliverOnce(context.Background())
+		done <- err
+	}()
+	<-arrived
+
+	delivery := f.repo.onlyDelivery(t)
+	if _, err := f.service.Redeliver(context.Background(), delivery.ID); err != errors.ErrWebhookDeliveryInFlight {
+		t.Errorf("Redeliver during an attempt = %v, want %v", err, errors.ErrWebhookDeliveryInFlight)
+	}
+
+	close(release)
+	if err := <-done; err != nil {
+		t.Fatalf("DeliverOnce: %v", err)
+	}
+	if _, err := f.service.Redeliver(context.Background(), delivery.ID); err != nil {
+		t.Errorf("Redeliver after the attempt: %v", err)
+	}
+}
+
+func TestWebhookPublisherFiltersSubscriptions(t *testing.T) {
+	f := newWebhookFixture(t, DefaultWebhookRetryPolicy)
+	server, received := newWebhookReceiver(t, http.StatusOK)
+	all := f.subscribe(t, server.URL)
+	transfers := f.subscribe(t, server.URL, models.DomainEventTransferPosted, models.DomainEventTransferReversed)
+	paused := f.subscribe(t, server.URL)
+	active := false
+	if _, err := f.service.UpdateSubscription(context.Background(), paused.ID, &models.UpdateWebhookSubscriptionRequest{
+		URL:    paused.URL,
+		Active: &active,
+	}); err != nil {
+		t.Fatalf("UpdateSubscription: %v", err)
+	}
+
+	f.publish(t, models.DomainEventAccountFrozen)
+	posted := f.publish(t, models.DomainEventTransferPosted)
+	// A relayed event may be published again
+	if err := f.publisher.Publish(context.Background(), posted); err != nil {
+		t.Fatalf("Publish: %v", err)
+	}
+
+	count := func(subscriptionID string) int {
+		response, err := f.service.ListDeliveries(context.Background(), models.WebhookDeliveryFilter{SubscriptionID: subscriptionID})
+		if err != nil {
+			t.Fatalf("ListDeliveries: %v", err)
+		}
+		return len(response.Deliveries)
+	}
+	if got := count(all.ID); got != 2 {
+		t.Errorf("subscription to every event got %d deliveries, want 2", got)
+	}
+	if got := count(transfers.ID); got != 1 {
+		t.Errorf("subscription to transfers got %d deliveries, want 1", got)
+	}
+	if got := count(paused.ID); got != 0 {
+		t.Errorf("paused subscription got %d deliveries, want 0", got)
+	}
+
+	f.deliverOnce(t, 3)
+	if len(received()) != 3 {
+		t.Errorf("receiver got %d requests, want 3", len(received()))
+	}
+
+	// Deliveries of a paused subscription wait until it is resumed
+	active = false
+	if _, err := f.service.UpdateSubscription(context.Background(), transfers.ID, &models.UpdateWebhookSubscriptionRequest{
+		URL:        transfers.URL,
+		EventTypes: transfers.EventTypes,
+		Active:     &active,
+	}); err != nil {
+		t.Fatalf("UpdateSubscription: %v", err)
+	}
+	delivery := f.repo.onlyDeliveryOf(t, transfers.ID)
+	if _, err := f.service.Redeliver(context.Background(), delivery.ID); err != nil {
+		t.Fatalf("Redeliver: %v", err)
+	}
+	f.clock = f.clock.Add(time.Minute)
+	f.deliverOnce(t, 0)
+}
+
+// onlyDeliveryOf returns the single delivery of a subscription.
+func (r *fakeWebhookRepository) onlyDeliveryOf(t *testing.T, subscriptionID string) *models.WebhookDelivery {
+	t.Helper()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var found []*models.WebhookDelivery
+	for _, delivery := range r.deliveries {
+		if delivery.SubscriptionID == subscriptionID {
+			found = append(found, copyDelivery(delivery))
+		}
+	}
+	if len(found) != 1 {
+		t.Fatalf("subscription %s has %d deliveries, want 1", subscriptionID, len(found))
+	}
+	return found[0]
+}
+
+func TestWebhookDispatcherDoesNotFollowRedirects(t *testing.T) {
+	f := newWebhookFixture(t, DefaultWebhookRetryPolicy)
+	target, received := newWebhookReceiver(t, http.StatusOK)
+	redirect := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, target.URL, http.StatusFound)
+	}))
+	t.Cleanup(redirect.Close)
+	f.subscribe(t, redirect.URL)
+	f.publish(t, models.DomainEventTransferPosted)
+
+	f.deliverOnce(t, 1)
+
+	if len(received()) != 0 {
+		t.Errorf("redirect target got %d requests, want none", len(received()))
+	}
+	delivery := f.repo.onlyDelivery(t)
+	if delivery.Status != models.WebhookDeliveryStatusPending || delivery.Attempts != 1 {
+		t.Fatalf("delivery is %s after %d attempts, want PENDING after 1", delivery.Status, delivery.Attempts)
+	}
+	logged, err := f.service.GetDelivery(context.Background(), delivery.ID)
+	if err != nil {
+		t.Fatalf("GetDelivery: %v", err)
+	}
+	if code := logged.AttemptLog[0].ResponseCode; code == nil || *code != http.StatusFound {
+		t.Errorf("attempt response code = %v, want %d", code, http.StatusFound)
+	}
+}
+
+func TestWebhookDispatcherDropsAttemptAfterLosingLease(t *testing.T) {
+	f := newWebhookFixture(t, DefaultWebhookRetryPolicy)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Another dispatcher claims the delivery while this attempt runs
+		f.repo.mu.Lock()
+		for _, delivery := range f.repo.deliveries {
+			leaseUntil := delivery.LeasedUntil.Add(time.Minute)
+			delivery.LeasedUntil = &leaseUntil
+		}
+		f.repo.mu.Unlock()
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(receiver.Close)
+	f.subscribe(t, receiver.URL)
+	f.publish(t, models.DomainEventTransferPosted)
+
+	f.deliverOnce(t, 1)
+
+	delivery := f.repo.onlyDelivery(t)
+	if delivery.Status != models.WebhookDeliveryStatusPending || delivery.Attempts != 0 {
+		t.Errorf("delivery is %s after %d attempts, want PENDING after 0", delivery.Status, delivery.Attempts)
+	}
+	if delivery.LeasedUntil == nil {
+		t.Error("the other dispatcher's lease was cleared")
+	}
+}
+
+func TestTruncateKeepsWholeCharacters(t *testing.T) {
+	tests := []struct {
+		s    string
+		n    int
+		want string
+	}{
+		{"short", 10, "short"},
+		{"exactly", 7, "exactly"},
+		{"truncated", 5, "trunc..."},
+		{"héllo wörld", 7, "héllo w..."},
+		{"日本語のテキスト", 3, "日本語..."},
+	}
+	for _, tt := range tests {
+		if got := truncate(tt.s, tt.n); got != tt.want {
+			t.Errorf("truncate(%q, %d) = %q, want %q", tt.s, tt.n, got, tt.want)
+		}
+	}
+}
+
+func TestWebhookClientRefusesLocalAddresses(t *testing.T) {
+	server, received := newWebhookReceiver(t, http.StatusOK)
+
+	_, err := NewWebhookClient(5*time.Second, false).Post(server.URL, "application/json", strings.NewReader("{}"))
+	if err == nil || !strings.Contains(err.Error(), "not allowed") {
+		t.Errorf("POST to %s = %v, want the address refused", server.URL, err)
+	}
+	if len(received()) != 0 {
+		t.Errorf("receiver got %d requests, want none", len(received()))
+	}
+}
+
+func TestWebhookServiceRejectsLocalHosts(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	service := NewWebhookService(newFakeWebhookRepository(), false, logger)
+	ctx := context.Background()
+
+	for _, url := range []string{
+		"http://localhost:8080/hooks",
+		"http://api.localhost/hooks",
+		"http://127.0.0.1/hooks",
+		"http://[::1]/hooks",
+		"http://169.254.169.254/latest/meta-data",
+		"http://0.0.0.0/hooks",
+	} {
+		_, err := service.CreateSubscription(ctx, &models.CreateWebhookSubscriptionRequest{URL: url})
+		if !errors.IsValidationError(err) {
+			t.Errorf("%s: got %v, want a validation error", url, err)
+		}
+	}
+
+	for _, url := range []string{"https://example.com/hooks", "http://10.0.0.7/hooks"} {
+		if _, err := service.CreateSubscription(ctx, &models.CreateWebhookSubscriptionRequest{URL: url}); err != nil {
+			t.Errorf("%s: %v", url, err)
+		}
+	}
+}
+
+func TestWebhookServiceValidatesSubscriptions(t *testing.T) {
+	f := newWebhookFixture(t, DefaultWebhookRetryPolicy)
+	ctx := context.Background()
+
+	for name, req := range map[string]*models.CreateWebhookSubscriptionRequest{
+		"relative url":  {URL: "/hooks"},
+		"ftp url":       {URL: "ftp://example.com/hooks"},
+		"unknown event": {URL: "https://example.com/hooks", EventTypes: []models.DomainEventType{"transfer.lost"}},
+		"short secret":  {URL: "https://example.com/hooks", Secret: "short"},
+	} {
+		if _, err := f.service.CreateSubscription(ctx, req); !errors.IsValidationError(err) {
+			t.Errorf("%s: got %v, want a validation error", name, err)
+		}
+	}
+
+	subscription, err := f.service.CreateSubscription(ctx, &models.CreateWebhookSubscriptionRequest{URL: "https://example.com/hooks"})
+	if err != nil {
+		t.Fatalf("CreateSubscription: %v", err)
+	}
+	if !strings.HasPrefix(subscription.Secret, "whsec_") {
+		t.Errorf("generated secret %q, want a whsec_ prefix", subscription.Secret)
+	}
+	fetched, err := f.service.GetSubscription(ctx, subscription.ID)
+	if err != nil {
+		t.Fatalf("GetSubscription: %v", err)
+	}
+	if fetched.Secret != "" {
+		t.Errorf("GetSubscription returned the secret")
+	}
+	if _, err := f.service.GetSubscription(ctx, "not-a-uuid"); err != errors.ErrInvalidWebhookID {
+		t.Errorf("GetSubscription of malformed ID = %v, want %v", err, errors.ErrInvalidWebhookID)
+	}
+}
+
+func TestVerifyWebhookSignature(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	body := []byte(`{"id":"evt"}`)
+	signature := SignWebhookPayload(testWebhookSecret, now, body)
+	timestamp := "1700000000"
+
+	if err := VerifyWebhookSignature(testWebhookSecret, signature, timestamp, body, now.Add(time.Minute), 5*time.Minute); err != nil {
+		t.Fatalf("valid signature rejected: %v", err)
+	}
+
+	for name, tc := range map[string]struct {
+		secret, signature, timestamp string
+		body                         []byte
+		now                          time.Time
+	}{
+		"tampered body":     {testWebhookSecret, signature, timestamp, []byte(`{"id":"evu"}`), now},
+		"wrong secret":      {"another-secret-123456", signature, timestamp, body, now},
+		"shifted timestamp": {testWebhookSecret, signature, "1700000001", body, now},
+		"stale timestamp":   {testWebhookSecret, signature, timestamp, body, now.Add(6 * time.Minute)},
+		"future timestamp":  {testWebhookSecret, signature, timestamp, body, now.Add(-6 * time.Minute)},
+		"malformed":         {testWebhookSecret, signature, "yesterday", body, now},
+		"unversioned":       {testWebhookSecret, strings.TrimPrefix(signature, "v1="), timestamp, body, now},
+	} {
+		if err := VerifyWebhookSignature(tc.secret, tc.signature, tc.timestamp, tc.body, tc.now, 5*time.Minute); err == nil {
+			t.Errorf("%s: signature accepted", name)
+		}
+	}
+}
+
+func TestWebhookRetryPolicyDelay(t *testing.T) {
+	policy := WebhookRetryPolicy{MaxAttempts: 10, BaseDelay: 30 * time.Second, MaxDelay: 10 * time.Minute}
+	want := []time.Duration{
+		30 * time.Second,
+		time.Minute,
+		2 * time.Minute,
+		4 * time.Minute,
+		8 * time.Minute,
+		10 * time.Minute,
+		10 * time.Minute,
+	}
+	for i, delay := range want {
+		if got := policy.Delay(i + 1); got != delay {
+			t.Errorf("Delay(%d) = %v, want %v", i+1, got, delay)
+		}
+	}
+	if got := policy.Delay(1000); got != policy.MaxDelay {
+		t.Errorf("Delay(1000) = %v, want %v", got, policy.MaxDelay)
+	}
+}
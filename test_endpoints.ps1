@@ -43,11 +43,11 @@ Test-Endpoint -Name "Health Check" -Method Get -Uri "$baseUrl/health"
 
 # Test 2: Create account 1
 Test-Endpoint -Name "Create Account 1" -Method Post -Uri "$baseUrl/accounts" `
-    -Body '{"id":"acc001","initial_balance":1000}'
+    -Body '{"id":"acc001","currency":"USD","initial_balance":1000}'
 
 # Test 3: Create account 2
 Test-Endpoint -Name "Create Account 2" -Method Post -Uri "$baseUrl/accounts" `
-    -Body '{"id":"acc002","initial_balance":500}'
+    -Body '{"id":"acc002","currency":"USD","initial_balance":500}'
 
 # Test 4: Get account 1
 Test-Endpoint -Name "Get Account 1" -Method Get -Uri "$baseUrl/accounts/acc001"
@@ -67,7 +67,7 @@ Test-Endpoint -Name "Verify Account 2 Balance" -Method Get -Uri "$baseUrl/accoun
 
 # Test 9: Try duplicate account (should fail)
 Test-Endpoint -Name "Try Duplicate Account (should fail)" -Method Post -Uri "$baseUrl/accounts" `
-    -Body '{"id":"acc001","initial_balance":500}'
+    -Body '{"id":"acc001","currency":"USD","initial_balance":500}'
 
 # Test 10: Try insufficient balance transfer (should fail)
 Test-Endpoint -Name "Try Insufficient Balance (should fail)" -Method Post -Uri "$baseUrl/transactions" `
@@ -4,12 +4,12 @@ Write-Host "Test 1: Health Check"
 Invoke-WebRequest -Uri "$baseUrl/health" -Method Get -UseBasicParsing | Select-Object StatusCode, Content
 
 Write-Host "`nTest 2: Create Account 1"
-$body = @{id="acc001"; initial_balance=1000} | ConvertTo-Json
+$body = @{id="acc001"; currency="USD"; initial_balance=1000} | ConvertTo-Json
 $r = Invoke-WebRequest -Uri "$baseUrl/accounts" -Method Post -Headers @{"Content-Type"="application/json"} -Body $body -UseBasicParsing
 Write-Host "Status: $($r.StatusCode), Body: $($r.Content)"
 
 Write-Host "`nTest 3: Create Account 2"
-$body = @{id="acc002"; initial_balance=500} | ConvertTo-Json
+$body = @{id="acc002"; currency="USD"; initial_balance=500} | ConvertTo-Json
 $r = Invoke-WebRequest -Uri "$baseUrl/accounts" -Method Post -Headers @{"Content-Type"="application/json"} -Body $body -UseBasicParsing
 Write-Host "Status: $($r.StatusCode), Body: $($r.Content)"
 
@@ -35,7 +35,7 @@ $r = Invoke-WebRequest -Uri "$baseUrl/accounts/acc002" -Method Get -UseBasicPars
 Write-Host "Status: $($r.StatusCode), Body: $($r.Content)"
 
 Write-Host "`nTest 9: Try duplicate account (should fail with 409)"
-$body = @{id="acc001"; initial_balance=500} | ConvertTo-Json
+$body = @{id="acc001"; currency="USD"; initial_balance=500} | ConvertTo-Json
 try {
     $r = Invoke-WebRequest -Uri "$baseUrl/accounts" -Method Post -Headers @{"Content-Type"="application/json"} -Body $body -UseBasicParsing -ErrorAction Stop
     Write-Host "Status: $($r.StatusCode), Body: $($r.Content)"